@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	stdCrypto "crypto/rand"
+	"dawpitech/area/crypto"
+	"dawpitech/area/engines/mailEngine"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"dawpitech/area/models/routes"
+	"dawpitech/area/utils"
+	"encoding/base64"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"gorm.io/gorm"
+	"log"
+	"net/url"
+	"os"
+	"time"
+)
+
+const emailVerificationLifetime = 48 * time.Hour
+
+const passwordResetLifetime = time.Hour
+
+// issueOneTimeToken returns a new token for the given purpose, the previous
+// ones of the user for the same purpose can't be used anymore.
+func issueOneTimeToken(userID uint, purpose models.TokenPurpose, lifetime time.Duration) (string, error) {
+	var token string
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if rst := tx.
+			Model(&models.OneTimeToken{}).
+			Where("user_id=? AND purpose=? AND used_at IS NULL", userID, purpose).
+			Update("used_at", time.Now()); rst.Error != nil {
+			return rst.Error
+		}
+		var err error
+		token, err = createOneTimeToken(tx, userID, purpose, lifetime)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// createOneTimeToken saves a new token without revoking the previous ones.
+func createOneTimeToken(tx *gorm.DB, userID uint, purpose models.TokenPurpose, lifetime time.Duration) (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := stdCrypto.Read(bytes); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(bytes)
+
+	if rst := tx.Create(&models.OneTimeToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: crypto.HashToken(token),
+		ExpiresAt: time.Now().Add(lifetime),
+	}); rst.Error != nil {
+		return "", rst.Error
+	}
+	return token, nil
+}
+
+// consumeOneTimeToken marks the token as used and returns it, the update is
+// conditional so a token can't be used twice concurrently.
+func consumeOneTimeToken(token string, purpose models.TokenPurpose) (*models.OneTimeToken, error) {
+	now := time.Now()
+	hash := crypto.HashToken(token)
+	rst := initializers.DB.
+		Model(&models.OneTimeToken{}).
+		Where("token_hash=? AND purpose=? AND used_at IS NULL AND expires_at > ?", hash, purpose, now).
+		Update("used_at", now)
+	if rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	if rst.RowsAffected == 0 {
+		return nil, errors.NewBadRequest(nil, "Invalid or expired token.")
+	}
+
+	var oneTimeToken models.OneTimeToken
+	if rst := initializers.DB.Where("token_hash=?", hash).First(&oneTimeToken); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	return &oneTimeToken, nil
+}
+
+// frontendLink returns the link of the web client page handling the token.
+func frontendLink(path string, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", os.Getenv("FRONTEND_URL"), path, url.QueryEscape(token))
+}
+
+func sendVerificationEmail(userID uint, email string) error {
+	token, err := issueOneTimeToken(userID, models.EmailVerificationPurpose, emailVerificationLifetime)
+	if err != nil {
+		return err
+	}
+	return mailEngine.Send(email, "Verify your AREA email address", fmt.Sprintf(
+		"Welcome to AREA!\n\nPlease confirm your email address by opening the following link:\n%s\n\nThe link expires in %s.",
+		frontendLink("/verify-email", token), emailVerificationLifetime,
+	))
+}
+
+func setPassword(authID uint, password string) error {
+	hash, err := crypto.GenerateEncodedHash(password)
+	if err != nil {
+		return err
+	}
+	return initializers.DB.
+		Model(&models.AuthMethods{}).
+		Where("id=?", authID).
+		Update("password_hash", hash).Error
+}
+
+func VerifyEmail(_ *gin.Context, in *routes.VerifyEmailRequest) (*routes.UserCreationResponse, error) {
+	oneTimeToken, err := consumeOneTimeToken(in.Token, models.EmailVerificationPurpose)
+	if err != nil {
+		return nil, err
+	}
+
+	if rst := initializers.DB.
+		Model(&models.AuthMethods{}).
+		Where("user_id=? AND email_verified_at IS NULL", oneTimeToken.UserID).
+		Update("email_verified_at", time.Now()); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	return &routes.UserCreationResponse{
+		Status: "ok",
+	}, nil
+}
+
+func ResendVerificationEmail(c *gin.Context) (*routes.UserCreationResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	auth, err := getAuthMethods(user.ID)
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	if auth.EmailVerifiedAt != nil {
+		return nil, errors.NewBadRequest(nil, "The email address is already verified.")
+	}
+
+	if err := sendVerificationEmail(user.ID, auth.Email); err != nil {
+		log.Print(err.Error())
+		return nil, errors.New("Couldn't send the verification email.")
+	}
+
+	return &routes.UserCreationResponse{
+		Status: "ok",
+	}, nil
+}
+
+// RequestPasswordReset mails a reset link to the address, the response is the
+// same whether an account uses it or not.
+func RequestPasswordReset(_ *gin.Context, in *routes.PasswordResetRequest) (*routes.UserCreationResponse, error) {
+	response := &routes.UserCreationResponse{
+		Status: "ok",
+	}
+
+	var auth models.AuthMethods
+	if rst := initializers.DB.Where("email=?", in.Email).First(&auth); rst.Error != nil {
+		if errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+			return response, nil
+		}
+		return nil, errors.New("Internal server error.")
+	}
+
+	token, err := issueOneTimeToken(auth.UserID, models.PasswordResetPurpose, passwordResetLifetime)
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	if err := mailEngine.Send(auth.Email, "Reset your AREA password", fmt.Sprintf(
+		"A password reset was requested for your AREA account.\n\nChoose a new password by opening the following link:\n%s\n\nThe link expires in %s. If you didn't ask for it, you can ignore this email.",
+		frontendLink("/reset-password", token), passwordResetLifetime,
+	)); err != nil {
+		log.Print(err.Error())
+	}
+
+	return response, nil
+}
+
+// ConfirmPasswordReset sets the new password and signs the user out of every
+// device.
+func ConfirmPasswordReset(_ *gin.Context, in *routes.PasswordResetConfirmRequest) (*routes.UserCreationResponse, error) {
+	oneTimeToken, err := consumeOneTimeToken(in.Token, models.PasswordResetPurpose)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := getAuthMethods(oneTimeToken.UserID)
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	if err := setPassword(auth.ID, in.NewPassword); err != nil {
+		log.Print(err.Error())
+		return nil, errors.New("Internal server error.")
+	}
+
+	// Following the link proves the ownership of the address as well.
+	if auth.EmailVerifiedAt == nil {
+		if rst := initializers.DB.Model(auth).Update("email_verified_at", time.Now()); rst.Error != nil {
+			return nil, errors.New("Internal server error.")
+		}
+	}
+
+	if err := revokeSessions(initializers.DB.Where("user_id=?", auth.UserID)); err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	return &routes.UserCreationResponse{
+		Status: "ok",
+	}, nil
+}
+
+// ChangePassword sets the new password and signs the user out of every other
+// device.
+func ChangePassword(c *gin.Context, in *routes.ChangePasswordRequest) (*routes.UserCreationResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	auth, err := getAuthMethods(user.ID)
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	match, err := checkPassword(*auth, in.CurrentPassword)
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	if !match {
+		return nil, errors.NewForbidden(nil, "Invalid password.")
+	}
+
+	if err := setPassword(auth.ID, in.NewPassword); err != nil {
+		log.Print(err.Error())
+		return nil, errors.New("Internal server error.")
+	}
+
+	others := initializers.DB.Where("user_id=?", user.ID)
+	if session, ok := utils.MaybeGetSession(c); ok {
+		others = others.Where("id <> ?", session.ID)
+	}
+	if err := revokeSessions(others); err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	return &routes.UserCreationResponse{
+		Status: "ok",
+	}, nil
+}
@@ -0,0 +1,535 @@
+package controllers
+
+import (
+	"dawpitech/area/engines/auditEngine"
+	"dawpitech/area/engines/clusterEngine"
+	"dawpitech/area/engines/schedulerEngine"
+	"dawpitech/area/engines/workflowEngine"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"dawpitech/area/models/routes"
+	"dawpitech/area/services"
+	"dawpitech/area/utils"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"gorm.io/gorm"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultStatsWindow = 24 * time.Hour
+
+// maxStatsWindow bounds how far back the service stats go.
+const maxStatsWindow = 30 * 24 * time.Hour
+
+// stepStatsRow counts the traces of the runs for a modifier or reaction.
+type stepStatsRow struct {
+	Name     string
+	Steps    int64
+	Failures int64
+}
+
+func newAdminPublicUser(user models.User) routes.AdminPublicUser {
+	publicUser := routes.AdminPublicUser{
+		UserID:     user.ID,
+		IsAdmin:    user.IsAdmin,
+		CreatedAt:  user.CreatedAt,
+		DisabledAt: user.DisabledAt,
+	}
+	var auth models.AuthMethods
+	if rst := initializers.DB.Select("email").Where("user_id=?", user.ID).First(&auth); rst.Error == nil {
+		publicUser.Email = auth.Email
+	}
+	initializers.DB.Model(&models.Workflow{}).Where("owner_user_id=?", user.ID).Count(&publicUser.WorkflowsCount)
+	return publicUser
+}
+
+// getAdminTarget returns the user targeted by an admin action, the admins
+// can't act on their own account to avoid locking themselves out.
+func getAdminTarget(c *gin.Context, userID uint) (*models.User, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	admin, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+	if admin.ID == userID {
+		return nil, errors.NewBadRequest(nil, "Admins can't do this on their own account.")
+	}
+
+	var user models.User
+	if rst := initializers.DB.Where("id=?", userID).First(&user); rst.Error != nil {
+		if errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.NewNotFound(nil, "No user found with the given ID.")
+		}
+		return nil, errors.New("Internal server error.")
+	}
+	return &user, nil
+}
+
+// disableWorkflows stops the triggers of the workflows found by the query and
+// marks them inactive.
+func disableWorkflows(query *gorm.DB) error {
+	var workflows []models.Workflow
+	if rst := query.Where("active=?", true).Find(&workflows); rst.Error != nil {
+		return rst.Error
+	}
+	for _, workflow := range workflows {
+		if err, ok := workflowEngine.DisableWorkflowTrigger(workflow); !ok {
+			log.Print(err.Error())
+		}
+		if rst := initializers.DB.Model(&workflow).Update("active", false); rst.Error != nil {
+			return rst.Error
+		}
+	}
+	return nil
+}
+
+// deleteConnections revokes and deletes the provider connections of the
+// user, once the triggers of the given workflows released what they
+// registered with them.
+func deleteConnections(userID uint, workflows []models.Workflow) error {
+	for _, workflow := range workflows {
+		if err, ok := workflowEngine.ReleaseWorkflowTrigger(workflow); !ok {
+			log.Print(err.Error())
+		}
+	}
+	for _, current := range services.Services {
+		if _, err := services.DeleteConnections(current, userID, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func AdminGetAllUsers(_ *gin.Context, in *routes.AdminUserListRequest) (*routes.AdminUserListResponse, error) {
+	query := initializers.DB.Model(&models.User{})
+	if in.Search != "" {
+		query = query.Where(
+			"id IN (?)",
+			initializers.DB.
+				Model(&models.AuthMethods{}).
+				Select("user_id").
+				Where("email ILIKE ?", "%"+in.Search+"%"),
+		)
+	}
+
+	response := &routes.AdminUserListResponse{}
+	if rst := query.Count(&response.Total); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	var users []models.User
+	if rst := query.Order("id asc").Limit(in.Limit).Offset(in.Offset).Find(&users); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	response.Users = make([]routes.AdminPublicUser, 0, len(users))
+	for _, user := range users {
+		response.Users = append(response.Users, newAdminPublicUser(user))
+	}
+	return response, nil
+}
+
+func AdminGetUser(_ *gin.Context, in *routes.AdminUserID) (*routes.AdminPublicUser, error) {
+	var user models.User
+	if rst := initializers.DB.Where("id=?", in.UserID).First(&user); rst.Error != nil {
+		return nil, errors.NewNotFound(nil, "No user found with the given ID.")
+	}
+
+	response := newAdminPublicUser(user)
+	return &response, nil
+}
+
+// AdminDisableUser signs the user out of every device and stops their
+// personal workflows, the organizations ones keep running.
+func AdminDisableUser(c *gin.Context, in *routes.AdminUserID) (*routes.AdminPublicUser, error) {
+	user, err := getAdminTarget(c, in.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, errors.NewBadRequest(nil, "The user is already disabled.")
+	}
+
+	now := time.Now()
+	user.DisabledAt = &now
+	if rst := initializers.DB.Model(user).Update("disabled_at", now); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	if err := revokeSessions(initializers.DB.Where("user_id=?", user.ID)); err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	if err := disableWorkflows(initializers.DB.Where("owner_user_id=? AND organization_id IS NULL", user.ID)); err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	auditEngine.RecordRequest(c, models.AuditEntry{
+		Action:     models.AdminUserDisableAction,
+		TargetType: models.UserTarget,
+		TargetID:   user.ID,
+	})
+
+	response := newAdminPublicUser(*user)
+	return &response, nil
+}
+
+func AdminEnableUser(c *gin.Context, in *routes.AdminUserID) (*routes.AdminPublicUser, error) {
+	user, err := getAdminTarget(c, in.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt == nil {
+		return nil, errors.NewBadRequest(nil, "The user is not disabled.")
+	}
+
+	user.DisabledAt = nil
+	if rst := initializers.DB.Model(user).Update("disabled_at", nil); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	auditEngine.RecordRequest(c, models.AuditEntry{
+		Action:     models.AdminUserEnableAction,
+		TargetType: models.UserTarget,
+		TargetID:   user.ID,
+	})
+
+	response := newAdminPublicUser(*user)
+	return &response, nil
+}
+
+// AdminDeleteUser removes the account with its personal workflows and
+// provider connections. The organization workflows running as the user
+// switch to the organization's service account.
+func AdminDeleteUser(c *gin.Context, in *routes.AdminUserID) error {
+	user, err := getAdminTarget(c, in.UserID)
+	if err != nil {
+		return err
+	}
+
+	var members []models.OrganizationMember
+	if rst := initializers.DB.Where("user_id=?", user.ID).Find(&members); rst.Error != nil {
+		return errors.New("Internal server error.")
+	}
+	for _, member := range members {
+		if member.Role != models.OwnerRole {
+			continue
+		}
+		owners, err := countOwners(member.OrganizationID)
+		if err != nil {
+			return errors.New("Internal server error.")
+		}
+		if owners <= 1 {
+			return errors.NewBadRequest(nil, fmt.Sprintf("The user is the last owner of the organization #%d.", member.OrganizationID))
+		}
+	}
+
+	personal := initializers.DB.
+		Where("owner_user_id=? AND organization_id IS NULL", user.ID).
+		Session(&gorm.Session{})
+	if err := disableWorkflows(personal); err != nil {
+		return errors.New("Internal server error.")
+	}
+	var workflows []models.Workflow
+	if rst := personal.Find(&workflows); rst.Error != nil {
+		return errors.New("Internal server error.")
+	}
+	workflowIDs := make([]uint, 0, len(workflows))
+	for _, workflow := range workflows {
+		workflowIDs = append(workflowIDs, workflow.ID)
+	}
+	if err := deleteConnections(user.ID, workflows); err != nil {
+		log.Print(err.Error())
+		return errors.New("Internal server error.")
+	}
+
+	auth, err := getAuthMethods(user.ID)
+	if err != nil {
+		return errors.New("Internal server error.")
+	}
+
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		for _, member := range members {
+			var organization models.Organization
+			if rst := tx.Where("id=?", member.OrganizationID).First(&organization); rst.Error != nil {
+				return rst.Error
+			}
+			if rst := tx.
+				Model(&models.Workflow{}).
+				Where("organization_id=? AND run_as_user_id=?", organization.ID, user.ID).
+				Update("run_as_user_id", organization.ServiceUserID); rst.Error != nil {
+				return rst.Error
+			}
+		}
+		if rst := tx.Unscoped().Where("user_id=?", user.ID).Delete(&models.OrganizationMember{}); rst.Error != nil {
+			return rst.Error
+		}
+		if len(workflowIDs) > 0 {
+			if rst := tx.Where("id IN ?", workflowIDs).Delete(&models.Workflow{}); rst.Error != nil {
+				return rst.Error
+			}
+		}
+		if err := revokeSessions(tx.Where("user_id=?", user.ID)); err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&models.APIToken{}, &models.RecoveryCode{}, &models.OneTimeToken{}} {
+			if rst := tx.Unscoped().Where("user_id=?", user.ID).Delete(model); rst.Error != nil {
+				return rst.Error
+			}
+		}
+		// The email address and the provider accounts can be used again by
+		// a new account.
+		if rst := tx.Unscoped().Where("auth_methods_id=?", auth.ID).Delete(&models.ExternalIdentity{}); rst.Error != nil {
+			return rst.Error
+		}
+		if rst := tx.Unscoped().Delete(auth); rst.Error != nil {
+			return rst.Error
+		}
+		return tx.Delete(user).Error
+	})
+	if err != nil {
+		log.Print(err.Error())
+		return errors.New("Internal server error.")
+	}
+
+	for _, workflowID := range workflowIDs {
+		workflowEngine.ClearTriggerStates(workflowID)
+	}
+
+	auditEngine.RecordRequest(c, models.AuditEntry{
+		Action:     models.AdminUserDeleteAction,
+		TargetType: models.UserTarget,
+		TargetID:   user.ID,
+		Details: map[string]string{
+			"email": auth.Email,
+		},
+	})
+	return nil
+}
+
+func AdminSetAdmin(c *gin.Context, in *routes.AdminSetAdminRequest) (*routes.AdminPublicUser, error) {
+	user, err := getAdminTarget(c, in.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.IsAdmin = in.IsAdmin
+	if rst := initializers.DB.Model(user).Update("is_admin", in.IsAdmin); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	action := models.AdminUserDemoteAction
+	if in.IsAdmin {
+		action = models.AdminUserPromoteAction
+	}
+	auditEngine.RecordRequest(c, models.AuditEntry{
+		Action:     action,
+		TargetType: models.UserTarget,
+		TargetID:   user.ID,
+	})
+
+	response := newAdminPublicUser(*user)
+	return &response, nil
+}
+
+// AdminRevokeProvider revokes and deletes the connections of the user to the
+// provider, their workflows using it fail until they connect again.
+func AdminRevokeProvider(c *gin.Context, in *routes.AdminProviderRequest) error {
+	var user models.User
+	if rst := initializers.DB.Where("id=?", in.UserID).First(&user); rst.Error != nil {
+		return errors.NewNotFound(nil, "No user found with the given ID.")
+	}
+
+	var service *models.Service
+	for i := range services.Services {
+		if strings.EqualFold(services.Services[i].Name, in.Provider) && services.Services[i].AuthMethod != nil {
+			service = &services.Services[i]
+		}
+	}
+	if service == nil {
+		return errors.NewNotFound(nil, "No provider found with the given name.")
+	}
+
+	accounts, err := services.DeleteConnections(*service, user.ID, 0)
+	if err != nil {
+		log.Print(err.Error())
+		return errors.New("Internal server error.")
+	}
+
+	for _, account := range accounts {
+		auditEngine.RecordRequest(c, models.AuditEntry{
+			Action:     models.AdminProviderRevokeAction,
+			TargetType: models.UserTarget,
+			TargetID:   user.ID,
+			Details: map[string]string{
+				"provider": strings.ToLower(service.Name),
+				"account":  account.AccountName,
+			},
+		})
+	}
+	return nil
+}
+
+func AdminGetAllWorkflows(_ *gin.Context, in *routes.AdminWorkflowListRequest) (*routes.AdminWorkflowListResponse, error) {
+	query := initializers.DB.Model(&models.Workflow{})
+	if in.OwnerUserID != 0 {
+		query = query.Where("owner_user_id=?", in.OwnerUserID)
+	}
+	if in.Active {
+		query = query.Where("active=?", true)
+	}
+
+	response := &routes.AdminWorkflowListResponse{}
+	if rst := query.Count(&response.Total); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	var workflows []models.Workflow
+	if rst := query.Order("id asc").Limit(in.Limit).Offset(in.Offset).Find(&workflows); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	response.Workflows = make([]routes.AdminPublicWorkflow, 0, len(workflows))
+	for _, workflow := range workflows {
+		response.Workflows = append(response.Workflows, routes.AdminPublicWorkflow{
+			WorkflowID:     workflow.ID,
+			Name:           workflow.Name,
+			OwnerUserID:    workflow.OwnerUserID,
+			OrganizationID: workflow.OrganizationID,
+			ActionName:     workflow.ActionName,
+			Active:         workflow.Active,
+			UpdatedAt:      workflow.UpdatedAt,
+		})
+	}
+	return response, nil
+}
+
+func AdminDisableWorkflow(c *gin.Context, in *routes.WorkflowID) error {
+	var workflow models.Workflow
+	if rst := initializers.DB.Where("id=?", in.WorkflowID).First(&workflow); rst.Error != nil {
+		return errors.NewNotFound(nil, "No workflow found with the given ID.")
+	}
+	if !workflow.Active {
+		return errors.NewBadRequest(nil, "The workflow is not active.")
+	}
+
+	if err := disableWorkflows(initializers.DB.Where("id=?", workflow.ID)); err != nil {
+		return errors.New("Internal server error.")
+	}
+
+	auditEngine.RecordRequest(c, models.AuditEntry{
+		Action:     models.AdminWorkflowDisableAction,
+		TargetType: models.WorkflowTarget,
+		TargetID:   workflow.ID,
+		Details: map[string]string{
+			"owner_user_id": fmt.Sprint(workflow.OwnerUserID),
+		},
+	})
+	return nil
+}
+
+// AdminGetServiceStats computes the error rate of the steps of every service
+// from the runs traces, the actions only fail through the run itself so they
+// aren't counted. The traces are counted by the database.
+func AdminGetServiceStats(_ *gin.Context, in *routes.AdminServiceStatsRequest) (*routes.AdminServiceStatsResponse, error) {
+	since := time.Now().Add(-defaultStatsWindow)
+	if in.Since != nil {
+		since = *in.Since
+	}
+	if oldest := time.Now().Add(-maxStatsWindow); since.Before(oldest) {
+		since = oldest
+	}
+
+	serviceOfStep := make(map[string]string)
+	for _, service := range services.Services {
+		for _, modifier := range service.Modifiers {
+			serviceOfStep[modifier.Name] = service.Name
+		}
+		for _, reaction := range service.Reactions {
+			serviceOfStep[reaction.Name] = service.Name
+		}
+	}
+
+	// The traces are stored as a JSON array, a run without steps holds null.
+	var rows []stepStatsRow
+	if rst := initializers.DB.
+		Table("workflow_runs, jsonb_array_elements(CASE WHEN jsonb_typeof(workflow_runs.steps::jsonb) = 'array' THEN workflow_runs.steps::jsonb ELSE '[]'::jsonb END) AS step").
+		Select("step->>'Name' AS name, COUNT(*) AS steps, COUNT(*) FILTER (WHERE COALESCE(step->>'Error', '') <> '') AS failures").
+		Where("workflow_runs.deleted_at IS NULL AND workflow_runs.triggered_at >= ? AND workflow_runs.mode <> ?", since, models.DryRunMode).
+		Where("COALESCE((step->>'Skipped')::boolean, false) = false").
+		Group("step->>'Name'").
+		Scan(&rows); rst.Error != nil {
+		log.Print(rst.Error.Error())
+		return nil, errors.New("Internal server error.")
+	}
+
+	stats := make(map[string]*routes.AdminServiceStats)
+	for _, row := range rows {
+		serviceName, ok := serviceOfStep[row.Name]
+		if !ok {
+			continue
+		}
+		stat, ok := stats[serviceName]
+		if !ok {
+			stat = &routes.AdminServiceStats{Service: serviceName}
+			stats[serviceName] = stat
+		}
+		stat.Steps += row.Steps
+		stat.Failures += row.Failures
+	}
+
+	response := &routes.AdminServiceStatsResponse{
+		Since:    since,
+		Services: make([]routes.AdminServiceStats, 0, len(stats)),
+	}
+	for _, stat := range stats {
+		stat.ErrorRate = float64(stat.Failures) / float64(stat.Steps)
+		response.Services = append(response.Services, *stat)
+	}
+	sort.Slice(response.Services, func(i, j int) bool {
+		return response.Services[i].Service < response.Services[j].Service
+	})
+	return response, nil
+}
+
+// AdminGetTriggerJobs lists the triggers armed on the instance answering,
+// only the leader has some.
+func AdminGetTriggerJobs(_ *gin.Context) (*routes.AdminTriggerJobsResponse, error) {
+	jobsOfWorkflow := make(map[uint]schedulerEngine.JobInfo)
+	for _, job := range schedulerEngine.ListJobs() {
+		jobsOfWorkflow[job.WorkflowID] = job
+	}
+
+	response := &routes.AdminTriggerJobsResponse{
+		NodeName: clusterEngine.NodeName,
+		IsLeader: clusterEngine.IsLeader(),
+		Jobs:     make([]routes.AdminTriggerJob, 0),
+	}
+	for _, workflow := range workflowEngine.ArmedWorkflows() {
+		job := routes.AdminTriggerJob{
+			WorkflowID: workflow.ID,
+			ActionName: workflow.ActionName,
+		}
+		if info, ok := jobsOfWorkflow[workflow.ID]; ok {
+			job.JobID = info.JobID.String()
+			if !info.LastRun.IsZero() {
+				job.LastRun = &info.LastRun
+			}
+			if !info.NextRun.IsZero() {
+				job.NextRun = &info.NextRun
+			}
+		}
+		response.Jobs = append(response.Jobs, job)
+	}
+	sort.Slice(response.Jobs, func(i, j int) bool {
+		return response.Jobs[i].WorkflowID < response.Jobs[j].WorkflowID
+	})
+	return response, nil
+}
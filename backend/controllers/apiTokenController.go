@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	stdCrypto "crypto/rand"
+	"dawpitech/area/crypto"
+	"dawpitech/area/engines/auditEngine"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"dawpitech/area/models/routes"
+	"dawpitech/area/utils"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"log"
+	"strings"
+	"time"
+)
+
+func newPublicAPIToken(apiToken models.APIToken) routes.PublicAPIToken {
+	return routes.PublicAPIToken{
+		TokenID:    apiToken.ID,
+		Name:       apiToken.Name,
+		Prefix:     models.APITokenPrefix + apiToken.Prefix,
+		Scopes:     apiToken.Scopes,
+		CreatedAt:  apiToken.CreatedAt,
+		ExpiresAt:  apiToken.ExpiresAt,
+		LastUsedAt: apiToken.LastUsedAt,
+	}
+}
+
+func GetAllAPITokens(c *gin.Context) (*routes.GetAllAPITokensResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	var apiTokens []models.APIToken
+	if rst := initializers.DB.Where("user_id=?", user.ID).Order("created_at desc").Find(&apiTokens); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	response := &routes.GetAllAPITokensResponse{
+		Tokens: make([]routes.PublicAPIToken, len(apiTokens)),
+	}
+	for i, apiToken := range apiTokens {
+		response.Tokens[i] = newPublicAPIToken(apiToken)
+	}
+	return response, nil
+}
+
+func CreateAPIToken(c *gin.Context, in *routes.CreateAPITokenRequest) (*routes.CreateAPITokenResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	if in.ExpiresAt != nil && in.ExpiresAt.Before(time.Now()) {
+		return nil, errors.NewBadRequest(nil, "The expiry date must be in the future.")
+	}
+
+	prefix := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := stdCrypto.Read(prefix); err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	if _, err := stdCrypto.Read(secret); err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+
+	hash, err := crypto.GenerateEncodedHash(encodedSecret)
+	if err != nil {
+		log.Print(err.Error())
+		return nil, errors.New("Internal server error.")
+	}
+
+	apiToken := models.APIToken{
+		UserID:     user.ID,
+		Name:       in.Name,
+		Prefix:     hex.EncodeToString(prefix),
+		SecretHash: hash,
+		Scopes:     in.Scopes,
+		ExpiresAt:  in.ExpiresAt,
+	}
+	if rst := initializers.DB.Create(&apiToken); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	scopes := make([]string, len(apiToken.Scopes))
+	for i, scope := range apiToken.Scopes {
+		scopes[i] = string(scope)
+	}
+	auditEngine.RecordRequest(c, models.AuditEntry{
+		Action:     models.APITokenCreateAction,
+		TargetType: models.APITokenTarget,
+		TargetID:   apiToken.ID,
+		Details: map[string]string{
+			"name":   apiToken.Name,
+			"scopes": strings.Join(scopes, " "),
+		},
+	})
+
+	return &routes.CreateAPITokenResponse{
+		Token:   models.APITokenPrefix + apiToken.Prefix + "_" + encodedSecret,
+		Details: newPublicAPIToken(apiToken),
+	}, nil
+}
+
+func RevokeAPIToken(c *gin.Context, in *routes.APITokenID) error {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return errors.BadRequest
+	}
+
+	var apiToken models.APIToken
+	if rst := initializers.DB.Where("id=? AND user_id=?", in.TokenID, user.ID).First(&apiToken); rst.Error != nil {
+		return errors.NewNotFound(nil, "No API token found with the given ID.")
+	}
+
+	if rst := initializers.DB.Delete(&apiToken); rst.Error != nil {
+		return errors.New("Internal server error.")
+	}
+
+	auditEngine.RecordRequest(c, models.AuditEntry{
+		Action:     models.APITokenRevokeAction,
+		TargetType: models.APITokenTarget,
+		TargetID:   apiToken.ID,
+		Details: map[string]string{
+			"name": apiToken.Name,
+		},
+	})
+	return nil
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"dawpitech/area/models/routes"
+	"dawpitech/area/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"strings"
+)
+
+// GetAuditLog returns the entries from the newest, the admins see every entry
+// while the other users see what they did and what was done on their account.
+func GetAuditLog(c *gin.Context, in *routes.AuditLogRequest) (*routes.AuditLogResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	query := initializers.DB.Model(&models.AuditEntry{})
+	if user.IsAdmin {
+		if in.ActorUserID != 0 {
+			query = query.Where("actor_user_id=?", in.ActorUserID)
+		}
+		if in.TargetType != "" {
+			query = query.Where("target_type=?", in.TargetType)
+		}
+		if in.TargetID != 0 {
+			query = query.Where("target_id=?", in.TargetID)
+		}
+	} else {
+		query = query.Where("actor_user_id=? OR (target_type=? AND target_id=?)", user.ID, models.UserTarget, user.ID)
+	}
+	// A trailing dot matches a whole family, like "workflow." or "admin.".
+	if strings.HasSuffix(in.Action, ".") {
+		query = query.Where("left(action, ?) = ?", len(in.Action), in.Action)
+	} else if in.Action != "" {
+		query = query.Where("action=?", in.Action)
+	}
+	if in.Since != nil {
+		query = query.Where("created_at >= ?", *in.Since)
+	}
+	if in.Until != nil {
+		query = query.Where("created_at < ?", *in.Until)
+	}
+
+	response := &routes.AuditLogResponse{}
+	if rst := query.Count(&response.Total); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	var entries []models.AuditEntry
+	if rst := query.Order("id desc").Limit(in.Limit).Offset(in.Offset).Find(&entries); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	response.Entries = make([]routes.PublicAuditEntry, len(entries))
+	for i, entry := range entries {
+		response.Entries[i] = routes.PublicAuditEntry{
+			EntryID:     entry.ID,
+			CreatedAt:   entry.CreatedAt,
+			ActorUserID: entry.ActorUserID,
+			Action:      entry.Action,
+			TargetType:  entry.TargetType,
+			TargetID:    entry.TargetID,
+			IPAddress:   entry.IPAddress,
+			Details:     entry.Details,
+			Changes:     entry.Changes,
+		}
+	}
+	return response, nil
+}
@@ -2,47 +2,84 @@ package controllers
 
 import (
 	"dawpitech/area/crypto"
+	"dawpitech/area/engines/auditEngine"
 	"dawpitech/area/initializers"
 	"dawpitech/area/models"
 	"dawpitech/area/models/routes"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/juju/errors"
 	"gorm.io/gorm"
-	"os"
-	"time"
 )
 
-func LoginUser(_ *gin.Context, in *routes.AuthRequest) (*routes.AuthResponse, error) {
+// checkPassword never matches for the users who signed-up through a provider
+// and didn't set a password yet.
+func checkPassword(auth models.AuthMethods, password string) (bool, error) {
+	if auth.PasswordHash == "" {
+		return false, nil
+	}
+	return crypto.ValidateHash(password, auth.PasswordHash)
+}
+
+// recordSignIn writes a sign-in attempt to the audit log, failure is empty
+// when it succeeded and userID is 0 when no account matched.
+func recordSignIn(c *gin.Context, userID uint, method string, failure string, email string) {
+	entry := models.AuditEntry{
+		Action:     models.SignInSuccessAction,
+		TargetType: models.UserTarget,
+		TargetID:   userID,
+		Details: map[string]string{
+			"method": method,
+		},
+	}
+	if failure != "" {
+		entry.Action = models.SignInFailureAction
+		entry.Details["reason"] = failure
+	} else {
+		entry.ActorUserID = userID
+	}
+	if email != "" {
+		entry.Details["email"] = email
+	}
+	auditEngine.RecordRequest(c, entry)
+}
+
+func LoginUser(c *gin.Context, in *routes.AuthRequest) (*routes.AuthResponse, error) {
 	var userFound models.User
 	rst := initializers.DB.Joins("Auth").Where("email=?", in.Email).First(&userFound)
 	if rst.Error != nil {
 		if errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+			recordSignIn(c, 0, "password", "unknown_email", in.Email)
 			return nil, errors.NewForbidden(nil, "Invalid user or password.")
 		}
 		return nil, errors.New("Internal server error.")
 	}
 
-	match, err := crypto.ValidateHash(in.Password, userFound.Auth.PasswordHash)
+	match, err := checkPassword(userFound.Auth, in.Password)
 	if err != nil {
 		return nil, errors.New("Internal server error.")
 	}
 	if !match {
+		recordSignIn(c, userFound.ID, "password", "invalid_password", in.Email)
 		return nil, errors.NewForbidden(nil, "Invalid user or password.")
 	}
+	if userFound.DisabledAt != nil {
+		recordSignIn(c, userFound.ID, "password", "account_disabled", in.Email)
+		return nil, errors.NewForbidden(nil, "This account is disabled.")
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userFound.ID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
-	})
-
-	signedToken, err := token.SignedString([]byte(os.Getenv("JWT_TOKENS_SECRET")))
-
-	if err != nil {
-		return nil, errors.New("Internal server error.")
+	// The tokens are only issued once the second factor is checked by
+	// SignInTwoFactor.
+	if userFound.Auth.TOTPEnabled {
+		challengeToken, err := signChallengeToken(userFound.ID)
+		if err != nil {
+			return nil, errors.New("Internal server error.")
+		}
+		return &routes.AuthResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		}, nil
 	}
 
-	return &routes.AuthResponse{
-		Token: signedToken,
-	}, nil
+	recordSignIn(c, userFound.ID, "password", "", in.Email)
+	return openSession(c, userFound)
 }
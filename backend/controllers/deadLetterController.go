@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"dawpitech/area/engines/workflowEngine"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"dawpitech/area/models/routes"
+	"dawpitech/area/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"time"
+)
+
+func GetAllDeadLetters(c *gin.Context, in *routes.WorkflowID) (*routes.GetAllDeadLettersResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	if _, err := getAccessibleWorkflow(in.WorkflowID, user.ID, models.ViewerRole); err != nil {
+		return nil, err
+	}
+
+	var letters []models.DeadLetter
+	if rst := initializers.DB.
+		Where("workflow_id=?", in.WorkflowID).
+		Order("created_at desc").
+		Find(&letters); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	response := routes.GetAllDeadLettersResponse{
+		DeadLetters: make([]routes.PublicDeadLetter, 0, len(letters)),
+	}
+	for _, letter := range letters {
+		response.DeadLetters = append(response.DeadLetters, routes.PublicDeadLetter{
+			DeadLetterID: letter.ID,
+			RunID:        letter.RunID,
+			FailedAt:     letter.CreatedAt,
+			FailedStep:   letter.FailedStep,
+			Error:        letter.Error,
+			Attempts:     letter.Attempts,
+			TriggerData:  letter.TriggerData,
+			ReplayedAt:   letter.ReplayedAt,
+			ReplayRunID:  letter.ReplayRunID,
+		})
+	}
+	return &response, nil
+}
+
+func ReplayDeadLetter(c *gin.Context, in *routes.DeadLetterID) (*routes.WorkflowRunSummary, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	workflow, err := getAccessibleWorkflow(in.WorkflowID, user.ID, models.EditorRole)
+	if err != nil {
+		return nil, err
+	}
+
+	var letter models.DeadLetter
+	if rst := initializers.DB.
+		Where("id=? AND workflow_id=?", in.DeadLetterID, workflow.ID).
+		First(&letter); rst.Error != nil {
+		return nil, errors.NotFound
+	}
+
+	if letter.ReplayedAt != nil {
+		return nil, errors.NewAlreadyExists(nil, "The dead letter was already replayed.")
+	}
+	if letter.StepLabel == "" {
+		return nil, errors.NewBadRequest(nil, "The dead letter doesn't record its failed step.")
+	}
+
+	// Claiming the letter first keeps concurrent requests from replaying it
+	// twice.
+	now := time.Now()
+	claim := initializers.DB.
+		Model(&letter).
+		Where("replayed_at IS NULL").
+		Update("replayed_at", now)
+	if claim.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	if claim.RowsAffected == 0 {
+		return nil, errors.NewAlreadyExists(nil, "The dead letter was already replayed.")
+	}
+
+	ctx := workflowEngine.NewContext(*workflow)
+	run, err := workflowEngine.ReplayStep(ctx, letter.StepLabel, letter.RuntimeData)
+	if err != nil {
+		initializers.DB.Model(&letter).Update("replayed_at", nil)
+		return nil, errors.NewBadRequest(err, err.Error())
+	}
+
+	if rst := initializers.DB.Model(&letter).Update("replay_run_id", run.ID); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	return &routes.WorkflowRunSummary{
+		RunID:       run.ID,
+		Mode:        run.Mode,
+		TriggeredAt: run.TriggeredAt,
+		FinishedAt:  run.FinishedAt,
+		Status:      run.Status,
+		Error:       run.Error,
+	}, nil
+}
@@ -4,12 +4,27 @@ import (
 	"dawpitech/area/initializers"
 	"dawpitech/area/models"
 	"dawpitech/area/models/routes"
+	"dawpitech/area/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/juju/errors"
 	"sort"
 )
 
-func GetAllLogsByWorkflow(_ *gin.Context, in *routes.WorkflowID) (*routes.GetAllLogsByWorkflowResponse, error) {
+func GetAllLogsByWorkflow(c *gin.Context, in *routes.WorkflowID) (*routes.GetAllLogsByWorkflowResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	if _, err := getAccessibleWorkflow(in.WorkflowID, user.ID, models.ViewerRole); err != nil {
+		return nil, err
+	}
+
 	var logs []models.LogEntry
 	if rst := initializers.DB.Where("workflow_id=?", in.WorkflowID).Find(&logs); rst.Error != nil {
 		return nil, errors.New("Internal server error.")
@@ -17,6 +32,7 @@ func GetAllLogsByWorkflow(_ *gin.Context, in *routes.WorkflowID) (*routes.GetAll
 	var response routes.GetAllLogsByWorkflowResponse
 	for i := 0; i < len(logs); i++ {
 		response.Logs = append(response.Logs, models.PublicLogEntry{
+			RunID:     logs[i].RunID,
 			Timestamp: logs[i].Timestamp,
 			Type:      logs[i].Type,
 			Message:   logs[i].Message,
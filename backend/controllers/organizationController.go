@@ -0,0 +1,366 @@
+package controllers
+
+import (
+	"dawpitech/area/engines/organizationEngine"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"dawpitech/area/models/routes"
+	"dawpitech/area/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"gorm.io/gorm"
+	"log"
+)
+
+func newPublicOrganization(organization models.Organization, role models.OrgRole) routes.PublicOrganization {
+	return routes.PublicOrganization{
+		OrganizationID: organization.ID,
+		Name:           organization.Name,
+		ServiceUserID:  organization.ServiceUserID,
+		Role:           role,
+	}
+}
+
+// countOwners is used to refuse changes leaving an organization without
+// owner.
+func countOwners(organizationID uint) (int64, error) {
+	var count int64
+	rst := initializers.DB.
+		Model(&models.OrganizationMember{}).
+		Where("organization_id=? AND role=?", organizationID, models.OwnerRole).
+		Count(&count)
+	return count, rst.Error
+}
+
+func CreateOrganization(c *gin.Context, in *routes.CreateOrganizationRequest) (*routes.PublicOrganization, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	var organization models.Organization
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		// The service user has no login method, it only owns the provider
+		// connections of the organization.
+		serviceUser := models.User{
+			Username: in.Name + " service account",
+		}
+		if rst := tx.Omit("Auth").Create(&serviceUser); rst.Error != nil {
+			return rst.Error
+		}
+
+		organization = models.Organization{
+			Name:          in.Name,
+			ServiceUserID: serviceUser.ID,
+		}
+		if rst := tx.Create(&organization); rst.Error != nil {
+			return rst.Error
+		}
+
+		return tx.Create(&models.OrganizationMember{
+			OrganizationID: organization.ID,
+			UserID:         user.ID,
+			Role:           models.OwnerRole,
+		}).Error
+	})
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	response := newPublicOrganization(organization, models.OwnerRole)
+	return &response, nil
+}
+
+func GetAllOrganizations(c *gin.Context) (*routes.GetAllOrganizationsResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	var members []models.OrganizationMember
+	if rst := initializers.DB.Where("user_id=?", user.ID).Find(&members); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	response := &routes.GetAllOrganizationsResponse{
+		Organizations: make([]routes.PublicOrganization, 0, len(members)),
+	}
+	for _, member := range members {
+		var organization models.Organization
+		if rst := initializers.DB.Where("id=?", member.OrganizationID).First(&organization); rst.Error != nil {
+			continue
+		}
+		response.Organizations = append(response.Organizations, newPublicOrganization(organization, member.Role))
+	}
+	return response, nil
+}
+
+func GetOrganization(c *gin.Context, in *routes.OrganizationID) (*routes.GetOrganizationResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	organization, err := organizationEngine.CheckRole(in.OrganizationID, user.ID, models.ViewerRole)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []models.OrganizationMember
+	if rst := initializers.DB.Where("organization_id=?", organization.ID).Order("id asc").Find(&members); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	response := &routes.GetOrganizationResponse{
+		Members: make([]routes.PublicMember, 0, len(members)),
+	}
+	for _, member := range members {
+		if member.UserID == user.ID {
+			response.Details = newPublicOrganization(*organization, member.Role)
+		}
+		var auth models.AuthMethods
+		initializers.DB.Where("user_id=?", member.UserID).First(&auth)
+		response.Members = append(response.Members, routes.PublicMember{
+			UserID: member.UserID,
+			Email:  auth.Email,
+			Role:   member.Role,
+		})
+	}
+	return response, nil
+}
+
+func EditOrganization(c *gin.Context, in *routes.EditOrganizationRequest) (*routes.PublicOrganization, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	organization, err := organizationEngine.CheckRole(in.OrganizationID, user.ID, models.OwnerRole)
+	if err != nil {
+		return nil, err
+	}
+
+	organization.Name = in.Name
+	if rst := initializers.DB.Model(organization).Update("name", in.Name); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	response := newPublicOrganization(*organization, models.OwnerRole)
+	return &response, nil
+}
+
+// DeleteOrganization removes the organization along with the provider
+// connections of its service user, its workflows must be deleted first.
+func DeleteOrganization(c *gin.Context, in *routes.OrganizationID) error {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return errors.BadRequest
+	}
+
+	organization, err := organizationEngine.CheckRole(in.OrganizationID, user.ID, models.OwnerRole)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	if rst := initializers.DB.
+		Model(&models.Workflow{}).
+		Where("organization_id=?", organization.ID).
+		Count(&count); rst.Error != nil {
+		return errors.New("Internal server error.")
+	}
+	if count > 0 {
+		return errors.NewBadRequest(nil, "The workflows of the organization must be deleted first.")
+	}
+
+	// The connections of the service account are revoked and deleted for
+	// good, after the triggers still using them released what they registered.
+	var workflows []models.Workflow
+	if rst := initializers.DB.
+		Where("run_as_user_id=?", organization.ServiceUserID).
+		Find(&workflows); rst.Error != nil {
+		return errors.New("Internal server error.")
+	}
+	if err := deleteConnections(organization.ServiceUserID, workflows); err != nil {
+		log.Print(err.Error())
+		return errors.New("Internal server error.")
+	}
+
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if rst := tx.Where("organization_id=?", organization.ID).Delete(&models.OrganizationMember{}); rst.Error != nil {
+			return rst.Error
+		}
+		if rst := tx.Where("id=?", organization.ServiceUserID).Delete(&models.User{}); rst.Error != nil {
+			return rst.Error
+		}
+		return tx.Delete(organization).Error
+	})
+	if err != nil {
+		return errors.New("Internal server error.")
+	}
+	return nil
+}
+
+func AddMember(c *gin.Context, in *routes.AddMemberRequest) (*routes.PublicMember, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	organization, err := organizationEngine.CheckRole(in.OrganizationID, user.ID, models.OwnerRole)
+	if err != nil {
+		return nil, err
+	}
+
+	var auth models.AuthMethods
+	if rst := initializers.DB.Where("email=?", in.Email).First(&auth); rst.Error != nil {
+		return nil, errors.NewNotFound(nil, "No user found with the given email.")
+	}
+
+	if _, member, err := organizationEngine.GetMemberRole(organization.ID, auth.UserID); err != nil {
+		return nil, errors.New("Internal server error.")
+	} else if member {
+		return nil, errors.NewAlreadyExists(nil, "The user is already a member of the organization.")
+	}
+
+	if rst := initializers.DB.Create(&models.OrganizationMember{
+		OrganizationID: organization.ID,
+		UserID:         auth.UserID,
+		Role:           in.Role,
+	}); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	return &routes.PublicMember{
+		UserID: auth.UserID,
+		Email:  auth.Email,
+		Role:   in.Role,
+	}, nil
+}
+
+func EditMember(c *gin.Context, in *routes.EditMemberRequest) (*routes.PublicMember, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	organization, err := organizationEngine.CheckRole(in.OrganizationID, user.ID, models.OwnerRole)
+	if err != nil {
+		return nil, err
+	}
+
+	var member models.OrganizationMember
+	if rst := initializers.DB.Where("organization_id=? AND user_id=?", organization.ID, in.UserID).First(&member); rst.Error != nil {
+		return nil, errors.NewNotFound(nil, "No member found with the given ID.")
+	}
+
+	if member.Role == models.OwnerRole && in.Role != models.OwnerRole {
+		owners, err := countOwners(organization.ID)
+		if err != nil {
+			return nil, errors.New("Internal server error.")
+		}
+		if owners <= 1 {
+			return nil, errors.NewBadRequest(nil, "An organization needs at least one owner.")
+		}
+	}
+
+	if rst := initializers.DB.Model(&member).Update("role", in.Role); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	var auth models.AuthMethods
+	initializers.DB.Where("user_id=?", member.UserID).First(&auth)
+	return &routes.PublicMember{
+		UserID: member.UserID,
+		Email:  auth.Email,
+		Role:   in.Role,
+	}, nil
+}
+
+// RemoveMember is allowed to the owners, and to any member leaving the
+// organization. The workflows running with the provider accounts of the
+// member switch to the organization's ones.
+func RemoveMember(c *gin.Context, in *routes.MemberID) error {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return errors.BadRequest
+	}
+
+	required := models.OwnerRole
+	if in.UserID == user.ID {
+		required = models.ViewerRole
+	}
+	organization, err := organizationEngine.CheckRole(in.OrganizationID, user.ID, required)
+	if err != nil {
+		return err
+	}
+
+	var member models.OrganizationMember
+	if rst := initializers.DB.Where("organization_id=? AND user_id=?", organization.ID, in.UserID).First(&member); rst.Error != nil {
+		return errors.NewNotFound(nil, "No member found with the given ID.")
+	}
+
+	if member.Role == models.OwnerRole {
+		owners, err := countOwners(organization.ID)
+		if err != nil {
+			return errors.New("Internal server error.")
+		}
+		if owners <= 1 {
+			return errors.NewBadRequest(nil, "An organization needs at least one owner.")
+		}
+	}
+
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if rst := tx.Unscoped().Delete(&member); rst.Error != nil {
+			return rst.Error
+		}
+		return tx.
+			Model(&models.Workflow{}).
+			Where("organization_id=? AND run_as_user_id=?", organization.ID, member.UserID).
+			Update("run_as_user_id", organization.ServiceUserID).Error
+	})
+	if err != nil {
+		return errors.New("Internal server error.")
+	}
+	return nil
+}
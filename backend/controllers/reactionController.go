@@ -29,10 +29,16 @@ func GetReactionInfo(_ *gin.Context, in *routes.RequestGetReactionInfo) (*routes
 		params[i] = parameter.ToPublic()
 	}
 
+	outputs := make([]models.PublicParameter, len(reaction.Outputs))
+	for i, output := range reaction.Outputs {
+		outputs[i] = output.ToPublic()
+	}
+
 	return &routes.ResponseGetReactionInfo{
 		Name:        reaction.Name,
 		PrettyName:  reaction.PrettyName,
 		Description: reaction.Description,
 		Parameters:  params,
+		Outputs:     outputs,
 	}, nil
 }
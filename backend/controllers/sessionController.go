@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	stdCrypto "crypto/rand"
+	"dawpitech/area/crypto"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"dawpitech/area/models/routes"
+	"dawpitech/area/utils"
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/juju/errors"
+	"gorm.io/gorm"
+	"log"
+	"os"
+	"time"
+)
+
+const accessTokenLifetime = 15 * time.Minute
+
+// sessionLifetime is how long a session stays usable without being refreshed.
+const sessionLifetime = 30 * 24 * time.Hour
+
+func signAccessToken(userID uint, sessionID uint) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":    userID,
+		"session_id": sessionID,
+		"exp":        time.Now().Add(accessTokenLifetime).Unix(),
+	})
+	return token.SignedString([]byte(os.Getenv("JWT_TOKENS_SECRET")))
+}
+
+// issueTokens returns a new access token and a new refresh token for the
+// session.
+func issueTokens(session models.Session) (*routes.AuthResponse, error) {
+	bytes := make([]byte, 32)
+	if _, err := stdCrypto.Read(bytes); err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(bytes)
+
+	if rst := initializers.DB.Create(&models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: crypto.HashToken(refreshToken),
+	}); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	accessToken, err := signAccessToken(session.UserID, session.ID)
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	return &routes.AuthResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenLifetime.Seconds()),
+	}, nil
+}
+
+// openSession signs the user in from the device making the request.
+func openSession(c *gin.Context, user models.User) (*routes.AuthResponse, error) {
+	now := time.Now()
+	session := models.Session{
+		UserID:     user.ID,
+		UserAgent:  c.Request.UserAgent(),
+		IPAddress:  c.ClientIP(),
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(sessionLifetime),
+	}
+	if rst := initializers.DB.Create(&session); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	return issueTokens(session)
+}
+
+func revokeSessions(query *gorm.DB) error {
+	return query.
+		Model(&models.Session{}).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now()).Error
+}
+
+func RefreshSession(_ *gin.Context, in *routes.RefreshRequest) (*routes.AuthResponse, error) {
+	var refreshToken models.RefreshToken
+	if rst := initializers.DB.Where("token_hash=?", crypto.HashToken(in.RefreshToken)).First(&refreshToken); rst.Error != nil {
+		if errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.NewUnauthorized(nil, "Invalid refresh token.")
+		}
+		return nil, errors.New("Internal server error.")
+	}
+
+	var session models.Session
+	if rst := initializers.DB.Where("id=?", refreshToken.SessionID).First(&session); rst.Error != nil {
+		return nil, errors.NewUnauthorized(nil, "Invalid refresh token.")
+	}
+	if !session.IsActive() {
+		return nil, errors.NewUnauthorized(nil, "The session expired or was revoked.")
+	}
+
+	now := time.Now()
+	rst := initializers.DB.
+		Model(&models.RefreshToken{}).
+		Where("id=? AND used_at IS NULL", refreshToken.ID).
+		Update("used_at", now)
+	if rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	// The token was already exchanged, either the client or an attacker holds
+	// a stolen copy so the whole session goes.
+	if rst.RowsAffected == 0 {
+		log.Printf("Refresh token reused on session #%d, revoking it.\n", session.ID)
+		if err := revokeSessions(initializers.DB.Where("id=?", session.ID)); err != nil {
+			return nil, errors.New("Internal server error.")
+		}
+		return nil, errors.NewUnauthorized(nil, "Refresh token already used, the session was revoked.")
+	}
+
+	session.LastUsedAt = now
+	session.ExpiresAt = now.Add(sessionLifetime)
+	if rst := initializers.DB.Model(&session).Select("last_used_at", "expires_at").Updates(&session); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	return issueTokens(session)
+}
+
+func LogoutUser(c *gin.Context) error {
+	session, ok := utils.MaybeGetSession(c)
+	if !ok {
+		return errors.BadRequest
+	}
+
+	if err := revokeSessions(initializers.DB.Where("id=?", session.ID)); err != nil {
+		return errors.New("Internal server error.")
+	}
+	return nil
+}
+
+func GetAllSessions(c *gin.Context) (*routes.GetAllSessionsResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	current, _ := utils.MaybeGetSession(c)
+
+	var sessions []models.Session
+	if rst := initializers.DB.
+		Where("user_id=? AND revoked_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+		Order("last_used_at desc").
+		Find(&sessions); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	response := &routes.GetAllSessionsResponse{
+		Sessions: make([]routes.PublicSession, len(sessions)),
+	}
+	for i, session := range sessions {
+		response.Sessions[i] = routes.PublicSession{
+			SessionID:  session.ID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    current != nil && current.ID == session.ID,
+		}
+	}
+	return response, nil
+}
+
+func RevokeSession(c *gin.Context, in *routes.SessionID) error {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return errors.BadRequest
+	}
+
+	var session models.Session
+	if rst := initializers.DB.Where("id=? AND user_id=?", in.SessionID, user.ID).First(&session); rst.Error != nil {
+		return errors.NewNotFound(nil, "No session found with the given ID.")
+	}
+
+	if err := revokeSessions(initializers.DB.Where("id=?", session.ID)); err != nil {
+		return errors.New("Internal server error.")
+	}
+	return nil
+}
+
+// RevokeAllSessions signs the user out of every device, including this one.
+func RevokeAllSessions(c *gin.Context) error {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return errors.BadRequest
+	}
+
+	if err := revokeSessions(initializers.DB.Where("user_id=?", user.ID)); err != nil {
+		return errors.New("Internal server error.")
+	}
+	return nil
+}
@@ -0,0 +1,446 @@
+package controllers
+
+import (
+	"context"
+	"dawpitech/area/crypto"
+	"dawpitech/area/engines/auditEngine"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"dawpitech/area/models/routes"
+	"dawpitech/area/services"
+	"dawpitech/area/utils"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/juju/errors"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// socialStateLifetime is how long the user has to go through the provider's
+// consent screen.
+const socialStateLifetime = 10 * time.Minute
+
+const socialStatePurpose = "social_login"
+
+// socialNonceCookie holds the nonce the state is bound to, a state sent by
+// another browser is refused.
+const socialNonceCookie = "area_social_nonce"
+
+type socialState struct {
+	Provider string
+	Platform string
+	// LinkUserID is set when a signed-in user links a new login method.
+	LinkUserID uint
+	// NonceHash is the hash of the nonce of the browser's cookie.
+	NonceHash string
+}
+
+func getLoginMethod(provider string) (*models.LoginMethod, bool) {
+	for _, service := range services.Services {
+		if service.LoginMethod != nil && strings.ToLower(service.Name) == provider {
+			return service.LoginMethod, true
+		}
+	}
+	return nil, false
+}
+
+// signSocialState returns the OAuth state, it is signed rather than kept in
+// memory so the callback can reach any instance.
+func signSocialState(state socialState) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"purpose":      socialStatePurpose,
+		"provider":     state.Provider,
+		"platform":     state.Platform,
+		"link_user_id": state.LinkUserID,
+		"nonce_hash":   state.NonceHash,
+		"exp":          time.Now().Add(socialStateLifetime).Unix(),
+	})
+	return token.SignedString([]byte(os.Getenv("JWT_TOKENS_SECRET")))
+}
+
+func parseSocialState(tokenString string) (*socialState, bool) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(os.Getenv("JWT_TOKENS_SECRET")), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != socialStatePurpose {
+		return nil, false
+	}
+	provider, providerOK := claims["provider"].(string)
+	platform, platformOK := claims["platform"].(string)
+	linkUserID, linkOK := claims["link_user_id"].(float64)
+	nonceHash, nonceOK := claims["nonce_hash"].(string)
+	if !providerOK || !platformOK || !linkOK || !nonceOK {
+		return nil, false
+	}
+	return &socialState{
+		Provider:   provider,
+		Platform:   platform,
+		LinkUserID: uint(linkUserID),
+		NonceHash:  nonceHash,
+	}, true
+}
+
+func setSocialNonceCookie(c *gin.Context, nonce string, maxAge int) {
+	// SameSite None, the web client starts the login from another origin.
+	c.SetSameSite(http.SameSiteNoneMode)
+	c.SetCookie(socialNonceCookie, nonce, maxAge, "/auth/social", "", true, true)
+}
+
+// checkSocialNonce tells if the browser holds the nonce of the state, the
+// nonce is used up so the state can't be replayed.
+func checkSocialNonce(c *gin.Context, state *socialState) bool {
+	nonce, err := c.Cookie(socialNonceCookie)
+	if err != nil || crypto.HashToken(nonce) != state.NonceHash {
+		return false
+	}
+	setSocialNonceCookie(c, "", -1)
+
+	oneTimeToken, err := consumeOneTimeToken(nonce, models.SocialLoginStatePurpose)
+	return err == nil && oneTimeToken.UserID == state.LinkUserID
+}
+
+func startSocialLogin(c *gin.Context, in *routes.SocialLoginInitRequest, linkUserID uint) (*routes.SocialLoginInitResponse, error) {
+	method, ok := getLoginMethod(in.Provider)
+	if !ok {
+		return nil, errors.NewNotFound(nil, "No login method found with the given provider.")
+	}
+
+	// Not issued with issueOneTimeToken, the nonces of the anonymous logins
+	// would revoke each other.
+	nonce, err := createOneTimeToken(initializers.DB, linkUserID, models.SocialLoginStatePurpose, socialStateLifetime)
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	state, err := signSocialState(socialState{
+		Provider:   in.Provider,
+		Platform:   in.Platform,
+		LinkUserID: linkUserID,
+		NonceHash:  crypto.HashToken(nonce),
+	})
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	setSocialNonceCookie(c, nonce, int(socialStateLifetime.Seconds()))
+
+	return &routes.SocialLoginInitResponse{
+		RedirectTo: method.OAuthConfig.AuthCodeURL(state),
+	}, nil
+}
+
+func InitSocialLogin(c *gin.Context, in *routes.SocialLoginInitRequest) (*routes.SocialLoginInitResponse, error) {
+	return startSocialLogin(c, in, 0)
+}
+
+// InitSocialLink adds the provider account as a login method of the
+// signed-in user.
+func InitSocialLink(c *gin.Context, in *routes.SocialLoginInitRequest) (*routes.SocialLoginInitResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	return startSocialLogin(c, in, user.ID)
+}
+
+// redirectToClient sends the result of the callback back to the client, in
+// the fragment so that the tokens don't end up in any server log.
+func redirectToClient(c *gin.Context, platform string, values url.Values) {
+	var redirectUrl string
+	if platform == "mobile" {
+		redirectUrl = os.Getenv("LOGIN_CALLBACK_URI_MOBILE")
+	} else {
+		redirectUrl = os.Getenv("LOGIN_CALLBACK_URL_WEB")
+	}
+	c.Redirect(http.StatusTemporaryRedirect, redirectUrl+"#"+values.Encode())
+}
+
+func redirectError(c *gin.Context, platform string, message string) {
+	redirectToClient(c, platform, url.Values{
+		"error": {message},
+	})
+}
+
+// linkIdentity adds the identity to the given user, an identity can only be
+// linked to one user.
+func linkIdentity(provider string, identity *models.ProviderIdentity, userID uint) error {
+	auth, err := getAuthMethods(userID)
+	if err != nil {
+		return errors.New("Internal server error.")
+	}
+
+	var existing models.ExternalIdentity
+	rst := initializers.DB.Where("provider=? AND subject=?", provider, identity.Subject).First(&existing)
+	if rst.Error == nil {
+		if existing.AuthMethodsID != auth.ID {
+			return errors.NewAlreadyExists(nil, "This account is already linked to another user.")
+		}
+		return nil
+	}
+	if !errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+		return errors.New("Internal server error.")
+	}
+
+	if rst := initializers.DB.Create(&models.ExternalIdentity{
+		AuthMethodsID: auth.ID,
+		Provider:      provider,
+		Subject:       identity.Subject,
+		Email:         identity.Email,
+	}); rst.Error != nil {
+		return errors.New("Internal server error.")
+	}
+	return nil
+}
+
+// resolveIdentityUser returns the user signing-in with the identity. An
+// unknown identity is linked to the account using the same email only when
+// both the provider and us verified the address, otherwise anyone could
+// sign-up with someone else's address and wait for them to use the provider.
+func resolveIdentityUser(provider string, identity *models.ProviderIdentity) (*models.User, error) {
+	var existing models.ExternalIdentity
+	rst := initializers.DB.Where("provider=? AND subject=?", provider, identity.Subject).First(&existing)
+	if rst.Error != nil && !errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+		return nil, errors.New("Internal server error.")
+	}
+
+	var auth models.AuthMethods
+	if rst.Error == nil {
+		if rst := initializers.DB.Where("id=?", existing.AuthMethodsID).First(&auth); rst.Error != nil {
+			return nil, errors.New("Internal server error.")
+		}
+	} else {
+		if identity.Email == "" || !identity.EmailVerified {
+			return nil, errors.NewForbidden(nil, "The provider account needs a verified email address.")
+		}
+
+		rst = initializers.DB.Where("email=?", identity.Email).First(&auth)
+		if rst.Error != nil && !errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("Internal server error.")
+		}
+
+		if errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+			now := time.Now()
+			user := models.User{
+				Username: "placeholder",
+				Auth: models.AuthMethods{
+					Email:           identity.Email,
+					EmailVerifiedAt: &now,
+					Identities: []models.ExternalIdentity{
+						{
+							Provider: provider,
+							Subject:  identity.Subject,
+							Email:    identity.Email,
+						},
+					},
+				},
+			}
+			if rst := initializers.DB.Create(&user); rst.Error != nil {
+				return nil, errors.New("Internal server error.")
+			}
+			return &user, nil
+		}
+
+		if auth.EmailVerifiedAt == nil {
+			return nil, errors.NewForbidden(nil, "An account already uses this email, sign-in with its password to link the provider.")
+		}
+		if err := linkIdentity(provider, identity, auth.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	var user models.User
+	if rst := initializers.DB.Where("id=?", auth.UserID).First(&user); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	user.Auth = auth
+	return &user, nil
+}
+
+// SocialLoginCallback ends both the sign-in and the linking, the client gets
+// the usual tokens, or a 2FA challenge, in the fragment of the redirection.
+func SocialLoginCallback(c *gin.Context, in *routes.SocialLoginCallbackRequest) error {
+	state, ok := parseSocialState(in.State)
+	if !ok || state.Provider != in.Provider || !checkSocialNonce(c, state) {
+		return errors.NewBadRequest(nil, "Invalid or expired state.")
+	}
+
+	method, ok := getLoginMethod(state.Provider)
+	if !ok {
+		return errors.NewNotFound(nil, "No login method found with the given provider.")
+	}
+
+	if in.Error != "" || in.Code == "" {
+		redirectError(c, state.Platform, "The provider denied the access.")
+		return nil
+	}
+
+	token, err := method.OAuthConfig.Exchange(context.Background(), in.Code)
+	if err != nil {
+		log.Print(err.Error())
+		redirectError(c, state.Platform, "The provider denied the access.")
+		return nil
+	}
+
+	identity, err := method.FetchIdentity(method.OAuthConfig.Client(context.Background(), token))
+	if err != nil {
+		log.Print(err.Error())
+		redirectError(c, state.Platform, "Couldn't retrieve the provider account.")
+		return nil
+	}
+
+	if state.LinkUserID != 0 {
+		if err := linkIdentity(state.Provider, identity, state.LinkUserID); err != nil {
+			redirectError(c, state.Platform, err.Error())
+			return nil
+		}
+		auditEngine.RecordRequest(c, models.AuditEntry{
+			ActorUserID: state.LinkUserID,
+			Action:      models.IdentityLinkAction,
+			TargetType:  models.UserTarget,
+			TargetID:    state.LinkUserID,
+			Details: map[string]string{
+				"provider": state.Provider,
+				"email":    identity.Email,
+			},
+		})
+		redirectToClient(c, state.Platform, url.Values{
+			"linked": {state.Provider},
+		})
+		return nil
+	}
+
+	user, err := resolveIdentityUser(state.Provider, identity)
+	if err != nil {
+		recordSignIn(c, 0, state.Provider, "identity_refused", identity.Email)
+		redirectError(c, state.Platform, err.Error())
+		return nil
+	}
+	if user.DisabledAt != nil {
+		recordSignIn(c, user.ID, state.Provider, "account_disabled", identity.Email)
+		redirectError(c, state.Platform, "This account is disabled.")
+		return nil
+	}
+
+	if user.Auth.TOTPEnabled {
+		challengeToken, err := signChallengeToken(user.ID)
+		if err != nil {
+			redirectError(c, state.Platform, "Internal server error.")
+			return nil
+		}
+		redirectToClient(c, state.Platform, url.Values{
+			"two_factor_required": {"true"},
+			"challenge_token":     {challengeToken},
+		})
+		return nil
+	}
+
+	recordSignIn(c, user.ID, state.Provider, "", identity.Email)
+	response, err := openSession(c, *user)
+	if err != nil {
+		redirectError(c, state.Platform, err.Error())
+		return nil
+	}
+	redirectToClient(c, state.Platform, url.Values{
+		"token":         {response.Token},
+		"refresh_token": {response.RefreshToken},
+		"expires_in":    {fmt.Sprint(response.ExpiresIn)},
+	})
+	return nil
+}
+
+func GetAllIdentities(c *gin.Context) (*routes.GetAllIdentitiesResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	var auth models.AuthMethods
+	if rst := initializers.DB.Preload("Identities").Where("user_id=?", user.ID).First(&auth); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	response := &routes.GetAllIdentitiesResponse{
+		HasPassword: auth.PasswordHash != "",
+		Identities:  make([]routes.PublicIdentity, len(auth.Identities)),
+	}
+	for i, identity := range auth.Identities {
+		response.Identities[i] = routes.PublicIdentity{
+			IdentityID: identity.ID,
+			Provider:   identity.Provider,
+			Email:      identity.Email,
+			CreatedAt:  identity.CreatedAt,
+		}
+	}
+	return response, nil
+}
+
+// UnlinkIdentity removes a login method, the last one can't be removed.
+func UnlinkIdentity(c *gin.Context, in *routes.IdentityID) error {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return errors.BadRequest
+	}
+
+	var auth models.AuthMethods
+	if rst := initializers.DB.Preload("Identities").Where("user_id=?", user.ID).First(&auth); rst.Error != nil {
+		return errors.New("Internal server error.")
+	}
+
+	provider := ""
+	for _, identity := range auth.Identities {
+		if identity.ID == in.IdentityID {
+			provider = identity.Provider
+		}
+	}
+	if provider == "" {
+		return errors.NewNotFound(nil, "No identity found with the given ID.")
+	}
+	if auth.PasswordHash == "" && len(auth.Identities) == 1 {
+		return errors.NewBadRequest(nil, "The last login method can't be removed, set a password first.")
+	}
+
+	// Deleted for good so the identity can be linked again later.
+	if rst := initializers.DB.Unscoped().Where("id=?", in.IdentityID).Delete(&models.ExternalIdentity{}); rst.Error != nil {
+		return errors.New("Internal server error.")
+	}
+
+	auditEngine.RecordRequest(c, models.AuditEntry{
+		Action:     models.IdentityUnlinkAction,
+		TargetType: models.UserTarget,
+		TargetID:   user.ID,
+		Details: map[string]string{
+			"provider": provider,
+		},
+	})
+	return nil
+}
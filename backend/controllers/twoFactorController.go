@@ -0,0 +1,364 @@
+package controllers
+
+import (
+	stdCrypto "crypto/rand"
+	"dawpitech/area/crypto"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"dawpitech/area/models/routes"
+	"dawpitech/area/utils"
+	"encoding/base32"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/juju/errors"
+	"gorm.io/gorm"
+	"os"
+	"strings"
+	"time"
+)
+
+const totpIssuer = "AREA"
+
+// challengeTokenLifetime is how long the user has to enter their code once
+// their password was accepted.
+const challengeTokenLifetime = 5 * time.Minute
+
+const challengePurpose = "2fa_challenge"
+
+// maxChallengeAttempts is how many codes can be tried with a challenge token
+// before the password has to be sent again.
+const maxChallengeAttempts = 5
+
+const recoveryCodesCount = 10
+
+// signChallengeToken returns the token proving the password step passed, it
+// has no session so the auth middleware refuses it. The token is bound to a
+// stored nonce so it can only sign-in once.
+func signChallengeToken(userID uint) (string, error) {
+	nonce, err := issueOneTimeToken(userID, models.TwoFactorChallengePurpose, challengeTokenLifetime)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"purpose": challengePurpose,
+		"nonce":   nonce,
+		"exp":     time.Now().Add(challengeTokenLifetime).Unix(),
+	})
+	return token.SignedString([]byte(os.Getenv("JWT_TOKENS_SECRET")))
+}
+
+func parseChallengeToken(tokenString string) (uint, string, bool) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(os.Getenv("JWT_TOKENS_SECRET")), nil
+	})
+	if err != nil || !token.Valid {
+		return 0, "", false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != challengePurpose {
+		return 0, "", false
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, "", false
+	}
+	nonce, ok := claims["nonce"].(string)
+	if !ok || nonce == "" {
+		return 0, "", false
+	}
+	return uint(userID), nonce, true
+}
+
+// useChallengeAttempt counts a code sent with the challenge, it fails once
+// the challenge was used, expired or got too many codes.
+func useChallengeAttempt(userID uint, nonce string) (bool, error) {
+	rst := initializers.DB.
+		Model(&models.OneTimeToken{}).
+		Where("user_id=? AND token_hash=? AND purpose=? AND used_at IS NULL AND expires_at > ? AND attempts < ?",
+			userID, crypto.HashToken(nonce), models.TwoFactorChallengePurpose, time.Now(), maxChallengeAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if rst.Error != nil {
+		return false, rst.Error
+	}
+	return rst.RowsAffected == 1, nil
+}
+
+// consumeChallenge marks the challenge as used once its code was accepted,
+// the update is conditional so it can't open two sessions.
+func consumeChallenge(userID uint, nonce string) (bool, error) {
+	rst := initializers.DB.
+		Model(&models.OneTimeToken{}).
+		Where("user_id=? AND token_hash=? AND purpose=? AND used_at IS NULL",
+			userID, crypto.HashToken(nonce), models.TwoFactorChallengePurpose).
+		Update("used_at", time.Now())
+	if rst.Error != nil {
+		return false, rst.Error
+	}
+	return rst.RowsAffected == 1, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	return strings.ToLower(code)
+}
+
+// generateRecoveryCodes replaces the recovery codes of the user, the codes
+// are returned in clear only here.
+func generateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if rst := tx.Unscoped().Where("user_id=?", userID).Delete(&models.RecoveryCode{}); rst.Error != nil {
+		return nil, rst.Error
+	}
+
+	codes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		bytes := make([]byte, 5)
+		if _, err := stdCrypto.Read(bytes); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(bytes))
+		codes[i] = code[:4] + "-" + code[4:]
+
+		if rst := tx.Create(&models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: crypto.HashToken(normalizeRecoveryCode(code)),
+		}); rst.Error != nil {
+			return nil, rst.Error
+		}
+	}
+	return codes, nil
+}
+
+// checkTOTPCode accepts a TOTP code once, the matched time step is saved
+// with a conditional update so concurrent requests can't both use it.
+func checkTOTPCode(auth models.AuthMethods, code string) (bool, error) {
+	step, ok := crypto.ValidateTOTP(auth.TOTPSecret, code, auth.TOTPLastStep, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	rst := initializers.DB.
+		Model(&models.AuthMethods{}).
+		Where("id=? AND totp_last_step < ?", auth.ID, step).
+		Update("totp_last_step", step)
+	if rst.Error != nil {
+		return false, rst.Error
+	}
+	return rst.RowsAffected == 1, nil
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code.
+func checkSecondFactor(auth models.AuthMethods, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if ok, err := checkTOTPCode(auth, code); ok || err != nil {
+		return ok, err
+	}
+
+	rst := initializers.DB.
+		Model(&models.RecoveryCode{}).
+		Where("user_id=? AND code_hash=? AND used_at IS NULL", auth.UserID, crypto.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if rst.Error != nil {
+		return false, rst.Error
+	}
+	return rst.RowsAffected == 1, nil
+}
+
+func getAuthMethods(userID uint) (*models.AuthMethods, error) {
+	var auth models.AuthMethods
+	if rst := initializers.DB.Where("user_id=?", userID).First(&auth); rst.Error != nil {
+		return nil, rst.Error
+	}
+	return &auth, nil
+}
+
+// SignInTwoFactor is the second step of the sign-in of the users who enabled
+// 2FA.
+func SignInTwoFactor(c *gin.Context, in *routes.TwoFactorSignInRequest) (*routes.AuthResponse, error) {
+	userID, nonce, ok := parseChallengeToken(in.ChallengeToken)
+	if !ok {
+		return nil, errors.NewUnauthorized(nil, "Invalid or expired challenge token.")
+	}
+
+	var user models.User
+	if rst := initializers.DB.Where("id=?", userID).First(&user); rst.Error != nil {
+		return nil, errors.NewUnauthorized(nil, "Invalid or expired challenge token.")
+	}
+	if user.DisabledAt != nil {
+		recordSignIn(c, user.ID, "totp", "account_disabled", "")
+		return nil, errors.NewForbidden(nil, "This account is disabled.")
+	}
+	auth, err := getAuthMethods(user.ID)
+	if err != nil || !auth.TOTPEnabled {
+		return nil, errors.NewUnauthorized(nil, "Invalid or expired challenge token.")
+	}
+
+	available, err := useChallengeAttempt(user.ID, nonce)
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	if !available {
+		return nil, errors.NewUnauthorized(nil, "Invalid or expired challenge token.")
+	}
+
+	match, err := checkSecondFactor(*auth, in.Code)
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	if !match {
+		recordSignIn(c, user.ID, "totp", "invalid_code", "")
+		return nil, errors.NewForbidden(nil, "Invalid code.")
+	}
+
+	consumed, err := consumeChallenge(user.ID, nonce)
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	if !consumed {
+		return nil, errors.NewUnauthorized(nil, "Invalid or expired challenge token.")
+	}
+
+	recordSignIn(c, user.ID, "totp", "", "")
+	return openSession(c, user)
+}
+
+// SetupTwoFactor starts the enrollment, a new secret is generated each time
+// until it is confirmed with VerifyTwoFactor.
+func SetupTwoFactor(c *gin.Context) (*routes.TwoFactorSetupResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	auth, err := getAuthMethods(user.ID)
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	if auth.TOTPEnabled {
+		return nil, errors.NewAlreadyExists(nil, "Two-factor authentication is already enabled.")
+	}
+
+	secret, err := crypto.GenerateTOTPSecret()
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	auth.TOTPSecret = secret
+	auth.TOTPLastStep = 0
+	if rst := initializers.DB.Model(auth).Select("totp_secret", "totp_last_step").Updates(auth); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	return &routes.TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: crypto.TOTPProvisioningURI(totpIssuer, auth.Email, secret),
+	}, nil
+}
+
+// VerifyTwoFactor enables 2FA once the user sent a code generated from the
+// secret given by SetupTwoFactor.
+func VerifyTwoFactor(c *gin.Context, in *routes.TwoFactorVerifyRequest) (*routes.TwoFactorVerifyResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	auth, err := getAuthMethods(user.ID)
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	if auth.TOTPEnabled {
+		return nil, errors.NewAlreadyExists(nil, "Two-factor authentication is already enabled.")
+	}
+	if auth.TOTPSecret == "" {
+		return nil, errors.NewBadRequest(nil, "Two-factor authentication setup wasn't started.")
+	}
+
+	match, err := checkTOTPCode(*auth, strings.TrimSpace(in.Code))
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	if !match {
+		return nil, errors.NewForbidden(nil, "Invalid code.")
+	}
+
+	var codes []string
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if rst := tx.Model(auth).Update("totp_enabled", true); rst.Error != nil {
+			return rst.Error
+		}
+		codes, err = generateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	return &routes.TwoFactorVerifyResponse{
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// DisableTwoFactor needs the password and a code again, a stolen session
+// alone can't remove the second factor.
+func DisableTwoFactor(c *gin.Context, in *routes.TwoFactorDisableRequest) error {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return errors.BadRequest
+	}
+
+	auth, err := getAuthMethods(user.ID)
+	if err != nil {
+		return errors.New("Internal server error.")
+	}
+	if !auth.TOTPEnabled {
+		return errors.NewBadRequest(nil, "Two-factor authentication is not enabled.")
+	}
+
+	match, err := checkPassword(*auth, in.Password)
+	if err != nil {
+		return errors.New("Internal server error.")
+	}
+	if !match {
+		return errors.NewForbidden(nil, "Invalid password or code.")
+	}
+
+	match, err = checkSecondFactor(*auth, in.Code)
+	if err != nil {
+		return errors.New("Internal server error.")
+	}
+	if !match {
+		return errors.NewForbidden(nil, "Invalid password or code.")
+	}
+
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if rst := tx.Model(auth).Select("totp_secret", "totp_enabled", "totp_last_step").Updates(models.AuthMethods{}); rst.Error != nil {
+			return rst.Error
+		}
+		return tx.Unscoped().Where("user_id=?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return errors.New("Internal server error.")
+	}
+	return nil
+}
@@ -10,14 +10,6 @@ import (
 	"log"
 )
 
-func GetAllUsers(_ *gin.Context) (*[]models.User, error) {
-	var users []models.User
-	if rst := initializers.DB.Find(&users); rst.Error != nil {
-		return nil, errors.New("Internal server error")
-	}
-	return &users, nil
-}
-
 func CreateNewUser(_ *gin.Context, in *routes.UserCreationRequest) (*routes.UserCreationResponse, error) {
 	var count int64
 	if rst := initializers.DB.
@@ -49,6 +41,12 @@ func CreateNewUser(_ *gin.Context, in *routes.UserCreationRequest) (*routes.User
 		return nil, errors.New("Internal server error")
 	}
 
+	// The account is usable right away, a failed mail can be sent again
+	// later by the user.
+	if err := sendVerificationEmail(user.ID, in.Email); err != nil {
+		log.Print(err.Error())
+	}
+
 	return &routes.UserCreationResponse{
 		Status: "ok",
 	}, nil
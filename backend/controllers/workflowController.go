@@ -1,10 +1,13 @@
 package controllers
 
 import (
+	"dawpitech/area/engines/auditEngine"
+	"dawpitech/area/engines/organizationEngine"
 	"dawpitech/area/engines/workflowEngine"
 	"dawpitech/area/initializers"
 	"dawpitech/area/models"
 	"dawpitech/area/models/routes"
+	"dawpitech/area/services"
 	"dawpitech/area/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/juju/errors"
@@ -12,6 +15,115 @@ import (
 	"strconv"
 )
 
+func newWorkflowResponse(workflow models.Workflow) *routes.GetWorkflowResponse {
+	workflow = workflowEngine.UnsealSensitiveParameters(workflow)
+	response := &routes.GetWorkflowResponse{
+		WorkflowID:          workflow.ID,
+		Name:                workflow.Name,
+		ActionName:          workflow.ActionName,
+		ActionParameters:    workflow.ActionParameters,
+		ActionConnectionID:  workflow.ActionConnectionID,
+		Steps:               workflow.Steps,
+		RetryPolicy:         workflow.RetryPolicy,
+		CatchUp:             workflow.CatchUp,
+		PollIntervalSeconds: workflow.PollIntervalSeconds,
+		OrganizationID:      workflow.OrganizationID,
+		RunAsUserID:         workflow.CredentialsUserID(),
+		Active:              workflow.Active,
+	}
+	if modifier, ok := workflow.FirstStepOfType(models.ModifierStep); ok {
+		response.ModifierName = modifier.Name
+		response.ModifierParameters = modifier.Parameters
+	}
+	if reaction, ok := workflow.FirstStepOfType(models.ReactionStep); ok {
+		response.ReactionName = reaction.Name
+		response.ReactionParameters = reaction.Parameters
+	}
+	return response
+}
+
+// auditedWorkflow is the part of a workflow compared in the audit log, the
+// sensitive parameters are masked so their changes don't show.
+func auditedWorkflow(workflow models.Workflow) map[string]interface{} {
+	workflow = workflowEngine.MaskSensitiveParameters(workflow)
+	return map[string]interface{}{
+		"name":                  workflow.Name,
+		"action_name":           workflow.ActionName,
+		"action_parameters":     workflow.ActionParameters,
+		"action_connection_id":  workflow.ActionConnectionID,
+		"steps":                 workflow.Steps,
+		"retry_policy":          workflow.RetryPolicy,
+		"catch_up":              workflow.CatchUp,
+		"poll_interval_seconds": workflow.PollIntervalSeconds,
+		"run_as_user_id":        workflow.CredentialsUserID(),
+		"active":                workflow.Active,
+	}
+}
+
+// requestedSteps returns the steps sent by the client, falling back on the
+// legacy single modifier / reaction fields when no steps were given.
+func requestedSteps(steps []models.WorkflowStep, modifierName string, modifierParams map[string]string, reactionName string, reactionParams map[string]string) []models.WorkflowStep {
+	if len(steps) > 0 {
+		return steps
+	}
+	return models.StepsFromLegacy(modifierName, modifierParams, reactionName, reactionParams)
+}
+
+// checkStepsConnections makes sure the provider accounts chosen by the steps
+// are linked by the user the workflow runs as.
+func checkStepsConnections(steps []models.WorkflowStep, userID uint) error {
+	for _, step := range steps {
+		if step.ConnectionID != 0 {
+			if err := services.CheckConnection(step.Name, step.ConnectionID, userID); err != nil {
+				return err
+			}
+		}
+		if err := checkStepsConnections(step.Then, userID); err != nil {
+			return err
+		}
+		if err := checkStepsConnections(step.Else, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getAccessibleWorkflow returns the workflow when the user has at least the
+// required role on it.
+func getAccessibleWorkflow(workflowID uint, userID uint, required models.OrgRole) (*models.Workflow, error) {
+	var workflow models.Workflow
+	if rst := initializers.DB.Where("id=?", workflowID).First(&workflow); rst.Error != nil {
+		return nil, errors.NotFound
+	}
+	if err := organizationEngine.CheckWorkflowAccess(workflow, userID, required); err != nil {
+		return nil, err
+	}
+	return &workflow, nil
+}
+
+// recordWorkflowEdit writes the changes of an edited workflow to the audit
+// log, along with its activation or deactivation.
+func recordWorkflowEdit(c *gin.Context, workflow models.Workflow, before map[string]interface{}, wasActive bool) {
+	auditEngine.RecordRequest(c, models.AuditEntry{
+		Action:     models.WorkflowEditAction,
+		TargetType: models.WorkflowTarget,
+		TargetID:   workflow.ID,
+		Changes:    auditEngine.Diff(before, auditedWorkflow(workflow)),
+	})
+	if workflow.Active == wasActive {
+		return
+	}
+	action := models.WorkflowDeactivateAction
+	if workflow.Active {
+		action = models.WorkflowActivateAction
+	}
+	auditEngine.RecordRequest(c, models.AuditEntry{
+		Action:     action,
+		TargetType: models.WorkflowTarget,
+		TargetID:   workflow.ID,
+	})
+}
+
 func GetAllWorkflows(c *gin.Context) (*[]routes.GetAllWorkflowResponse, error) {
 	maybeUser, ok := c.Get("user")
 	if !ok {
@@ -23,19 +135,24 @@ func GetAllWorkflows(c *gin.Context) (*[]routes.GetAllWorkflowResponse, error) {
 		return nil, errors.BadRequest
 	}
 
+	memberships := initializers.DB.
+		Model(&models.OrganizationMember{}).
+		Select("organization_id").
+		Where("user_id=?", user.ID)
+
 	var workflows []models.Workflow
-	if rst := initializers.DB.Find(&workflows); rst.Error != nil {
+	if rst := initializers.DB.
+		Where("(owner_user_id=? AND organization_id IS NULL) OR organization_id IN (?)", user.ID, memberships).
+		Find(&workflows); rst.Error != nil {
 		return nil, errors.New("Internal server error")
 	}
 	var response []routes.GetAllWorkflowResponse
 	for i := 0; i < len(workflows); i++ {
-		if workflows[i].OwnerUserID != user.ID {
-			continue
-		}
 		response = append(response, routes.GetAllWorkflowResponse{
-			WorkflowID: workflows[i].ID,
-			Name:       workflows[i].Name,
-			Active:     workflows[i].Active,
+			WorkflowID:     workflows[i].ID,
+			Name:           workflows[i].Name,
+			OrganizationID: workflows[i].OrganizationID,
+			Active:         workflows[i].Active,
 		})
 	}
 	return &response, nil
@@ -52,27 +169,14 @@ func GetWorkflow(c *gin.Context, in *routes.WorkflowID) (*routes.GetWorkflowResp
 		return nil, errors.BadRequest
 	}
 
-	var workflow models.Workflow
-	if rst := initializers.DB.Where("id=?", in.WorkflowID).First(&workflow); rst.Error != nil {
-		return nil, errors.NotFound
-	}
-	if workflow.OwnerUserID != user.ID {
-		return nil, errors.NotFound
+	workflow, err := getAccessibleWorkflow(in.WorkflowID, user.ID, models.ViewerRole)
+	if err != nil {
+		return nil, err
 	}
-	return &routes.GetWorkflowResponse{
-		WorkflowID:         workflow.ID,
-		Name:               workflow.Name,
-		ActionName:         workflow.ActionName,
-		ActionParameters:   workflow.ActionParameters,
-		ModifierName:       workflow.ModifierName,
-		ModifierParameters: workflow.ModifierParameters,
-		ReactionName:       workflow.ReactionName,
-		ReactionParameters: workflow.ReactionParameters,
-		Active:             workflow.Active,
-	}, nil
+	return newWorkflowResponse(*workflow), nil
 }
 
-func CreateNewWorkflow(c *gin.Context) (*routes.GetWorkflowResponse, error) {
+func CreateNewWorkflow(c *gin.Context, in *routes.CreateWorkflowRequest) (*routes.GetWorkflowResponse, error) {
 	maybeUser, ok := c.Get("user")
 	if !ok {
 		return nil, errors.BadRequest
@@ -83,43 +187,49 @@ func CreateNewWorkflow(c *gin.Context) (*routes.GetWorkflowResponse, error) {
 		return nil, errors.BadRequest
 	}
 
+	// The workflows of an organization use its provider connections unless
+	// a member picks their own.
+	runAsUserID := user.ID
+	if in.OrganizationID != nil {
+		organization, err := organizationEngine.CheckRole(*in.OrganizationID, user.ID, models.EditorRole)
+		if err != nil {
+			return nil, err
+		}
+		runAsUserID = organization.ServiceUserID
+	}
+
 	workflow := models.Workflow{
-		OwnerUserID:        user.ID,
-		Name:               "New Workflow",
-		ActionName:         "none_action",
-		ActionParameters:   nil,
-		ModifierName:       "none_modifier",
-		ModifierParameters: nil,
-		ReactionName:       "none_reaction",
-		ReactionParameters: nil,
-		Active:             false,
+		OwnerUserID:      user.ID,
+		OrganizationID:   in.OrganizationID,
+		RunAsUserID:      runAsUserID,
+		Name:             "New Workflow",
+		ActionName:       "none_action",
+		ActionParameters: nil,
+		Steps:            models.StepsFromLegacy("none_modifier", nil, "none_reaction", nil),
+		Active:           false,
 	}
 	if rst := initializers.DB.Create(&workflow); rst.Error != nil {
 		return nil, errors.New("Internal server error")
 	}
 	workflow.Name = workflow.Name + " " + strconv.Itoa(int(workflow.ID))
 	initializers.DB.Save(&workflow)
-	return &routes.GetWorkflowResponse{
-		WorkflowID:         workflow.ID,
-		Name:               workflow.Name,
-		ActionName:         workflow.ActionName,
-		ActionParameters:   workflow.ActionParameters,
-		ModifierName:       workflow.ModifierName,
-		ModifierParameters: workflow.ModifierParameters,
-		ReactionName:       workflow.ReactionName,
-		ReactionParameters: workflow.ReactionParameters,
-		Active:             workflow.Active,
-	}, nil
+
+	auditEngine.RecordRequest(c, models.AuditEntry{
+		Action:     models.WorkflowCreateAction,
+		TargetType: models.WorkflowTarget,
+		TargetID:   workflow.ID,
+		Changes:    auditEngine.Diff(nil, auditedWorkflow(workflow)),
+	})
+	return newWorkflowResponse(workflow), nil
 }
 
 func CheckWorkflow(_ *gin.Context, in *routes.CheckWorkflowRequest) (*routes.CheckWorkflowResponse, error) {
 	workflow := models.Workflow{
-		ActionName:         in.ActionName,
-		ActionParameters:   in.ActionParameters,
-		ModifierName:       in.ModifierName,
-		ModifierParameters: in.ModifierParameters,
-		ReactionName:       in.ReactionName,
-		ReactionParameters: in.ReactionParameters,
+		ActionName:          in.ActionName,
+		ActionParameters:    in.ActionParameters,
+		Steps:               requestedSteps(in.Steps, in.ModifierName, in.ModifierParameters, in.ReactionName, in.ReactionParameters),
+		RetryPolicy:         in.RetryPolicy,
+		PollIntervalSeconds: in.PollIntervalSeconds,
 	}
 
 	err, ok := workflowEngine.ValidateWorkflow(workflow)
@@ -152,8 +262,8 @@ func DeleteWorkflow(c *gin.Context, in *routes.WorkflowID) error {
 		return errors.New("No workflow found with the given ID.")
 	}
 
-	if workflow.OwnerUserID != user.ID {
-		return errors.Unauthorized
+	if err := organizationEngine.CheckWorkflowAccess(workflow, user.ID, models.EditorRole); err != nil {
+		return err
 	}
 
 	if workflow.Active {
@@ -164,6 +274,14 @@ func DeleteWorkflow(c *gin.Context, in *routes.WorkflowID) error {
 	}
 
 	initializers.DB.Delete(&workflow)
+	workflowEngine.ClearTriggerStates(workflow.ID)
+
+	auditEngine.RecordRequest(c, models.AuditEntry{
+		Action:     models.WorkflowDeleteAction,
+		TargetType: models.WorkflowTarget,
+		TargetID:   workflow.ID,
+		Changes:    auditEngine.Diff(auditedWorkflow(workflow), nil),
+	})
 	return nil
 }
 
@@ -183,8 +301,37 @@ func EditWorkflow(c *gin.Context, in *routes.EditWorkflowRequest) (*routes.GetWo
 		return nil, errors.New("No workflow found with the given ID.")
 	}
 
-	if workflow.OwnerUserID != user.ID {
-		return nil, errors.Unauthorized
+	if err := organizationEngine.CheckWorkflowAccess(workflow, user.ID, models.EditorRole); err != nil {
+		return nil, err
+	}
+
+	if in.RunAsUserID != nil {
+		if err := organizationEngine.CheckRunAs(workflow, user.ID, *in.RunAsUserID); err != nil {
+			return nil, err
+		}
+	}
+
+	credentialsUserID := workflow.CredentialsUserID()
+	if in.RunAsUserID != nil && *in.RunAsUserID != 0 {
+		credentialsUserID = *in.RunAsUserID
+	}
+	steps := requestedSteps(in.Steps, in.ModifierName, in.ModifierParameters, in.ReactionName, in.ReactionParameters)
+	if in.ActionConnectionID != 0 {
+		if err := services.CheckConnection(in.ActionName, in.ActionConnectionID, credentialsUserID); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkStepsConnections(steps, credentialsUserID); err != nil {
+		return nil, err
+	}
+	if err, ok := workflowEngine.ValidateWorkflow(models.Workflow{
+		ActionName:          in.ActionName,
+		ActionParameters:    in.ActionParameters,
+		Steps:               steps,
+		RetryPolicy:         in.RetryPolicy,
+		PollIntervalSeconds: in.PollIntervalSeconds,
+	}); !ok {
+		return nil, errors.NewBadRequest(err, err.Error())
 	}
 
 	if workflow.Active {
@@ -194,15 +341,27 @@ func EditWorkflow(c *gin.Context, in *routes.EditWorkflowRequest) (*routes.GetWo
 		}
 	}
 
+	before := auditedWorkflow(workflow)
+	wasActive := workflow.Active
+
 	workflow.Name = in.Name
 	workflow.ActionName = in.ActionName
 	workflow.ActionParameters = in.ActionParameters
-	workflow.ModifierName = in.ModifierName
-	workflow.ModifierParameters = in.ModifierParameters
-	workflow.ReactionName = in.ReactionName
-	workflow.ReactionParameters = in.ReactionParameters
+	workflow.ActionConnectionID = in.ActionConnectionID
+	workflow.Steps = steps
+	workflow.RetryPolicy = in.RetryPolicy
+	workflow.CatchUp = in.CatchUp
+	workflow.PollIntervalSeconds = in.PollIntervalSeconds
+	if in.RunAsUserID != nil {
+		workflow.RunAsUserID = *in.RunAsUserID
+	}
 	workflow.Active = in.Active
 
+	if err := workflowEngine.SealSensitiveParameters(&workflow); err != nil {
+		log.Print(err.Error())
+		return nil, errors.New("Internal server error")
+	}
+
 	if rst := initializers.DB.Save(&workflow); rst.Error != nil {
 		return nil, errors.New("Internal server error")
 	}
@@ -214,19 +373,11 @@ func EditWorkflow(c *gin.Context, in *routes.EditWorkflowRequest) (*routes.GetWo
 				return nil, errors.New("Internal server error")
 			}
 			//initializers.DB.Delete(&workflow)
+			recordWorkflowEdit(c, workflow, before, wasActive)
 			return nil, err
 		}
 	}
 
-	return &routes.GetWorkflowResponse{
-		WorkflowID:         workflow.ID,
-		Name:               workflow.Name,
-		ActionName:         workflow.ActionName,
-		ActionParameters:   workflow.ActionParameters,
-		ModifierName:       workflow.ModifierName,
-		ModifierParameters: workflow.ModifierParameters,
-		ReactionName:       workflow.ReactionName,
-		ReactionParameters: workflow.ReactionParameters,
-		Active:             workflow.Active,
-	}, nil
+	recordWorkflowEdit(c, workflow, before, wasActive)
+	return newWorkflowResponse(workflow), nil
 }
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"dawpitech/area/engines/workflowEngine"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"dawpitech/area/models/routes"
+	"dawpitech/area/stores"
+	"dawpitech/area/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+)
+
+func GetAllWorkflowRuns(c *gin.Context, in *routes.GetAllWorkflowRunsRequest) (*routes.GetAllWorkflowRunsResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	workflow, err := getAccessibleWorkflow(in.WorkflowID, user.ID, models.ViewerRole)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []models.WorkflowRun
+	if rst := initializers.DB.
+		Where("workflow_id=?", workflow.ID).
+		Order("triggered_at desc").
+		Limit(in.Limit).
+		Offset(in.Offset).
+		Find(&runs); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	response := routes.GetAllWorkflowRunsResponse{
+		Runs: make([]routes.WorkflowRunSummary, 0, len(runs)),
+	}
+	for _, run := range runs {
+		response.Runs = append(response.Runs, routes.WorkflowRunSummary{
+			RunID:       run.ID,
+			Mode:        run.Mode,
+			TriggeredAt: run.TriggeredAt,
+			FinishedAt:  run.FinishedAt,
+			Status:      run.Status,
+			Error:       run.Error,
+		})
+	}
+	return &response, nil
+}
+
+func GetWorkflowRun(c *gin.Context, in *routes.WorkflowRunID) (*routes.GetWorkflowRunResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	if _, err := getAccessibleWorkflow(in.WorkflowID, user.ID, models.ViewerRole); err != nil {
+		return nil, err
+	}
+
+	var run models.WorkflowRun
+	if rst := initializers.DB.
+		Where("id=? AND workflow_id=?", in.RunID, in.WorkflowID).
+		First(&run); rst.Error != nil {
+		return nil, errors.NotFound
+	}
+
+	return newWorkflowRunResponse(run)
+}
+
+func newWorkflowRunResponse(run models.WorkflowRun) (*routes.GetWorkflowRunResponse, error) {
+	var logs []models.LogEntry
+	if rst := initializers.DB.Where("run_id=?", run.ID).Order("timestamp asc").Find(&logs); rst.Error != nil {
+		return nil, errors.New("Internal server error.")
+	}
+
+	response := routes.GetWorkflowRunResponse{
+		RunID:       run.ID,
+		WorkflowID:  run.WorkflowID,
+		Mode:        run.Mode,
+		TriggeredAt: run.TriggeredAt,
+		FinishedAt:  run.FinishedAt,
+		Status:      run.Status,
+		Error:       run.Error,
+		TriggerData: run.TriggerData,
+		Steps:       run.Steps,
+		Logs:        make([]models.PublicLogEntry, 0, len(logs)),
+	}
+	for _, entry := range logs {
+		response.Logs = append(response.Logs, models.PublicLogEntry{
+			RunID:     entry.RunID,
+			Timestamp: entry.Timestamp,
+			Type:      entry.Type,
+			Message:   entry.Message,
+		})
+	}
+	return &response, nil
+}
+
+func RunWorkflowNow(c *gin.Context, in *routes.RunWorkflowRequest) (*routes.GetWorkflowRunResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	workflow, err := getAccessibleWorkflow(in.WorkflowID, user.ID, models.EditorRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if err, ok := workflowEngine.ValidateWorkflow(*workflow); !ok {
+		return nil, errors.NewBadRequest(err, err.Error())
+	}
+
+	action := stores.ActionStore[workflow.ActionName]
+	outputs, err := workflowEngine.ActionOutputs(action, workflow.ActionParameters)
+	if err != nil {
+		return nil, errors.NewBadRequest(err, err.Error())
+	}
+	expectedOutputs := make(map[string]bool, len(outputs))
+	for _, output := range outputs {
+		expectedOutputs[output.Name] = true
+		if _, present := in.TriggerOutputs[output.Name]; !present {
+			return nil, errors.BadRequestf("Missing trigger output '%s'.", output.Name)
+		}
+	}
+	for name := range in.TriggerOutputs {
+		if !expectedOutputs[name] {
+			return nil, errors.BadRequestf("Action '%s' has no output named '%s'.", action.Name, name)
+		}
+	}
+
+	ctx := workflowEngine.NewContext(*workflow)
+	ctx.RunMode = models.ManualRunMode
+	if in.DryRun {
+		ctx.RunMode = models.DryRunMode
+	}
+	for name, value := range in.TriggerOutputs {
+		ctx.RuntimeData[name] = value
+	}
+
+	return newWorkflowRunResponse(workflowEngine.ExecuteWorkflow(ctx))
+}
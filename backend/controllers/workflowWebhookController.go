@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"dawpitech/area/engines/auditEngine"
+	"dawpitech/area/models"
+	"dawpitech/area/models/routes"
+	"dawpitech/area/services/webhook"
+	"dawpitech/area/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+)
+
+func GetWorkflowWebhook(c *gin.Context, in *routes.WorkflowID) (*routes.GetWorkflowWebhookResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	// Knowing the URL is enough to trigger the workflow, viewers don't get it.
+	workflow, err := getAccessibleWorkflow(in.WorkflowID, user.ID, models.EditorRole)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := webhook.IngestURL(*workflow, false)
+	if err != nil {
+		return nil, err
+	}
+	return &routes.GetWorkflowWebhookResponse{URL: url}, nil
+}
+
+func RotateWorkflowWebhook(c *gin.Context, in *routes.WorkflowID) (*routes.GetWorkflowWebhookResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	workflow, err := getAccessibleWorkflow(in.WorkflowID, user.ID, models.EditorRole)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := webhook.IngestURL(*workflow, true)
+	if err != nil {
+		return nil, err
+	}
+
+	auditEngine.RecordRequest(c, models.AuditEntry{
+		Action:     models.WorkflowWebhookRotateAction,
+		TargetType: models.WorkflowTarget,
+		TargetID:   workflow.ID,
+	})
+	return &routes.GetWorkflowWebhookResponse{URL: url}, nil
+}
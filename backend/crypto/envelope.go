@@ -0,0 +1,188 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	stdCrypto "crypto/rand"
+	"encoding/base64"
+	"github.com/juju/errors"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Secrets are encrypted with a random data key which is itself encrypted with
+// a master key from the environment. The result is stored as
+// enc:v1:<master key id>:<encrypted data key>:<encrypted secret>. Rotating the
+// master keys decrypts each secret and encrypts it again under a new data key.
+const envelopePrefix = "enc:v1:"
+
+const dataKeySize = 32
+
+type masterKey struct {
+	ID  string
+	Key []byte
+}
+
+var masterKeysOnce sync.Once
+var masterKeys []masterKey
+var masterKeysErr error
+
+// LoadMasterKeys parses ENCRYPTION_MASTER_KEYS, a comma separated list of
+// <id>:<base64 key> where the first key encrypts and the others are only kept
+// to decrypt secrets not rotated yet.
+func LoadMasterKeys() error {
+	masterKeysOnce.Do(func() {
+		raw, present := os.LookupEnv("ENCRYPTION_MASTER_KEYS")
+		if !present || strings.TrimSpace(raw) == "" {
+			masterKeysErr = errors.New("ENCRYPTION_MASTER_KEYS is not set")
+			return
+		}
+		for _, entry := range strings.Split(raw, ",") {
+			id, encoded, found := strings.Cut(strings.TrimSpace(entry), ":")
+			if !found || id == "" || strings.Contains(id, ":") {
+				masterKeysErr = errors.New("ENCRYPTION_MASTER_KEYS entries must be formatted as <id>:<base64 key>")
+				return
+			}
+			key, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil || len(key) != 32 {
+				masterKeysErr = errors.Errorf("master key '%s' must be 32 bytes encoded in base64", id)
+				return
+			}
+			masterKeys = append(masterKeys, masterKey{ID: id, Key: key})
+		}
+	})
+	return masterKeysErr
+}
+
+func activeMasterKey() (masterKey, error) {
+	if err := LoadMasterKeys(); err != nil {
+		return masterKey{}, err
+	}
+	return masterKeys[0], nil
+}
+
+func findMasterKey(id string) (masterKey, error) {
+	if err := LoadMasterKeys(); err != nil {
+		return masterKey{}, err
+	}
+	for _, key := range masterKeys {
+		if key.ID == id {
+			return key, nil
+		}
+	}
+	return masterKey{}, errors.Errorf("unknown master key '%s'", id)
+}
+
+func seal(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := stdCrypto.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key []byte, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// IsEncrypted tells if the value is an encrypted secret.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, envelopePrefix)
+}
+
+func Encrypt(plaintext string) (string, error) {
+	master, err := activeMasterKey()
+	if err != nil {
+		return "", err
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := stdCrypto.Read(dataKey); err != nil {
+		return "", err
+	}
+	encryptedKey, err := seal(master.Key, dataKey)
+	if err != nil {
+		return "", err
+	}
+	encryptedValue, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return envelopePrefix + master.ID + ":" +
+		base64.StdEncoding.EncodeToString(encryptedKey) + ":" +
+		base64.StdEncoding.EncodeToString(encryptedValue), nil
+}
+
+// Decrypt returns the secret held by an encrypted value, values which aren't
+// encrypted are returned as is.
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	elements := strings.Split(strings.TrimPrefix(value, envelopePrefix), ":")
+	if len(elements) != 3 {
+		return "", errors.New("invalid encrypted value format")
+	}
+	master, err := findMasterKey(elements[0])
+	if err != nil {
+		return "", err
+	}
+	encryptedKey, err := base64.StdEncoding.DecodeString(elements[1])
+	if err != nil {
+		return "", errors.New("invalid encrypted data key")
+	}
+	encryptedValue, err := base64.StdEncoding.DecodeString(elements[2])
+	if err != nil {
+		return "", errors.New("invalid encrypted secret")
+	}
+
+	dataKey, err := open(master.Key, encryptedKey)
+	if err != nil {
+		return "", errors.New("couldn't decrypt the data key")
+	}
+	plaintext, err := open(dataKey, encryptedValue)
+	if err != nil {
+		return "", errors.New("couldn't decrypt the secret")
+	}
+	return string(plaintext), nil
+}
+
+// Reencrypt decrypts the value and encrypts it again under a new data key
+// sealed by the active master key, unless it already uses that key. Plain
+// values get encrypted.
+func Reencrypt(value string) (string, error) {
+	master, err := activeMasterKey()
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(value, envelopePrefix+master.ID+":") {
+		return value, nil
+	}
+	plaintext, err := Decrypt(value)
+	if err != nil {
+		return "", err
+	}
+	return Encrypt(plaintext)
+}
@@ -0,0 +1,47 @@
+package crypto
+
+import (
+	"context"
+	"github.com/juju/errors"
+	"gorm.io/gorm/schema"
+	"reflect"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+// EncryptedSerializer transparently encrypts string fields tagged with
+// `gorm:"serializer:encrypted"`, empty strings are stored as is.
+type EncryptedSerializer struct{}
+
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch raw := dbValue.(type) {
+	case nil:
+	case string:
+		value = raw
+	case []byte:
+		value = string(raw)
+	default:
+		return errors.Errorf("unsupported data %#v for encrypted field %s", dbValue, field.Name)
+	}
+
+	plaintext, err := Decrypt(value)
+	if err != nil {
+		return errors.Annotatef(err, "couldn't decrypt field %s", field.Name)
+	}
+	field.ReflectValueOf(ctx, dst).SetString(plaintext)
+	return nil
+}
+
+func (EncryptedSerializer) Value(_ context.Context, field *schema.Field, _ reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, ok := fieldValue.(string)
+	if !ok {
+		return nil, errors.Errorf("encrypted field %s must be a string", field.Name)
+	}
+	if value == "" {
+		return "", nil
+	}
+	return Encrypt(value)
+}
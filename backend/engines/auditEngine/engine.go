@@ -0,0 +1,60 @@
+package auditEngine
+
+import (
+	"bytes"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"dawpitech/area/utils"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"log"
+)
+
+// Record appends the entry to the audit trail, a failure is logged but
+// doesn't fail the audited action.
+func Record(entry models.AuditEntry) {
+	if rst := initializers.DB.Create(&entry); rst.Error != nil {
+		log.Printf("Couldn't write audit entry '%s' of user #%d. Err: %s\n", entry.Action, entry.ActorUserID, rst.Error.Error())
+	}
+}
+
+// RecordRequest records an action done through the request, the actor is the
+// authenticated user unless the entry sets one.
+func RecordRequest(c *gin.Context, entry models.AuditEntry) {
+	entry.IPAddress = c.ClientIP()
+	if entry.ActorUserID == 0 {
+		if maybeUser, ok := c.Get("user"); ok {
+			if user, ok := utils.MaybeGetUser(maybeUser); ok {
+				entry.ActorUserID = user.ID
+			}
+		}
+	}
+	Record(entry)
+}
+
+// Diff returns the fields whose JSON value differs between the two snapshots,
+// either can be nil on creation or deletion.
+func Diff(before map[string]interface{}, after map[string]interface{}) map[string]models.AuditChange {
+	changes := make(map[string]models.AuditChange)
+	compare := func(field string) {
+		if _, done := changes[field]; done {
+			return
+		}
+		beforeJSON, beforeErr := json.Marshal(before[field])
+		afterJSON, afterErr := json.Marshal(after[field])
+		if beforeErr == nil && afterErr == nil && bytes.Equal(beforeJSON, afterJSON) {
+			return
+		}
+		changes[field] = models.AuditChange{
+			Before: before[field],
+			After:  after[field],
+		}
+	}
+	for field := range before {
+		compare(field)
+	}
+	for field := range after {
+		compare(field)
+	}
+	return changes
+}
@@ -0,0 +1,108 @@
+package clusterEngine
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"dawpitech/area/initializers"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Every instance of the backend competes for this Postgres advisory lock, the
+// one holding it is the leader and is the only one running the triggers. The
+// lock is bound to the database session, it is released as soon as the leader
+// dies or loses its connection so that another instance can take over.
+const leaderLockKey int64 = 0x41524541
+
+const electionInterval = 5 * time.Second
+
+var leader atomic.Bool
+
+var sessionMutex sync.Mutex
+var leaderSession *sql.Conn
+
+// NodeName identifies this instance in the logs.
+var NodeName = func() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}()
+
+func IsLeader() bool {
+	return leader.Load()
+}
+
+// Start runs the leader election, onElected is called when this instance
+// becomes the leader and onDemoted when it loses the leadership. The first
+// round is run before returning so a single instance starts as the leader.
+func Start(onElected func(), onDemoted func()) {
+	elect(onElected, onDemoted)
+	go func() {
+		ticker := time.NewTicker(electionInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			elect(onElected, onDemoted)
+		}
+	}()
+}
+
+// discardSession closes the underlying connection instead of returning it to
+// the pool, a connection still holding the lock must never be reused.
+func discardSession(session *sql.Conn) {
+	_ = session.Raw(func(_ any) error {
+		return driver.ErrBadConn
+	})
+	_ = session.Close()
+}
+
+func elect(onElected func(), onDemoted func()) {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), electionInterval)
+	defer cancel()
+
+	if leaderSession != nil {
+		if _, err := leaderSession.ExecContext(ctx, "SELECT 1"); err == nil {
+			return
+		}
+		log.Printf("Node %s lost its database session, stepping down as leader.\n", NodeName)
+		discardSession(leaderSession)
+		leaderSession = nil
+		leader.Store(false)
+		onDemoted()
+		return
+	}
+
+	sqlDB, err := initializers.DB.DB()
+	if err != nil {
+		log.Printf("Node %s couldn't access the database pool. Err: %s\n", NodeName, err.Error())
+		return
+	}
+	session, err := sqlDB.Conn(ctx)
+	if err != nil {
+		log.Printf("Node %s couldn't open a database session. Err: %s\n", NodeName, err.Error())
+		return
+	}
+
+	var acquired bool
+	if err := session.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", leaderLockKey).Scan(&acquired); err != nil || !acquired {
+		if err != nil {
+			log.Printf("Node %s couldn't run the leader election. Err: %s\n", NodeName, err.Error())
+		}
+		_ = session.Close()
+		return
+	}
+
+	log.Printf("Node %s is now the leader, it owns the workflow triggers.\n", NodeName)
+	leaderSession = session
+	leader.Store(true)
+	onElected()
+}
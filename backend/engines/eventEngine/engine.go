@@ -0,0 +1,270 @@
+package eventEngine
+
+import (
+	"dawpitech/area/engines/schedulerEngine"
+	"dawpitech/area/engines/workflowEngine"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"gorm.io/gorm/clause"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The events are dispatched as soon as they are published on the leader, the
+// other instances only save them. The leader processes the events left
+// pending on a regular basis, the ones published elsewhere or interrupted by a
+// crash.
+const recoveryInterval = 5 * time.Second
+
+// claimTimeout is how long an event stays claimed by the instance processing
+// it, it is processed again afterwards.
+const claimTimeout = 10 * time.Minute
+
+// eventJobTag tags the jobs processing an event in the scheduler.
+const eventJobTag = "event"
+
+// unmatchedRetryDelay is how long an event no armed trigger matched waits
+// before being dispatched again, its workflow may be re-armed meanwhile.
+const unmatchedRetryDelay = 30 * time.Second
+
+// retention is how long the events are kept, processed or not.
+const retention = 7 * 24 * time.Hour
+
+const (
+	UserAttribute       = "user_id"
+	ConnectionAttribute = "connection_id"
+)
+
+// Filter tells if an event is for the subscribed workflow.
+type Filter func(event models.Event) bool
+
+type subscription struct {
+	ctx       models.Context
+	eventType string
+	filter    Filter
+}
+
+var subscriptionsMutex sync.Mutex
+
+// subscriptions holds the subscription of each workflow whose trigger is armed
+// on this instance.
+var subscriptions = make(map[uint]subscription)
+
+// Subscribe runs the workflow of the context for every event of the type the
+// filter accepts, a nil filter accepts them all.
+func Subscribe(ctx models.Context, eventType string, filter Filter) {
+	subscriptionsMutex.Lock()
+	defer subscriptionsMutex.Unlock()
+	subscriptions[ctx.WorkflowID] = subscription{
+		ctx:       ctx,
+		eventType: eventType,
+		filter:    filter,
+	}
+}
+
+func Unsubscribe(ctx models.Context) {
+	subscriptionsMutex.Lock()
+	defer subscriptionsMutex.Unlock()
+	delete(subscriptions, ctx.WorkflowID)
+}
+
+// ConnectionAttributes identifies the provider connection an event was
+// received for.
+func ConnectionAttributes(userID uint, connectionID uint) map[string]string {
+	return map[string]string{
+		UserAttribute:       strconv.FormatUint(uint64(userID), 10),
+		ConnectionAttribute: strconv.FormatUint(uint64(connectionID), 10),
+	}
+}
+
+// ConnectionFilter accepts the events received for the connections the
+// workflow of the context runs with.
+func ConnectionFilter(ctx models.Context) Filter {
+	userID := strconv.FormatUint(uint64(ctx.CredentialsUserID), 10)
+	connectionID := strconv.FormatUint(uint64(ctx.ConnectionID), 10)
+	return func(event models.Event) bool {
+		if event.Attributes[UserAttribute] != userID {
+			return false
+		}
+		return ctx.ConnectionID == 0 || event.Attributes[ConnectionAttribute] == connectionID
+	}
+}
+
+// Publish saves the event then dispatches it, the event is safe once it
+// returns. An event whose SourceID was already received is ignored.
+func Publish(event models.Event) error {
+	event.ID = 0
+	rst := initializers.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&event)
+	if rst.Error != nil {
+		log.Printf("Couldn't save event '%s'. Err: %s\n", event.Type, rst.Error.Error())
+		return rst.Error
+	}
+	if rst.RowsAffected == 0 {
+		return nil
+	}
+	if workflowEngine.TriggersReady() {
+		dispatch(event.ID)
+	}
+	return nil
+}
+
+func matchingSubscriptions(event models.Event) []subscription {
+	subscriptionsMutex.Lock()
+	defer subscriptionsMutex.Unlock()
+
+	var matching []subscription
+	for _, current := range subscriptions {
+		if current.eventType != event.Type {
+			continue
+		}
+		if current.filter != nil && !current.filter(event) {
+			continue
+		}
+		matching = append(matching, current)
+	}
+	return matching
+}
+
+// dispatch claims the event and queues its processing, it waits for a slot
+// like the jobs of the triggers.
+func dispatch(eventID uint) {
+	now := time.Now()
+	claim := initializers.DB.
+		Model(&models.Event{}).
+		Where("id=? AND processed_at IS NULL AND (claimed_at IS NULL OR claimed_at < ?)", eventID, now.Add(-claimTimeout)).
+		Update("claimed_at", now)
+	if claim.Error != nil {
+		log.Printf("Couldn't claim event #%d. Err: %s\n", eventID, claim.Error.Error())
+		return
+	}
+	if claim.RowsAffected == 0 {
+		return
+	}
+
+	if err := schedulerEngine.Submit(eventJobTag, func() { process(eventID) }); err != nil {
+		log.Printf("Couldn't queue event #%d. Err: %s\n", eventID, err.Error())
+		if rst := initializers.DB.Model(&models.Event{}).Where("id=?", eventID).Update("claimed_at", nil); rst.Error != nil {
+			log.Printf("Couldn't release event #%d. Err: %s\n", eventID, rst.Error.Error())
+		}
+	}
+}
+
+// process runs the workflows subscribed to the claimed event. The delivery of
+// each workflow is saved before it runs, so it never runs twice for an event,
+// even when the claim expired meanwhile. An event no trigger matched is left
+// pending, its workflow may not be armed yet.
+func process(eventID uint) {
+	var event models.Event
+	if rst := initializers.DB.Where("id=?", eventID).First(&event); rst.Error != nil {
+		log.Printf("Couldn't load event #%d. Err: %s\n", eventID, rst.Error.Error())
+		return
+	}
+
+	var deliveredIDs []uint
+	if rst := initializers.DB.
+		Model(&models.EventDelivery{}).
+		Where("event_id=?", event.ID).
+		Pluck("workflow_id", &deliveredIDs); rst.Error != nil {
+		log.Printf("Couldn't load the deliveries of event #%d. Err: %s\n", event.ID, rst.Error.Error())
+		return
+	}
+	delivered := make(map[uint]bool, len(deliveredIDs))
+	for _, workflowID := range deliveredIDs {
+		delivered[workflowID] = true
+	}
+
+	matching := matchingSubscriptions(event)
+	if len(matching) == 0 && len(delivered) == 0 {
+		retryAt := time.Now().Add(unmatchedRetryDelay)
+		if rst := initializers.DB.
+			Model(&event).
+			Select("claimed_at", "retry_at").
+			Updates(map[string]interface{}{"claimed_at": nil, "retry_at": retryAt}); rst.Error != nil {
+			log.Printf("Couldn't release event #%d. Err: %s\n", event.ID, rst.Error.Error())
+		}
+		return
+	}
+
+	for _, current := range matching {
+		if delivered[current.ctx.WorkflowID] {
+			continue
+		}
+		ctx := current.ctx
+		delivery := models.EventDelivery{
+			EventID:    event.ID,
+			WorkflowID: ctx.WorkflowID,
+		}
+		rst := initializers.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&delivery)
+		if rst.Error != nil {
+			log.Printf("Couldn't save the delivery of event #%d to workflow #%d. Err: %s\n", event.ID, ctx.WorkflowID, rst.Error.Error())
+			continue
+		}
+		if rst.RowsAffected == 0 {
+			continue
+		}
+
+		ctx.RuntimeData = make(map[string]string, len(event.Data))
+		for name, value := range event.Data {
+			ctx.RuntimeData[name] = value
+		}
+		run := workflowEngine.ExecuteWorkflow(ctx)
+
+		if rst := initializers.DB.Model(&delivery).Update("run_id", run.ID); rst.Error != nil {
+			log.Printf("Couldn't save the run of event #%d for workflow #%d. Err: %s\n", event.ID, ctx.WorkflowID, rst.Error.Error())
+		}
+	}
+
+	if rst := initializers.DB.Model(&event).Update("processed_at", time.Now()); rst.Error != nil {
+		log.Printf("Couldn't mark event #%d as processed. Err: %s\n", event.ID, rst.Error.Error())
+	}
+}
+
+// ProcessPendingEvents dispatches the events not processed yet and forgets
+// the old ones, it only runs on the leader once the triggers are armed.
+func ProcessPendingEvents() {
+	if !workflowEngine.TriggersReady() {
+		return
+	}
+
+	now := time.Now()
+	var eventIDs []uint
+	if rst := initializers.DB.
+		Model(&models.Event{}).
+		Where("processed_at IS NULL AND (claimed_at IS NULL OR claimed_at < ?)", now.Add(-claimTimeout)).
+		Where("retry_at IS NULL OR retry_at < ?", now).
+		Order("id asc").
+		Limit(100).
+		Pluck("id", &eventIDs); rst.Error != nil {
+		log.Printf("Couldn't load the pending events. Err: %s\n", rst.Error.Error())
+		return
+	}
+	for _, eventID := range eventIDs {
+		dispatch(eventID)
+	}
+
+	// The events never delivered are forgotten after the same delay.
+	cutoff := time.Now().Add(-retention)
+	expired := initializers.DB.
+		Model(&models.Event{}).
+		Select("id").
+		Where("processed_at < ? OR (processed_at IS NULL AND created_at < ?)", cutoff, cutoff)
+	if rst := initializers.DB.Where("event_id IN (?)", expired).Delete(&models.EventDelivery{}); rst.Error != nil {
+		log.Printf("Couldn't delete the old event deliveries. Err: %s\n", rst.Error.Error())
+		return
+	}
+	if rst := initializers.DB.Where("processed_at < ? OR (processed_at IS NULL AND created_at < ?)", cutoff, cutoff).Delete(&models.Event{}); rst.Error != nil {
+		log.Printf("Couldn't delete the old events. Err: %s\n", rst.Error.Error())
+	}
+}
+
+func Start() {
+	go func() {
+		ticker := time.NewTicker(recoveryInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ProcessPendingEvents()
+		}
+	}()
+}
@@ -10,25 +10,41 @@ import (
 	"time"
 )
 
+func saveLogEntry(entry models.LogEntry) {
+	rst := initializers.DB.Create(&entry)
+	if rst.Error != nil {
+		log.Print("Error occurred while saving log entry in db. Err: " + rst.Error.Error())
+	}
+}
+
 func NewLogEntry(workflowID uint, logType models.LogType, msg string) {
-	workflow, err := gorm.G[models.Workflow](initializers.DB).First(context.Background())
+	workflow, err := gorm.G[models.Workflow](initializers.DB).Where("id = ?", workflowID).First(context.Background())
 	if err != nil {
-		if errors.Is(err, gorm.ErrRegistered) {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			log.Print("Tried to write a log entry for a workflow that doesn't exist!")
 		} else {
 			log.Print("Couldn't load workflow to write log entry. Err: " + err.Error())
 		}
 	}
- 
-	entry := models.LogEntry{
+
+	saveLogEntry(models.LogEntry{
 		WorkflowID:  workflowID,
 		OwnerUserID: workflow.OwnerUserID,
 		Timestamp:   time.Now(),
 		Type:        logType.String(),
 		Message:     msg,
-	}
-	rst := initializers.DB.Create(&entry)
-	if rst.Error != nil {
-		log.Print("Error occurred while saving log entry in db. Err: " + rst.Error.Error())
-	}
+	})
+}
+
+// NewContextLogEntry writes a log entry linked to the run of the given
+// context, if the context belongs to one.
+func NewContextLogEntry(ctx models.Context, logType models.LogType, msg string) {
+	saveLogEntry(models.LogEntry{
+		WorkflowID:  ctx.WorkflowID,
+		RunID:       ctx.RunID,
+		OwnerUserID: ctx.OwnerUserID,
+		Timestamp:   time.Now(),
+		Type:        logType.String(),
+		Message:     msg,
+	})
 }
@@ -0,0 +1,53 @@
+package mailEngine
+
+import (
+	_ "github.com/joho/godotenv/autoload" // Assure that the mailer settings are loaded before init
+	"log"
+	"os"
+)
+
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers the mails sent by the API, MAILER selects the
+// implementation: "smtp", or "log" for local development and tests.
+type Mailer interface {
+	Send(mail Mail) error
+}
+
+var mailer Mailer
+
+func init() {
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		smtpMailer, err := NewSMTPMailer()
+		if err != nil {
+			log.Panic("Mail engine couldn't init the SMTP mailer: " + err.Error())
+		}
+		mailer = smtpMailer
+	case "", "log":
+		logMailer, err := NewLogMailer(os.Getenv("MAILER_LOG_FILE"))
+		if err != nil {
+			log.Panic("Mail engine couldn't init the log mailer: " + err.Error())
+		}
+		mailer = logMailer
+	default:
+		log.Panic("MAILER must be either 'smtp' or 'log'")
+	}
+}
+
+// SetMailer replaces the mailer, mostly for tests.
+func SetMailer(m Mailer) {
+	mailer = m
+}
+
+func Send(to string, subject string, body string) error {
+	return mailer.Send(Mail{
+		To:      to,
+		Subject: subject,
+		Body:    body,
+	})
+}
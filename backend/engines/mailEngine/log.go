@@ -0,0 +1,37 @@
+package mailEngine
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogMailer doesn't deliver anything, mails are written to the standard
+// output or appended to a file.
+type LogMailer struct {
+	mutex  sync.Mutex
+	output io.Writer
+}
+
+func NewLogMailer(path string) (*LogMailer, error) {
+	if path == "" {
+		return &LogMailer{output: os.Stdout}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &LogMailer{output: file}, nil
+}
+
+func (m *LogMailer) Send(mail Mail) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	_, err := fmt.Fprintf(m.output, "--- Mail sent at %s\nTo: %s\nSubject: %s\n\n%s\n---\n",
+		time.Now().Format(time.RFC3339), mail.To, mail.Subject, mail.Body)
+	return err
+}
@@ -0,0 +1,64 @@
+package mailEngine
+
+import (
+	"fmt"
+	"github.com/juju/errors"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+type SMTPMailer struct {
+	Address string
+	From    string
+	// Sender is the bare address of From, used in the SMTP envelope.
+	Sender string
+	Auth   smtp.Auth
+}
+
+// NewSMTPMailer reads its settings from SMTP_HOST, SMTP_PORT, SMTP_USERNAME,
+// SMTP_PASSWORD and MAIL_FROM. Without username the server is used without
+// authentication.
+func NewSMTPMailer() (*SMTPMailer, error) {
+	host := os.Getenv("SMTP_HOST")
+	port := os.Getenv("SMTP_PORT")
+	from := os.Getenv("MAIL_FROM")
+	if host == "" || port == "" || from == "" {
+		return nil, errors.New("SMTP_HOST, SMTP_PORT and MAIL_FROM are required")
+	}
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, errors.Annotate(err, "MAIL_FROM is not a valid address")
+	}
+
+	mailer := &SMTPMailer{
+		Address: net.JoinHostPort(host, port),
+		From:    from,
+		Sender:  sender.Address,
+	}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		mailer.Auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return mailer, nil
+}
+
+func (m *SMTPMailer) Send(mail Mail) error {
+	// The headers are built from our own values but a recipient could still
+	// try to sneak in new lines.
+	if strings.ContainsAny(mail.To, "\r\n") || strings.ContainsAny(mail.Subject, "\r\n") {
+		return errors.New("mail headers can't contain new lines")
+	}
+
+	message := fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=\"utf-8\"\r\n\r\n%s",
+		m.From, mail.To, mail.Subject, time.Now().Format(time.RFC1123Z),
+		strings.ReplaceAll(mail.Body, "\n", "\r\n"),
+	)
+	if err := smtp.SendMail(m.Address, m.Auth, m.Sender, []string{mail.To}, []byte(message)); err != nil {
+		return errors.Annotatef(err, "couldn't send mail to %s", mail.To)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package oauthEngine
+
+import (
+	"context"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"github.com/juju/errors"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"sync"
+)
+
+var ErrNeedsReauth = errors.New("The provider connection needs to be re-authenticated.")
+
+var ErrNoConnection = errors.New("No account of this provider is linked.")
+
+var ErrConnectionNotFound = errors.New("The provider account chosen for this step is not linked anymore.")
+
+// savingTokenSource renews the token of a provider connection when it expires
+// and saves the new one on the connection. When the provider refuses to renew
+// it, the connection is flagged as needing a new authorization.
+type savingTokenSource struct {
+	mutex      sync.Mutex
+	connection models.OAuthConnection
+	source     oauth2.TokenSource
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	saved := s.connection.GetOAuthToken()
+	if saved.NeedsReauth {
+		return nil, ErrNeedsReauth
+	}
+
+	token, err := s.source.Token()
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) {
+			log.Printf("Provider refused to renew a token, flagging the connection. Err: %s\n", err.Error())
+			saved.NeedsReauth = true
+			s.save()
+			return nil, ErrNeedsReauth
+		}
+		return nil, err
+	}
+
+	if token.AccessToken != saved.AccessToken {
+		saved.Renew(token)
+		s.save()
+	}
+	return token, nil
+}
+
+func (s *savingTokenSource) save() {
+	rst := initializers.DB.
+		Model(s.connection).
+		Select("access_token", "refresh_token", "token_type", "expiry", "needs_reauth").
+		Updates(s.connection)
+	if rst.Error != nil {
+		log.Print("Couldn't save the renewed token of a provider connection. Err: " + rst.Error.Error())
+	}
+}
+
+// NewClient returns an HTTP client authenticated as the given connection, its
+// token is renewed on expiry and written back to the database.
+func NewClient(config *oauth2.Config, connection models.OAuthConnection) *http.Client {
+	source := &savingTokenSource{
+		connection: connection,
+		source:     config.TokenSource(context.Background(), connection.GetOAuthToken().ToOAuth2()),
+	}
+	return oauth2.NewClient(context.Background(), source)
+}
+
+// FindConnection loads into connection the provider account chosen for the
+// running handler, or the first one linked when none was chosen.
+func FindConnection(ctx models.Context, connection models.OAuthConnection) error {
+	query := initializers.DB.Where("user_id=?", ctx.CredentialsUserID)
+	if ctx.ConnectionID != 0 {
+		query = query.Where("id=?", ctx.ConnectionID)
+	}
+	rst := query.Order("id asc").First(connection)
+	if errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+		if ctx.ConnectionID != 0 {
+			return ErrConnectionNotFound
+		}
+		return ErrNoConnection
+	}
+	if rst.Error != nil {
+		return errors.New("Internal server error.")
+	}
+	return nil
+}
+
+// FindAccountConnection loads into connection the one of the user linked to
+// the provider account, linking it again replaces its token. A connection
+// saved before the accounts were recorded is reused as well, connection is
+// left untouched when none matches.
+func FindAccountConnection(connection models.OAuthConnection, userID uint, accountID string) error {
+	rst := initializers.DB.Where("user_id=? AND account_id=?", userID, accountID).First(connection)
+	if errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+		rst = initializers.DB.Where("user_id=? AND (account_id='' OR account_id IS NULL)", userID).Order("id asc").First(connection)
+	}
+	if rst.Error != nil && !errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+		return rst.Error
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package oauthEngine
+
+import (
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"os"
+	"time"
+)
+
+// stateLifetime is how long the user has to go through the provider's
+// consent screen.
+const stateLifetime = 10 * time.Minute
+
+// AuthState is what the callback of a provider connection needs to know
+// about the authorization it ends.
+type AuthState struct {
+	UserID uint
+	// ActorUserID is the user who started the authorization, UserID is the
+	// organization's service account when connecting it.
+	ActorUserID uint
+	Platform    string
+}
+
+func statePurpose(provider string) string {
+	return "connection_" + provider
+}
+
+// SignState returns the OAuth state of a connection to the provider, it is
+// signed rather than kept in memory so the callback can reach any instance.
+func SignState(provider string, state AuthState) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"purpose":       statePurpose(provider),
+		"user_id":       state.UserID,
+		"actor_user_id": state.ActorUserID,
+		"platform":      state.Platform,
+		"exp":           time.Now().Add(stateLifetime).Unix(),
+	})
+	return token.SignedString([]byte(os.Getenv("JWT_TOKENS_SECRET")))
+}
+
+// ParseState returns the state signed by SignState for the same provider.
+func ParseState(provider string, tokenString string) (*AuthState, bool) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(os.Getenv("JWT_TOKENS_SECRET")), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != statePurpose(provider) {
+		return nil, false
+	}
+	userID, userOK := claims["user_id"].(float64)
+	actorUserID, actorOK := claims["actor_user_id"].(float64)
+	platform, platformOK := claims["platform"].(string)
+	if !userOK || !actorOK || !platformOK {
+		return nil, false
+	}
+	return &AuthState{
+		UserID:      uint(userID),
+		ActorUserID: uint(actorUserID),
+		Platform:    platform,
+	}, true
+}
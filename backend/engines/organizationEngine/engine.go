@@ -0,0 +1,100 @@
+package organizationEngine
+
+import (
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"github.com/juju/errors"
+	"gorm.io/gorm"
+)
+
+// GetMemberRole returns the role of the user in the organization, false when
+// they aren't a member.
+func GetMemberRole(organizationID uint, userID uint) (models.OrgRole, bool, error) {
+	var member models.OrganizationMember
+	rst := initializers.DB.Where("organization_id=? AND user_id=?", organizationID, userID).First(&member)
+	if rst.Error != nil {
+		if errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+			return "", false, nil
+		}
+		return "", false, rst.Error
+	}
+	return member.Role, true, nil
+}
+
+// CheckRole returns the organization when the user has at least the required
+// role in it. Non members get a not found error, so that they can't tell
+// which organizations exist.
+func CheckRole(organizationID uint, userID uint, required models.OrgRole) (*models.Organization, error) {
+	role, member, err := GetMemberRole(organizationID, userID)
+	if err != nil {
+		return nil, errors.New("Internal server error.")
+	}
+	if !member {
+		return nil, errors.NewNotFound(nil, "No organization found with the given ID.")
+	}
+	if !role.Allows(required) {
+		return nil, errors.NewForbidden(nil, "This action needs the '"+string(required)+"' role in the organization.")
+	}
+
+	var organization models.Organization
+	if rst := initializers.DB.Where("id=?", organizationID).First(&organization); rst.Error != nil {
+		return nil, errors.NewNotFound(nil, "No organization found with the given ID.")
+	}
+	return &organization, nil
+}
+
+// CheckWorkflowAccess tells if the user can use the workflow with the
+// required role, personal workflows are only reachable by their owner.
+func CheckWorkflowAccess(workflow models.Workflow, userID uint, required models.OrgRole) error {
+	if workflow.OrganizationID == nil {
+		if workflow.OwnerUserID != userID {
+			return errors.NotFound
+		}
+		return nil
+	}
+
+	role, member, err := GetMemberRole(*workflow.OrganizationID, userID)
+	if err != nil {
+		return errors.New("Internal server error.")
+	}
+	if !member {
+		return errors.NotFound
+	}
+	if !role.Allows(required) {
+		return errors.NewForbidden(nil, "This action needs the '"+string(required)+"' role in the organization.")
+	}
+	return nil
+}
+
+// ConnectionOwner returns the user owning the provider connections the user
+// is acting on: the organization's service user when an organization is
+// given, the user themselves otherwise.
+func ConnectionOwner(userID uint, organizationID uint, required models.OrgRole) (uint, error) {
+	if organizationID == 0 {
+		return userID, nil
+	}
+	organization, err := CheckRole(organizationID, userID, required)
+	if err != nil {
+		return 0, err
+	}
+	return organization.ServiceUserID, nil
+}
+
+// CheckRunAs tells if the workflow can run with the provider connections of
+// runAsUserID when set by userID. Members can only pick their own accounts
+// or the organization's, not the ones of another member.
+func CheckRunAs(workflow models.Workflow, userID uint, runAsUserID uint) error {
+	if runAsUserID == workflow.CredentialsUserID() || runAsUserID == userID {
+		return nil
+	}
+	if workflow.OrganizationID != nil {
+		var organization models.Organization
+		if rst := initializers.DB.Where("id=?", *workflow.OrganizationID).First(&organization); rst.Error != nil {
+			return errors.New("Internal server error.")
+		}
+		if runAsUserID == organization.ServiceUserID {
+			return nil
+		}
+	}
+	return errors.NewForbidden(nil, "A workflow can only run with your own provider accounts or the organization's ones.")
+}
@@ -0,0 +1,174 @@
+package schedulerEngine
+
+import (
+	"dawpitech/area/models"
+	"github.com/go-co-op/gocron/v2"
+	"github.com/google/uuid"
+	_ "github.com/joho/godotenv/autoload" // Assure that the limits are loaded before init
+	"github.com/juju/errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval is the delay between two checks of a polling trigger
+// whose workflow doesn't set one.
+const DefaultPollInterval = time.Minute
+
+// MinPollInterval and MaxPollInterval bound the interval a workflow can set,
+// so that a trigger can't exhaust the rate limits of its provider.
+const MinPollInterval = 30 * time.Second
+const MaxPollInterval = 24 * time.Hour
+
+const defaultMaxConcurrentJobs = 16
+
+// jitterDivisor spreads polling jobs over +/- a tenth of their interval so
+// that triggers registered together don't hit the providers at once.
+const jitterDivisor = 10
+
+var scheduler gocron.Scheduler
+
+var jobsMutex sync.Mutex
+var workflowJobs = make(map[uint]uuid.UUID)
+
+func init() {
+	maxConcurrentJobs := uint(defaultMaxConcurrentJobs)
+	if value, present := os.LookupEnv("SCHEDULER_MAX_CONCURRENT_JOBS"); present {
+		limit, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || limit == 0 {
+			log.Panic("SCHEDULER_MAX_CONCURRENT_JOBS must be a positive integer")
+		}
+		maxConcurrentJobs = uint(limit)
+	}
+
+	var err error
+	if scheduler, err = gocron.NewScheduler(
+		gocron.WithLimitConcurrentJobs(maxConcurrentJobs, gocron.LimitModeWait),
+	); err != nil {
+		log.Panic("Scheduler engine couldn't init a job scheduler")
+	}
+	scheduler.Start()
+}
+
+func register(ctx models.Context, definition gocron.JobDefinition, task func(models.Context)) error {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	if jobID, present := workflowJobs[ctx.WorkflowID]; present {
+		if err := scheduler.RemoveJob(jobID); err != nil && !errors.Is(err, gocron.ErrJobNotFound) {
+			return errors.New("Removal of the previous job resulted in an error. Err: " + err.Error())
+		}
+		delete(workflowJobs, ctx.WorkflowID)
+	}
+
+	job, err := scheduler.NewJob(
+		definition,
+		gocron.NewTask(task, ctx),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+		gocron.WithTags(ctx.ActionName),
+	)
+	if err != nil {
+		return errors.New("Set-up of the trigger failed, please re-try later. Err: " + err.Error())
+	}
+	workflowJobs[ctx.WorkflowID] = job.ID()
+	return nil
+}
+
+// SchedulePolling runs task about every interval for the workflow the
+// context belongs to, replacing any job already registered for it.
+func SchedulePolling(ctx models.Context, interval time.Duration, task func(models.Context)) error {
+	switch {
+	case interval <= 0:
+		interval = DefaultPollInterval
+	case interval < MinPollInterval:
+		interval = MinPollInterval
+	case interval > MaxPollInterval:
+		interval = MaxPollInterval
+	}
+	jitter := interval / jitterDivisor
+	return register(ctx, gocron.DurationRandomJob(interval-jitter, interval+jitter), task)
+}
+
+// ValidatePollInterval checks the poll interval set by a workflow, 0 picks the
+// default one.
+func ValidatePollInterval(interval time.Duration) error {
+	if interval == 0 {
+		return nil
+	}
+	if interval < MinPollInterval || interval > MaxPollInterval {
+		return errors.Errorf("Poll interval must be between %d and %d seconds.",
+			int(MinPollInterval.Seconds()), int(MaxPollInterval.Seconds()))
+	}
+	return nil
+}
+
+// ScheduleCron runs task on each tick of the crontab for the workflow the
+// context belongs to, replacing any job already registered for it.
+func ScheduleCron(ctx models.Context, crontab string, task func(models.Context)) error {
+	return register(ctx, gocron.CronJob(crontab, false), task)
+}
+
+// Submit runs task once as soon as a slot is free, it shares the limit of
+// concurrent jobs with the triggers.
+func Submit(tag string, task func()) error {
+	_, err := scheduler.NewJob(
+		gocron.OneTimeJob(gocron.OneTimeJobStartImmediately()),
+		gocron.NewTask(task),
+		gocron.WithLimitedRuns(1),
+		gocron.WithTags(tag),
+	)
+	if err != nil {
+		return errors.New("Submission of the job failed. Err: " + err.Error())
+	}
+	return nil
+}
+
+// Unschedule cancels the job of the workflow the context belongs to, doing
+// nothing if none is registered.
+func Unschedule(ctx models.Context) error {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	jobID, present := workflowJobs[ctx.WorkflowID]
+	if !present {
+		return nil
+	}
+	if err := scheduler.RemoveJob(jobID); err != nil && !errors.Is(err, gocron.ErrJobNotFound) {
+		return errors.New("Removal of given job resulted in an error. Err: " + err.Error())
+	}
+	delete(workflowJobs, ctx.WorkflowID)
+	return nil
+}
+
+type JobInfo struct {
+	WorkflowID uint
+	JobID      uuid.UUID
+	Tags       []string
+	LastRun    time.Time
+	NextRun    time.Time
+}
+
+// ListJobs returns the jobs registered on this instance.
+func ListJobs() []JobInfo {
+	jobsMutex.Lock()
+	workflowOfJob := make(map[uuid.UUID]uint, len(workflowJobs))
+	for workflowID, jobID := range workflowJobs {
+		workflowOfJob[jobID] = workflowID
+	}
+	jobsMutex.Unlock()
+
+	var jobs []JobInfo
+	for _, job := range scheduler.Jobs() {
+		info := JobInfo{
+			WorkflowID: workflowOfJob[job.ID()],
+			JobID:      job.ID(),
+			Tags:       job.Tags(),
+		}
+		info.LastRun, _ = job.LastRun()
+		info.NextRun, _ = job.NextRun()
+		jobs = append(jobs, info)
+	}
+	return jobs
+}
@@ -0,0 +1,174 @@
+package workflowEngine
+
+import (
+	"dawpitech/area/models"
+	"github.com/juju/errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func resolveOperand(operand string, ctx models.Context) (string, error) {
+	if len(operand) < 2 || operand[0] != '#' {
+		return RenderTemplate(operand, ctx.RuntimeData)
+	}
+	value, present := ctx.RuntimeData[operand[1:]]
+	if !present {
+		return "", errors.Errorf("runtime value '%s' is not available", operand[1:])
+	}
+	return value, nil
+}
+
+func compareNumbers(left string, right string) (float64, float64, error) {
+	leftNumber, err := strconv.ParseFloat(strings.TrimSpace(left), 64)
+	if err != nil {
+		return 0, 0, errors.Errorf("'%s' is not a number", left)
+	}
+	rightNumber, err := strconv.ParseFloat(strings.TrimSpace(right), 64)
+	if err != nil {
+		return 0, 0, errors.Errorf("'%s' is not a number", right)
+	}
+	return leftNumber, rightNumber, nil
+}
+
+func EvaluateCondition(condition models.Condition, ctx models.Context) (bool, error) {
+	switch condition.Operator {
+	case models.AndOperator:
+		for _, sub := range condition.Conditions {
+			rst, err := EvaluateCondition(sub, ctx)
+			if err != nil || !rst {
+				return false, err
+			}
+		}
+		return true, nil
+	case models.OrOperator:
+		for _, sub := range condition.Conditions {
+			rst, err := EvaluateCondition(sub, ctx)
+			if err != nil {
+				return false, err
+			}
+			if rst {
+				return true, nil
+			}
+		}
+		return false, nil
+	case models.NotOperator:
+		if len(condition.Conditions) != 1 {
+			return false, errors.New("'not' expects exactly one condition")
+		}
+		rst, err := EvaluateCondition(condition.Conditions[0], ctx)
+		if err != nil {
+			return false, err
+		}
+		return !rst, nil
+	}
+
+	left, err := resolveOperand(condition.Left, ctx)
+	if err != nil {
+		return false, err
+	}
+	right, err := resolveOperand(condition.Right, ctx)
+	if err != nil {
+		return false, err
+	}
+
+	switch condition.Operator {
+	case models.EqualsOperator:
+		return left == right, nil
+	case models.NotEqualsOperator:
+		return left != right, nil
+	case models.ContainsOperator:
+		return strings.Contains(left, right), nil
+	case models.NotContainsOperator:
+		return !strings.Contains(left, right), nil
+	case models.MatchesOperator:
+		pattern, err := regexp.Compile(right)
+		if err != nil {
+			return false, errors.Errorf("invalid regex '%s'", right)
+		}
+		return pattern.MatchString(left), nil
+	case models.GreaterOperator, models.GreaterOrEqualOperator, models.LowerOperator, models.LowerOrEqualOperator:
+		leftNumber, rightNumber, err := compareNumbers(left, right)
+		if err != nil {
+			return false, err
+		}
+		switch condition.Operator {
+		case models.GreaterOperator:
+			return leftNumber > rightNumber, nil
+		case models.GreaterOrEqualOperator:
+			return leftNumber >= rightNumber, nil
+		case models.LowerOperator:
+			return leftNumber < rightNumber, nil
+		default:
+			return leftNumber <= rightNumber, nil
+		}
+	}
+	return false, errors.Errorf("unknown operator '%s'", condition.Operator)
+}
+
+func isDynamicOperand(operand string) bool {
+	return (operand != "" && operand[0] == '#') || strings.Contains(operand, "{{")
+}
+
+func validateOperand(operand string, knownOutputs map[string]bool) error {
+	var references []string
+	if len(operand) >= 2 && operand[0] == '#' {
+		references = []string{operand[1:]}
+	} else {
+		var err error
+		if references, err = TemplateReferences(operand); err != nil {
+			return err
+		}
+	}
+	for _, reference := range references {
+		if !knownOutputs[reference] {
+			return errors.Errorf("condition references unknown output '%s'", reference)
+		}
+	}
+	return nil
+}
+
+// ValidateCondition checks the structure of a condition and that every
+// referenced runtime value is an output available at this point of the run.
+func ValidateCondition(condition models.Condition, knownOutputs map[string]bool) error {
+	if condition.Operator.IsLogical() {
+		if len(condition.Conditions) == 0 {
+			return errors.Errorf("'%s' expects at least one condition", condition.Operator)
+		}
+		if condition.Operator == models.NotOperator && len(condition.Conditions) != 1 {
+			return errors.New("'not' expects exactly one condition")
+		}
+		for _, sub := range condition.Conditions {
+			if err := ValidateCondition(sub, knownOutputs); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch condition.Operator {
+	case models.EqualsOperator, models.NotEqualsOperator, models.ContainsOperator, models.NotContainsOperator:
+	case models.MatchesOperator:
+		if !isDynamicOperand(condition.Right) {
+			if _, err := regexp.Compile(condition.Right); err != nil {
+				return errors.Errorf("invalid regex '%s'", condition.Right)
+			}
+		}
+	case models.GreaterOperator, models.GreaterOrEqualOperator, models.LowerOperator, models.LowerOrEqualOperator:
+		for _, operand := range []string{condition.Left, condition.Right} {
+			if isDynamicOperand(operand) {
+				continue
+			}
+			if _, err := strconv.ParseFloat(strings.TrimSpace(operand), 64); err != nil {
+				return errors.Errorf("'%s' is not a number", operand)
+			}
+		}
+	default:
+		return errors.Errorf("unknown operator '%s'", condition.Operator)
+	}
+
+	if err := validateOperand(condition.Left, knownOutputs); err != nil {
+		return err
+	}
+	return validateOperand(condition.Right, knownOutputs)
+}
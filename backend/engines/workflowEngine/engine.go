@@ -1,13 +1,17 @@
 package workflowEngine
 
 import (
+	"dawpitech/area/crypto"
+	"dawpitech/area/engines/clusterEngine"
 	"dawpitech/area/engines/logEngine"
-	"dawpitech/area/initializers"
+	"dawpitech/area/engines/schedulerEngine"
 	"dawpitech/area/models"
 	"dawpitech/area/stores"
+	"fmt"
 	"github.com/juju/errors"
-	"gorm.io/gorm"
 	"log"
+	"strings"
+	"time"
 )
 
 type HandlerType int
@@ -28,14 +32,6 @@ func ValidateWorkflow(workflow models.Workflow) (error, bool) {
 	if !actPresent {
 		return errors.New("Provided action doesnt exist."), false
 	}
-	reaction, reaPresent := stores.ReactionStore[workflow.ReactionName]
-	if !reaPresent {
-		return errors.New("Provided reaction doesnt exist."), false
-	}
-	modifier, modPresent := stores.ModifierStore[workflow.ModifierName]
-	if !modPresent {
-		return errors.New("Provided modifier doesnt exist."), false
-	}
 
 	for i := 0; i < len(action.Parameters); i++ {
 		_, ok := workflow.ActionParameters[action.Parameters[i].Name]
@@ -43,117 +39,242 @@ func ValidateWorkflow(workflow models.Workflow) (error, bool) {
 			return errors.New("Not enough parameters given to chosen action."), false
 		}
 	}
-	for i := 0; i < len(modifier.Parameters); i++ {
-		_, ok := workflow.ModifierParameters[modifier.Parameters[i].Name]
-		if !ok {
-			return errors.New("Not enough parameters given to chosen modifier."), false
-		}
+
+	if len(workflow.Steps) == 0 {
+		return errors.New("A workflow needs at least one step."), false
 	}
-	for i := 0; i < len(reaction.Parameters); i++ {
-		_, ok := workflow.ReactionParameters[reaction.Parameters[i].Name]
-		if !ok {
-			return errors.New("Not enough parameters given to chosen reaction."), false
-		}
+
+	if err := ValidateRetryPolicy(workflow.RetryPolicy); err != nil {
+		return err, false
+	}
+
+	if err := schedulerEngine.ValidatePollInterval(time.Duration(workflow.PollIntervalSeconds) * time.Second); err != nil {
+		return err, false
+	}
+
+	outputs, err := ActionOutputs(action, workflow.ActionParameters)
+	if err != nil {
+		return err, false
+	}
+	knownOutputs := make(map[string]bool)
+	for _, output := range outputs {
+		knownOutputs[output.Name] = true
+	}
+	if err := validateSteps(workflow.Steps, "", knownOutputs, make(map[string]bool)); err != nil {
+		return err, false
 	}
 
 	return nil, true
 }
 
+func withDynamicOutputs(outputs []models.Parameter, dynamic func(map[string]string) ([]models.Parameter, error), parameters map[string]string) ([]models.Parameter, error) {
+	if dynamic == nil {
+		return outputs, nil
+	}
+	dynamicOutputs, err := dynamic(parameters)
+	if err != nil {
+		return nil, err
+	}
+	allOutputs := make([]models.Parameter, 0, len(outputs)+len(dynamicOutputs))
+	allOutputs = append(allOutputs, outputs...)
+	return append(allOutputs, dynamicOutputs...), nil
+}
+
+// ActionOutputs returns every output the action gives with the parameters of
+// the workflow.
+func ActionOutputs(action models.Action, parameters map[string]string) ([]models.Parameter, error) {
+	return withDynamicOutputs(action.Outputs, action.DynamicOutputs, parameters)
+}
+
+func copyKnownOutputs(knownOutputs map[string]bool) map[string]bool {
+	branchOutputs := make(map[string]bool, len(knownOutputs))
+	for name := range knownOutputs {
+		branchOutputs[name] = true
+	}
+	return branchOutputs
+}
+
+// validateSteps checks every step in order, knownOutputs is filled along the
+// way with the outputs each step makes available to the following ones.
+func validateSteps(steps []models.WorkflowStep, labelPrefix string, knownOutputs map[string]bool, stepIDs map[string]bool) error {
+	for i, step := range steps {
+		label := fmt.Sprintf("%s#%d", labelPrefix, i+1)
+		if step.ID != "" {
+			if stepIDs[step.ID] {
+				return errors.Errorf("Step %s: id '%s' is already used by another step.", label, step.ID)
+			}
+			stepIDs[step.ID] = true
+		}
+
+		var parameters []models.Parameter
+		var outputs []models.Parameter
+		switch step.Type {
+		case models.ModifierStep:
+			modifier, modPresent := stores.ModifierStore[step.Name]
+			if !modPresent {
+				return errors.Errorf("Step %s: provided modifier doesnt exist.", label)
+			}
+			parameters = modifier.Parameters
+			var err error
+			if outputs, err = withDynamicOutputs(modifier.Outputs, modifier.DynamicOutputs, step.Parameters); err != nil {
+				return errors.Errorf("Step %s: %s", label, err.Error())
+			}
+		case models.ReactionStep:
+			reaction, reaPresent := stores.ReactionStore[step.Name]
+			if !reaPresent {
+				return errors.Errorf("Step %s: provided reaction doesnt exist.", label)
+			}
+			parameters = reaction.Parameters
+			outputs = reaction.Outputs
+		case models.FilterStep, models.BranchStep:
+			if step.Condition == nil {
+				return errors.Errorf("Step %s: a %s needs a condition.", label, step.Type)
+			}
+			if err := ValidateCondition(*step.Condition, knownOutputs); err != nil {
+				return errors.Errorf("Step %s: %s.", label, err.Error())
+			}
+			if step.Type == models.FilterStep {
+				continue
+			}
+			if len(step.Then) == 0 && len(step.Else) == 0 {
+				return errors.Errorf("Step %s: a branch needs at least one step to run.", label)
+			}
+			if err := validateSteps(step.Then, label+" then ", copyKnownOutputs(knownOutputs), stepIDs); err != nil {
+				return err
+			}
+			if err := validateSteps(step.Else, label+" else ", copyKnownOutputs(knownOutputs), stepIDs); err != nil {
+				return err
+			}
+			continue
+		default:
+			return errors.Errorf("Step %s: unknown step type '%s'.", label, step.Type)
+		}
+
+		for y := 0; y < len(parameters); y++ {
+			_, ok := step.Parameters[parameters[y].Name]
+			if !ok {
+				return errors.Errorf("Step %s: not enough parameters given to chosen %s.", label, step.Type)
+			}
+		}
+		for name, value := range step.Parameters {
+			if _, err := TemplateReferences(value); err != nil {
+				return errors.Errorf("Step %s: parameter '%s' %s.", label, name, err.Error())
+			}
+		}
+		for _, output := range outputs {
+			knownOutputs[output.Name] = true
+			if step.ID != "" {
+				knownOutputs[step.ID+"."+output.Name] = true
+			}
+		}
+	}
+	return nil
+}
+
+func NewContext(workflow models.Workflow) models.Context {
+	return models.Context{
+		OwnerUserID:       workflow.OwnerUserID,
+		CredentialsUserID: workflow.CredentialsUserID(),
+		ConnectionID:      workflow.ActionConnectionID,
+		WorkflowID:        workflow.ID,
+		ActionName:        workflow.ActionName,
+		ActionParameters:  workflow.ActionParameters,
+		Steps:             workflow.Steps,
+		RetryPolicy:       workflow.RetryPolicy,
+		CatchUp:           workflow.CatchUp,
+		PollInterval:      time.Duration(workflow.PollIntervalSeconds) * time.Second,
+		RunMode:           models.TriggeredRunMode,
+		RuntimeData:       make(map[string]string),
+	}
+}
+
+// SetupWorkflowTrigger arms the trigger of the workflow when this instance is
+// the leader, other instances leave it to the leader's reconciliation.
 func SetupWorkflowTrigger(workflow models.Workflow) (error, bool) {
+	if !clusterEngine.IsLeader() {
+		return nil, true
+	}
+	armedMutex.Lock()
+	defer armedMutex.Unlock()
+	return armWorkflowTrigger(workflow)
+}
+
+func armWorkflowTrigger(workflow models.Workflow) (error, bool) {
 	log.Printf("Workflow #%d's trigger was enable.\n", workflow.ID)
-	context := models.Context{
-		OwnerUserID:        workflow.OwnerUserID,
-		WorkflowID:         workflow.ID,
-		ActionName:         workflow.ActionName,
-		ActionParameters:   workflow.ActionParameters,
-		ModifierName:       workflow.ModifierName,
-		ModifierParameters: workflow.ModifierParameters,
-		ModifierHandler:    stores.ModifierStore[workflow.ModifierName].Handler,
-		ReactionName:       workflow.ReactionName,
-		ReactionParameters: workflow.ReactionParameters,
-		ReactionHandler:    stores.ReactionStore[workflow.ReactionName].Handler,
-	}
-	context.RuntimeData = make(map[string]string)
+	context := NewContext(workflow)
 	_, ok := stores.ActionStore[workflow.ActionName]
 	if !ok {
 		return errors.New("Provided action doesnt exist."), false
 	}
-	_, ok = stores.ReactionStore[workflow.ReactionName]
-	if !ok {
-		return errors.New("Provided reaction doesnt exist."), false
-	}
 	err := stores.ActionStore[workflow.ActionName].SetupTrigger(context)
 	if err != nil {
 		logEngine.NewLogEntry(workflow.ID, models.ErrorLog, err.Error())
 		return errors.New("Err occurred during setup of the trigger: " + err.Error()), false
 	}
+	armedWorkflows[workflow.ID] = workflow
 	return nil, true
 }
 
+// ReloadWorkflowTrigger arms the trigger of every active workflow, it is run
+// when this instance becomes the leader.
 func ReloadWorkflowTrigger() {
 	log.Printf("Reloading all workflows from DB.\n")
-	var savedWorkflows []models.Workflow
-
-	if rst := initializers.DB.Find(&savedWorkflows); rst.Error != nil {
-		if errors.Is(rst.Error, gorm.ErrRecordNotFound) {
-			log.Println("No workflows already saved, skipping re-init.")
-			return
-		}
-		log.Fatal("Couldn't re-init saved workflows, exiting..")
-	}
-
-	for i := 0; i < len(savedWorkflows); i++ {
-		if !savedWorkflows[i].Active {
-			log.Printf("Skipping workflow #%d (is not active).\n", savedWorkflows[i].ID)
-			continue
-		}
-		err, ok := SetupWorkflowTrigger(savedWorkflows[i])
-		if !ok {
-			log.Print(err.Error())
-		}
-	}
+	ReconcileWorkflowTriggers()
 }
 
+// DisableWorkflowTrigger disarms the trigger of the workflow if this instance
+// armed it.
 func DisableWorkflowTrigger(workflow models.Workflow) (error, bool) {
-	log.Printf("Workflow #%d's trigger was disable.\n", workflow.ID)
-	context := models.Context{
-		OwnerUserID:        workflow.OwnerUserID,
-		WorkflowID:         workflow.ID,
-		ActionName:         workflow.ActionName,
-		ActionParameters:   workflow.ActionParameters,
-		ModifierName:       workflow.ModifierName,
-		ModifierParameters: workflow.ModifierParameters,
-
-		ReactionName:       workflow.ReactionName,
-		ReactionParameters: workflow.ReactionParameters,
-		ReactionHandler:    stores.ReactionStore[workflow.ReactionName].Handler,
-	}
-	err := stores.ActionStore[workflow.ActionName].RemoveTrigger(context)
-	if err != nil {
+	armedMutex.Lock()
+	defer armedMutex.Unlock()
+	return disarmWorkflowTrigger(workflow.ID, false)
+}
+
+// ReleaseWorkflowTrigger removes the trigger of a workflow whose provider
+// connections are about to be deleted, on any instance, so what the trigger
+// registered on the provider, like a webhook, is removed while it still can.
+func ReleaseWorkflowTrigger(workflow models.Workflow) (error, bool) {
+	armedMutex.Lock()
+	defer armedMutex.Unlock()
+	if _, present := armedWorkflows[workflow.ID]; present {
+		return disarmWorkflowTrigger(workflow.ID, false)
+	}
+	action, ok := stores.ActionStore[workflow.ActionName]
+	if !ok {
+		return nil, true
+	}
+	if err := action.RemoveTrigger(NewContext(workflow)); err != nil {
 		return errors.New("Removal of trigger failed, please re-try later. Err: " + err.Error()), false
 	}
 	return nil, true
 }
 
-func RunWorkflow(ctx models.Context) {
-	log.Printf("Workflow #%d was triggered.\n", ctx.WorkflowID)
-	err := ctx.ModifierHandler(ctx)
-	if err != nil {
-		log.Printf("Workflow #%d failed during the modifier.\n", ctx.WorkflowID)
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Err during the modifier: "+err.Error())
-		return
+// disarmWorkflowTrigger stops the trigger of the workflow, suspend tells the
+// workflow is unchanged and only stops running on this instance.
+func disarmWorkflowTrigger(workflowID uint, suspend bool) (error, bool) {
+	armed, present := armedWorkflows[workflowID]
+	if !present {
+		return nil, true
+	}
+	log.Printf("Workflow #%d's trigger was disable.\n", workflowID)
+	context := NewContext(armed)
+	action := stores.ActionStore[armed.ActionName]
+	remove := action.RemoveTrigger
+	if suspend && action.SuspendTrigger != nil {
+		remove = action.SuspendTrigger
 	}
-	err = ctx.ReactionHandler(ctx)
+	err := remove(context)
 	if err != nil {
-		log.Printf("Workflow #%d failed during the reaction.\n", ctx.WorkflowID)
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Err during the reaction: "+err.Error())
-		return
+		return errors.New("Removal of trigger failed, please re-try later. Err: " + err.Error()), false
 	}
-	logEngine.NewLogEntry(ctx.WorkflowID, models.InfoLog, "Workflow execution was successful.")
-	log.Printf("Workflow #%d run was successful.\n", ctx.WorkflowID)
+	delete(armedWorkflows, workflowID)
+	return nil, true
 }
 
-func GetParam(hdxType HandlerType, paramName string, ctx models.Context) (string, bool) {
+// ResolveParam returns the value of a parameter once its '#name' reference
+// or {{ }} template is resolved against the runtime data. The error is set
+// when the parameter is present but couldn't be resolved.
+func ResolveParam(hdxType HandlerType, paramName string, ctx models.Context) (string, bool, error) {
 	var value string
 	var present bool
 	switch hdxType {
@@ -171,20 +292,42 @@ func GetParam(hdxType HandlerType, paramName string, ctx models.Context) (string
 	}
 
 	if !present {
-		return "", false
+		return "", false, nil
 	}
 
-	//log.Printf("Value raw (from: %s): %s\n", paramName, value)
+	if crypto.IsEncrypted(value) {
+		var err error
+		if value, err = crypto.Decrypt(value); err != nil {
+			return "", false, err
+		}
+	}
 
 	if len(value) == 0 || value == "#" {
-		return "", false
+		return "", false, nil
 	}
 
-	if value[0] == '#' {
-		value, present = ctx.RuntimeData[value[1:]]
-		//log.Printf("Value extracted (from: %s, was present: %v): %s\n", paramName[1:], present, value)
-		return value, present
+	// Legacy form, the whole parameter is a single '#name' reference.
+	if value[0] == '#' && !strings.ContainsAny(value, " {") {
+		name := value[1:]
+		value, present = ctx.RuntimeData[name]
+		if !present {
+			return "", false, errors.Errorf("runtime value '%s' is not available", name)
+		}
+		return value, true, nil
 	}
 
+	value, err := RenderTemplate(value, ctx.RuntimeData)
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func GetParam(hdxType HandlerType, paramName string, ctx models.Context) (string, bool) {
+	value, present, err := ResolveParam(hdxType, paramName, ctx)
+	if err != nil {
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, fmt.Sprintf("Couldn't resolve parameter '%s': %s", paramName, err.Error()))
+		return "", false
+	}
 	return value, present
 }
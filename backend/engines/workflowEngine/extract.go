@@ -0,0 +1,211 @@
+package workflowEngine
+
+import (
+	"bytes"
+	"dawpitech/area/models"
+	"encoding/json"
+	"fmt"
+	"github.com/juju/errors"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// BodySource is the JSON document extractions read by default, '$' is its
+// alias as the usual root of JSON paths.
+const BodySource = "body"
+
+var outputNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type pathSegment struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+// Extraction copies a value of a received or fetched document to the runtime
+// value Name, found at Path in the body or under Key in the other sources
+// (headers, query, ...).
+type Extraction struct {
+	Name   string
+	Source string
+	Key    string
+	Path   []pathSegment
+}
+
+// parseBodyPath reads the part of a path following the body, like
+// '.commits[0].id'.
+func parseBodyPath(path string) ([]pathSegment, error) {
+	var segments []pathSegment
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			end := strings.IndexAny(path[1:], ".[")
+			if end == -1 {
+				end = len(path) - 1
+			}
+			key := path[1 : end+1]
+			if key == "" {
+				return nil, errors.New("empty key")
+			}
+			segments = append(segments, pathSegment{Key: key})
+			path = path[end+1:]
+		case '[':
+			end := strings.IndexByte(path, ']')
+			if end == -1 {
+				return nil, errors.New("unclosed '['")
+			}
+			index, err := strconv.Atoi(path[1:end])
+			if err != nil || index < 0 {
+				return nil, errors.Errorf("invalid index '%s'", path[1:end])
+			}
+			segments = append(segments, pathSegment{Index: index, IsIndex: true})
+			path = path[end+1:]
+		default:
+			return nil, errors.Errorf("unexpected '%c'", path[0])
+		}
+	}
+	return segments, nil
+}
+
+func parseExtraction(entry string, keyedSources []string) (Extraction, error) {
+	name, path, found := strings.Cut(entry, "=")
+	name = strings.TrimSpace(name)
+	path = strings.TrimSpace(path)
+	if !found || path == "" {
+		return Extraction{}, errors.Errorf("Extraction '%s' isn't of the form 'name=path'.", strings.TrimSpace(entry))
+	}
+	if !outputNamePattern.MatchString(name) {
+		return Extraction{}, errors.Errorf("Extraction '%s': the name can only use letters, digits and '_'.", name)
+	}
+
+	var source, rest string
+	if path[0] == '$' {
+		source, rest = BodySource, path[1:]
+	} else if end := strings.IndexAny(path, ".["); end != -1 {
+		source, rest = path[:end], path[end:]
+	} else {
+		source = path
+	}
+
+	extraction := Extraction{Name: name, Source: source}
+	switch {
+	case source == BodySource:
+		segments, err := parseBodyPath(rest)
+		if err != nil {
+			return Extraction{}, errors.Errorf("Extraction '%s': invalid path '%s', %s.", name, path, err.Error())
+		}
+		extraction.Path = segments
+	case slices.Contains(keyedSources, source):
+		if len(rest) < 2 || rest[0] != '.' {
+			return Extraction{}, errors.Errorf("Extraction '%s': expected '%s.<name>'.", name, source)
+		}
+		extraction.Key = rest[1:]
+	default:
+		sources := append([]string{BodySource}, keyedSources...)
+		return Extraction{}, errors.Errorf("Extraction '%s': unknown source '%s', expected one of %s.", name, source, strings.Join(sources, ", "))
+	}
+	return extraction, nil
+}
+
+// ParseExtractions reads 'name=path' extractions written one per line or
+// separated with commas. Paths start with the body or one of keyedSources,
+// the names can't be one of reserved.
+func ParseExtractions(spec string, keyedSources []string, reserved []string) ([]Extraction, error) {
+	used := make(map[string]bool, len(reserved))
+	for _, name := range reserved {
+		used[name] = true
+	}
+	entries := strings.FieldsFunc(spec, func(r rune) bool {
+		return r == '\n' || r == ','
+	})
+
+	var extractions []Extraction
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		extraction, err := parseExtraction(entry, keyedSources)
+		if err != nil {
+			return nil, err
+		}
+		if used[extraction.Name] {
+			return nil, errors.Errorf("Extraction '%s': the name is already used.", extraction.Name)
+		}
+		used[extraction.Name] = true
+		extractions = append(extractions, extraction)
+	}
+	return extractions, nil
+}
+
+// ExtractionOutputs returns the outputs given by the extractions.
+func ExtractionOutputs(extractions []Extraction) []models.Parameter {
+	outputs := make([]models.Parameter, len(extractions))
+	for i, extraction := range extractions {
+		outputs[i] = models.Parameter{
+			Name:       extraction.Name,
+			PrettyName: fmt.Sprintf("Extracted value '%s'", extraction.Name),
+			Type:       models.String,
+		}
+	}
+	return outputs
+}
+
+// DecodeJSON decodes the body read by extractions, nil when it isn't JSON.
+func DecodeJSON(body []byte) interface{} {
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil
+	}
+	return document
+}
+
+// stringValue flattens a JSON value, objects and arrays are kept as JSON.
+func stringValue(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case json.Number:
+		return typed.String()
+	case bool:
+		return strconv.FormatBool(typed)
+	default:
+		encoded, err := json.Marshal(typed)
+		if err != nil {
+			return ""
+		}
+		return string(encoded)
+	}
+}
+
+// ExtractJSON returns the value at the path of the extraction in a document
+// returned by DecodeJSON.
+func (e Extraction) ExtractJSON(document interface{}) (string, bool) {
+	if document == nil {
+		return "", false
+	}
+	value := document
+	for _, segment := range e.Path {
+		if segment.IsIndex {
+			list, ok := value.([]interface{})
+			if !ok || segment.Index >= len(list) {
+				return "", false
+			}
+			value = list[segment.Index]
+			continue
+		}
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[segment.Key]; !ok {
+			return "", false
+		}
+	}
+	return stringValue(value), true
+}
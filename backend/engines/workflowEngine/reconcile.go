@@ -0,0 +1,136 @@
+package workflowEngine
+
+import (
+	"dawpitech/area/engines/clusterEngine"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A workflow can be edited on any instance while only the leader runs the
+// triggers, the leader reconciles the triggers it armed with the database on
+// a regular basis to pick up the changes made elsewhere.
+const reconcileInterval = 10 * time.Second
+
+var armedMutex sync.Mutex
+
+// armedWorkflows holds the version of each workflow whose trigger is armed on
+// this instance.
+var armedWorkflows = make(map[uint]models.Workflow)
+
+// triggersReady is set once the leader armed the triggers of the active
+// workflows, until then the events can't be matched to their workflows.
+var triggersReady atomic.Bool
+
+// failedWorkflows holds the version of each workflow whose trigger couldn't be
+// armed, it isn't retried until the workflow is edited.
+var failedWorkflows = make(map[uint]time.Time)
+
+// sameVersion compares the update dates at the precision kept by Postgres.
+func sameVersion(armed models.Workflow, saved models.Workflow) bool {
+	return armed.UpdatedAt.Truncate(time.Microsecond).Equal(saved.UpdatedAt.Truncate(time.Microsecond))
+}
+
+func StartTriggerReconciliation() {
+	go func() {
+		ticker := time.NewTicker(reconcileInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ReconcileWorkflowTriggers()
+		}
+	}()
+}
+
+// ReconcileWorkflowTriggers arms the triggers of the active workflows, re-arms
+// the edited ones and disarms the ones disabled or deleted since.
+func ReconcileWorkflowTriggers() {
+	if !clusterEngine.IsLeader() {
+		return
+	}
+
+	var activeWorkflows []models.Workflow
+	if rst := initializers.DB.Where("active = ?", true).Find(&activeWorkflows); rst.Error != nil {
+		log.Printf("Couldn't load the active workflows to reconcile triggers. Err: %s\n", rst.Error.Error())
+		return
+	}
+
+	armedMutex.Lock()
+	defer armedMutex.Unlock()
+
+	active := make(map[uint]bool, len(activeWorkflows))
+	for _, workflow := range activeWorkflows {
+		active[workflow.ID] = true
+
+		if armed, present := armedWorkflows[workflow.ID]; present {
+			if sameVersion(armed, workflow) {
+				continue
+			}
+			if err, ok := disarmWorkflowTrigger(workflow.ID, false); !ok {
+				log.Print(err.Error())
+				continue
+			}
+		}
+		if failedAt, present := failedWorkflows[workflow.ID]; present && failedAt.Equal(workflow.UpdatedAt.Truncate(time.Microsecond)) {
+			continue
+		}
+
+		if err, ok := armWorkflowTrigger(workflow); !ok {
+			log.Print(err.Error())
+			failedWorkflows[workflow.ID] = workflow.UpdatedAt.Truncate(time.Microsecond)
+			continue
+		}
+		delete(failedWorkflows, workflow.ID)
+	}
+
+	for workflowID := range armedWorkflows {
+		if active[workflowID] {
+			continue
+		}
+		if err, ok := disarmWorkflowTrigger(workflowID, false); !ok {
+			log.Print(err.Error())
+		}
+	}
+	for workflowID := range failedWorkflows {
+		if !active[workflowID] {
+			delete(failedWorkflows, workflowID)
+		}
+	}
+	triggersReady.Store(true)
+}
+
+// TriggersReady tells if this instance is the leader and armed the triggers
+// of the active workflows at least once.
+func TriggersReady() bool {
+	return triggersReady.Load() && clusterEngine.IsLeader()
+}
+
+// DisarmWorkflowTriggers disarms every trigger armed on this instance, it is
+// run when this instance loses the leadership.
+func DisarmWorkflowTriggers() {
+	armedMutex.Lock()
+	defer armedMutex.Unlock()
+	triggersReady.Store(false)
+
+	for workflowID := range armedWorkflows {
+		if err, ok := disarmWorkflowTrigger(workflowID, true); !ok {
+			log.Print(err.Error())
+			delete(armedWorkflows, workflowID)
+		}
+	}
+}
+
+// ArmedWorkflows returns the workflows whose trigger is armed on this
+// instance.
+func ArmedWorkflows() []models.Workflow {
+	armedMutex.Lock()
+	defer armedMutex.Unlock()
+
+	workflows := make([]models.Workflow, 0, len(armedWorkflows))
+	for _, workflow := range armedWorkflows {
+		workflows = append(workflows, workflow)
+	}
+	return workflows
+}
@@ -0,0 +1,109 @@
+package workflowEngine
+
+import (
+	"context"
+	"dawpitech/area/engines/oauthEngine"
+	"dawpitech/area/models"
+	"github.com/juju/errors"
+	"math"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"time"
+)
+
+const maxRetryAttempts = 10
+
+// Retries wait synchronously, in HTTP handlers for manual runs and in the
+// limited scheduler slots, so a single delay can't exceed maxRetryDelayMs.
+const maxRetryDelayMs = 5 * 60 * 1000
+
+// ClassifyError returns the class of an error returned by a handler, handlers
+// are explicit by returning a models.StepError, like the one built from the
+// status of a failed response by models.NewStatusStepError. The message of the
+// error is never looked at.
+func ClassifyError(err error) models.ErrorClass {
+	var stepErr *models.StepError
+	if errors.As(err, &stepErr) {
+		return stepErr.Class
+	}
+	if errors.Is(err, oauthEngine.ErrNeedsReauth) {
+		return models.PermanentErrorClass
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return models.TimeoutErrorClass
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return models.TimeoutErrorClass
+		}
+		return models.NetworkErrorClass
+	}
+	return models.UnknownErrorClass
+}
+
+func isRetryable(policy *models.RetryPolicy, err error) bool {
+	class := ClassifyError(err)
+	if class == models.PermanentErrorClass {
+		return false
+	}
+	return slices.Contains(policy.RetryOn, models.AnyErrorClass) || slices.Contains(policy.RetryOn, class)
+}
+
+// retryDelay returns how long to wait before the given attempt (starting at 2).
+func retryDelay(policy *models.RetryPolicy, attempt int) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(policy.InitialDelayMs) * math.Pow(multiplier, float64(attempt-2))
+	if policy.MaxDelayMs > 0 && delay > float64(policy.MaxDelayMs) {
+		delay = float64(policy.MaxDelayMs)
+	}
+	if delay > maxRetryDelayMs {
+		delay = maxRetryDelayMs
+	}
+	delay -= delay * min(max(policy.Jitter, 0), 1) * rand.Float64()
+	return time.Duration(delay) * time.Millisecond
+}
+
+func maxAttempts(policy *models.RetryPolicy) int {
+	if policy == nil || policy.MaxAttempts < 1 {
+		return 1
+	}
+	return min(policy.MaxAttempts, maxRetryAttempts)
+}
+
+func ValidateRetryPolicy(policy *models.RetryPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.MaxAttempts < 1 || policy.MaxAttempts > maxRetryAttempts {
+		return errors.Errorf("Retry policy: max attempts must be between 1 and %d.", maxRetryAttempts)
+	}
+	if policy.InitialDelayMs < 0 || policy.MaxDelayMs < 0 {
+		return errors.New("Retry policy: delays can't be negative.")
+	}
+	if policy.InitialDelayMs > maxRetryDelayMs || policy.MaxDelayMs > maxRetryDelayMs {
+		return errors.Errorf("Retry policy: delays can't exceed %d ms.", maxRetryDelayMs)
+	}
+	if policy.Multiplier > 1 && policy.MaxDelayMs == 0 {
+		return errors.New("Retry policy: a max delay is required when the multiplier is greater than 1.")
+	}
+	if policy.MaxDelayMs > 0 && policy.MaxDelayMs < policy.InitialDelayMs {
+		return errors.New("Retry policy: max delay must be greater than the initial delay.")
+	}
+	if policy.Multiplier != 0 && policy.Multiplier < 1 {
+		return errors.New("Retry policy: multiplier must be at least 1.")
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return errors.New("Retry policy: jitter must be between 0 and 1.")
+	}
+	for _, class := range policy.RetryOn {
+		if !slices.Contains(models.RetryableErrorClasses, class) {
+			return errors.Errorf("Retry policy: unknown error class '%s'.", class)
+		}
+	}
+	return nil
+}
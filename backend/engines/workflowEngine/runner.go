@@ -0,0 +1,354 @@
+package workflowEngine
+
+import (
+	"dawpitech/area/engines/logEngine"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"dawpitech/area/stores"
+	"fmt"
+	"github.com/juju/errors"
+	"log"
+	"strconv"
+	"time"
+)
+
+// ErrSkippedInDryRun is returned by the modifiers which would change external
+// state during a dry run, the step is then marked as skipped.
+var ErrSkippedInDryRun = errors.New("The step is skipped by a dry run.")
+
+func copyRuntimeData(data map[string]string) map[string]string {
+	dataCopy := make(map[string]string, len(data))
+	for key, value := range data {
+		dataCopy[key] = value
+	}
+	return dataCopy
+}
+
+// changedRuntimeData returns the runtime values set or modified since the
+// before snapshot was taken.
+func changedRuntimeData(before map[string]string, after map[string]string) map[string]string {
+	changed := make(map[string]string)
+	for key, value := range after {
+		if previous, present := before[key]; !present || previous != value {
+			changed[key] = value
+		}
+	}
+	return changed
+}
+
+// stepContext returns a copy of ctx set up to run the given step, the runtime
+// data map is shared so outputs of a step are visible to the following ones.
+func stepContext(ctx models.Context, step models.WorkflowStep) (models.Context, []models.Parameter, bool) {
+	stepCtx := ctx
+	stepCtx.ConnectionID = step.ConnectionID
+	switch step.Type {
+	case models.ModifierStep:
+		modifier, ok := stores.ModifierStore[step.Name]
+		if !ok {
+			return stepCtx, nil, false
+		}
+		stepCtx.ModifierName = step.Name
+		stepCtx.ModifierParameters = step.Parameters
+		stepCtx.ModifierHandler = modifier.Handler
+		// The step was validated when saved, its outputs can be computed.
+		outputs, err := withDynamicOutputs(modifier.Outputs, modifier.DynamicOutputs, step.Parameters)
+		if err != nil {
+			outputs = modifier.Outputs
+		}
+		return stepCtx, outputs, true
+	case models.ReactionStep:
+		reaction, ok := stores.ReactionStore[step.Name]
+		if !ok {
+			return stepCtx, nil, false
+		}
+		stepCtx.ReactionName = step.Name
+		stepCtx.ReactionParameters = step.Parameters
+		stepCtx.ReactionHandler = reaction.Handler
+		return stepCtx, reaction.Outputs, true
+	}
+	return stepCtx, nil, false
+}
+
+// resolvedParameters returns the parameters of a step as its handler will
+// see them, unresolvable ones are kept raw and sensitive ones are masked.
+func resolvedParameters(ctx models.Context, step models.WorkflowStep) map[string]string {
+	hdxType := HandlerType(ModifierHandler)
+	if step.Type == models.ReactionStep {
+		hdxType = ReactionHandler
+	}
+	sensitive := sensitiveParameterNames(stepParameterDefinitions(step))
+	parameters := make(map[string]string, len(step.Parameters))
+	for name, raw := range step.Parameters {
+		if sensitive[name] {
+			parameters[name] = maskedValue
+			continue
+		}
+		value, present, err := ResolveParam(hdxType, name, ctx)
+		if err != nil || !present {
+			value = raw
+		}
+		parameters[name] = value
+	}
+	return parameters
+}
+
+func runStep(ctx models.Context, step models.WorkflowStep, trace *models.StepTrace) error {
+	stepCtx, outputs, ok := stepContext(ctx, step)
+	if !ok {
+		return errors.Errorf("unknown %s '%s'", step.Type, step.Name)
+	}
+	trace.Parameters = resolvedParameters(stepCtx, step)
+	before := copyRuntimeData(ctx.RuntimeData)
+
+	// A dry run resolves the parameters of reactions without calling them,
+	// the modifiers changing external state skip themselves.
+	if step.Type == models.ReactionStep && ctx.RunMode == models.DryRunMode {
+		trace.Skipped = true
+		return nil
+	}
+
+	handler := stepCtx.ModifierHandler
+	attempts := 1
+	if step.Type == models.ReactionStep {
+		handler = stepCtx.ReactionHandler
+		attempts = maxAttempts(ctx.RetryPolicy)
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		trace.Attempts = attempt
+		err = handler(stepCtx)
+		if errors.Is(err, ErrSkippedInDryRun) && ctx.RunMode == models.DryRunMode {
+			trace.Skipped = true
+			return nil
+		}
+		if err == nil || attempt >= attempts || !isRetryable(ctx.RetryPolicy, err) {
+			break
+		}
+		delay := retryDelay(ctx.RetryPolicy, attempt+1)
+		logEngine.NewContextLogEntry(ctx, models.WarnLog, fmt.Sprintf(
+			"Attempt %d/%d of step %s failed (%s), retrying in %s.", attempt, attempts, trace.Label, err.Error(), delay.Round(time.Millisecond)))
+		time.Sleep(delay)
+	}
+	if err != nil {
+		return err
+	}
+
+	if step.ID != "" {
+		for _, output := range outputs {
+			if value, present := ctx.RuntimeData[output.Name]; present {
+				ctx.RuntimeData[step.ID+"."+output.Name] = value
+			}
+		}
+	}
+	trace.Outputs = changedRuntimeData(before, ctx.RuntimeData)
+	return nil
+}
+
+// runSteps runs the given steps in order, it returns false when a filter
+// stopped the run.
+func runSteps(ctx models.Context, steps []models.WorkflowStep, labelPrefix string, run *models.WorkflowRun) (bool, error) {
+	for i, step := range steps {
+		label := fmt.Sprintf("%s#%d", labelPrefix, i+1)
+		trace := models.StepTrace{
+			Label:     label,
+			Type:      step.Type,
+			Name:      step.Name,
+			StartedAt: time.Now(),
+		}
+
+		switch step.Type {
+		case models.FilterStep, models.BranchStep:
+			if step.Condition == nil {
+				return false, errors.Errorf("Err during step %s: missing condition", label)
+			}
+			rst, err := EvaluateCondition(*step.Condition, ctx)
+			trace.DurationMs = time.Since(trace.StartedAt).Milliseconds()
+			if err != nil {
+				trace.Error = err.Error()
+				run.Steps = append(run.Steps, trace)
+				return false, errors.Errorf("Err during step %s (%s): %s", label, step.Type, err.Error())
+			}
+			trace.Outputs = map[string]string{"result": strconv.FormatBool(rst)}
+			run.Steps = append(run.Steps, trace)
+
+			if step.Type == models.FilterStep {
+				if !rst {
+					logEngine.NewContextLogEntry(ctx, models.InfoLog, fmt.Sprintf("Workflow run stopped: condition of step %s was not met.", label))
+					return false, nil
+				}
+				continue
+			}
+
+			branch, branchLabel := step.Else, label+" else "
+			if rst {
+				branch, branchLabel = step.Then, label+" then "
+			}
+			if completed, err := runSteps(ctx, branch, branchLabel, run); !completed || err != nil {
+				return completed, err
+			}
+		default:
+			err := runStep(ctx, step, &trace)
+			trace.DurationMs = time.Since(trace.StartedAt).Milliseconds()
+			if err != nil {
+				trace.Error = err.Error()
+			}
+			run.Steps = append(run.Steps, trace)
+			if err != nil {
+				return false, errors.Errorf("Err during step %s (%s '%s'): %s", label, step.Type, step.Name, err.Error())
+			}
+		}
+	}
+	return true, nil
+}
+
+func saveRun(run *models.WorkflowRun) {
+	if rst := initializers.DB.Save(run); rst.Error != nil {
+		log.Printf("Couldn't save run of workflow #%d. Err: %s\n", run.WorkflowID, rst.Error.Error())
+	}
+}
+
+// deadLetter saves a run that failed on a reaction, along with the runtime
+// data the reaction saw, so the failed reaction alone can be replayed later.
+func deadLetter(run models.WorkflowRun, runtimeData map[string]string) {
+	if len(run.Steps) == 0 || run.Mode == models.DryRunMode {
+		return
+	}
+	failedStep := run.Steps[len(run.Steps)-1]
+	if failedStep.Type != models.ReactionStep || failedStep.Error == "" {
+		return
+	}
+
+	letter := models.DeadLetter{
+		WorkflowID:  run.WorkflowID,
+		OwnerUserID: run.OwnerUserID,
+		RunID:       run.ID,
+		TriggerData: run.TriggerData,
+		RuntimeData: runtimeData,
+		StepLabel:   failedStep.Label,
+		FailedStep:  fmt.Sprintf("%s (%s)", failedStep.Label, failedStep.Name),
+		Error:       failedStep.Error,
+		Attempts:    failedStep.Attempts,
+	}
+	if rst := initializers.DB.Create(&letter); rst.Error != nil {
+		log.Printf("Couldn't dead-letter run #%d of workflow #%d. Err: %s\n", run.ID, run.WorkflowID, rst.Error.Error())
+	}
+}
+
+// findStep returns the step with the given run trace label.
+func findStep(steps []models.WorkflowStep, labelPrefix string, label string) (models.WorkflowStep, bool) {
+	for i, step := range steps {
+		stepLabel := fmt.Sprintf("%s#%d", labelPrefix, i+1)
+		if stepLabel == label {
+			return step, true
+		}
+		if found, ok := findStep(step.Then, stepLabel+" then ", label); ok {
+			return found, true
+		}
+		if found, ok := findStep(step.Else, stepLabel+" else ", label); ok {
+			return found, true
+		}
+	}
+	return models.WorkflowStep{}, false
+}
+
+// finishRun saves the outcome of a run and logs it.
+func finishRun(ctx models.Context, run *models.WorkflowRun, completed bool, err error) {
+	run.FinishedAt = time.Now()
+	switch {
+	case err != nil:
+		run.Status = models.FailedRun
+		run.Error = err.Error()
+	case !completed:
+		run.Status = models.StoppedRun
+	default:
+		run.Status = models.SuccessRun
+	}
+	saveRun(run)
+
+	switch run.Status {
+	case models.FailedRun:
+		log.Printf("Workflow #%d failed: %s\n", ctx.WorkflowID, err.Error())
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
+		deadLetter(*run, ctx.RuntimeData)
+	case models.StoppedRun:
+		log.Printf("Workflow #%d run was stopped by a filter.\n", ctx.WorkflowID)
+	case models.SuccessRun:
+		if ctx.RunMode == models.DryRunMode {
+			logEngine.NewContextLogEntry(ctx, models.InfoLog, "Dry run of the workflow was successful.")
+			break
+		}
+		logEngine.NewContextLogEntry(ctx, models.InfoLog, "Workflow execution was successful.")
+		log.Printf("Workflow #%d run was successful.\n", ctx.WorkflowID)
+	}
+}
+
+// ExecuteWorkflow runs every step of the workflow and returns the recorded run.
+func ExecuteWorkflow(ctx models.Context) models.WorkflowRun {
+	log.Printf("Workflow #%d was triggered.\n", ctx.WorkflowID)
+	// The trigger context is reused between runs, each run gets its own copy
+	// of the runtime data.
+	ctx.RuntimeData = copyRuntimeData(ctx.RuntimeData)
+
+	if ctx.RunMode == "" {
+		ctx.RunMode = models.TriggeredRunMode
+	}
+
+	run := models.WorkflowRun{
+		WorkflowID:  ctx.WorkflowID,
+		OwnerUserID: ctx.OwnerUserID,
+		Mode:        ctx.RunMode,
+		TriggeredAt: time.Now(),
+		Status:      models.RunningRun,
+		TriggerData: copyRuntimeData(ctx.RuntimeData),
+	}
+	saveRun(&run)
+	ctx.RunID = run.ID
+
+	completed, err := runSteps(ctx, ctx.Steps, "", &run)
+	finishRun(ctx, &run, completed, err)
+	return run
+}
+
+// ReplayStep runs again the reaction of a dead-lettered run, with the runtime
+// data it failed with, so the steps which already succeeded aren't repeated.
+func ReplayStep(ctx models.Context, label string, runtimeData map[string]string) (models.WorkflowRun, error) {
+	step, ok := findStep(ctx.Steps, "", label)
+	if !ok || step.Type != models.ReactionStep {
+		return models.WorkflowRun{}, errors.Errorf("The workflow has no reaction step %s anymore.", label)
+	}
+	log.Printf("Step %s of workflow #%d is replayed.\n", label, ctx.WorkflowID)
+	ctx.RuntimeData = copyRuntimeData(runtimeData)
+	ctx.RunMode = models.ReplayRunMode
+
+	run := models.WorkflowRun{
+		WorkflowID:  ctx.WorkflowID,
+		OwnerUserID: ctx.OwnerUserID,
+		Mode:        ctx.RunMode,
+		TriggeredAt: time.Now(),
+		Status:      models.RunningRun,
+		TriggerData: copyRuntimeData(ctx.RuntimeData),
+	}
+	saveRun(&run)
+	ctx.RunID = run.ID
+
+	trace := models.StepTrace{
+		Label:     label,
+		Type:      step.Type,
+		Name:      step.Name,
+		StartedAt: time.Now(),
+	}
+	err := runStep(ctx, step, &trace)
+	trace.DurationMs = time.Since(trace.StartedAt).Milliseconds()
+	if err != nil {
+		trace.Error = err.Error()
+		err = errors.Errorf("Err during step %s (%s '%s'): %s", label, step.Type, step.Name, err.Error())
+	}
+	run.Steps = append(run.Steps, trace)
+	finishRun(ctx, &run, true, err)
+	return run, nil
+}
+
+func RunWorkflow(ctx models.Context) {
+	ExecuteWorkflow(ctx)
+}
@@ -0,0 +1,120 @@
+package workflowEngine
+
+import (
+	"dawpitech/area/crypto"
+	"dawpitech/area/models"
+	"dawpitech/area/stores"
+	"log"
+)
+
+// maskedValue replaces the sensitive parameters in the run traces.
+const maskedValue = "********"
+
+func stepParameterDefinitions(step models.WorkflowStep) []models.Parameter {
+	switch step.Type {
+	case models.ModifierStep:
+		return stores.ModifierStore[step.Name].Parameters
+	case models.ReactionStep:
+		return stores.ReactionStore[step.Name].Parameters
+	}
+	return nil
+}
+
+func sensitiveParameterNames(definitions []models.Parameter) map[string]bool {
+	sensitive := make(map[string]bool)
+	for _, definition := range definitions {
+		if definition.Sensitive {
+			sensitive[definition.Name] = true
+		}
+	}
+	return sensitive
+}
+
+func transformParameters(parameters map[string]string, sensitive map[string]bool, transform func(string) (string, error)) (map[string]string, error) {
+	if parameters == nil {
+		return nil, nil
+	}
+	transformed := make(map[string]string, len(parameters))
+	for name, value := range parameters {
+		if sensitive[name] && value != "" {
+			var err error
+			if value, err = transform(value); err != nil {
+				return nil, err
+			}
+		}
+		transformed[name] = value
+	}
+	return transformed, nil
+}
+
+func transformSteps(steps []models.WorkflowStep, transform func(string) (string, error)) ([]models.WorkflowStep, error) {
+	if steps == nil {
+		return nil, nil
+	}
+	transformed := make([]models.WorkflowStep, len(steps))
+	for i, step := range steps {
+		var err error
+		if step.Parameters, err = transformParameters(step.Parameters, sensitiveParameterNames(stepParameterDefinitions(step)), transform); err != nil {
+			return nil, err
+		}
+		if step.Then, err = transformSteps(step.Then, transform); err != nil {
+			return nil, err
+		}
+		if step.Else, err = transformSteps(step.Else, transform); err != nil {
+			return nil, err
+		}
+		transformed[i] = step
+	}
+	return transformed, nil
+}
+
+// transformSensitiveParameters applies transform to every sensitive parameter
+// of the workflow, the parameters are copied so the workflow is left as is.
+func transformSensitiveParameters(workflow models.Workflow, transform func(string) (string, error)) (models.Workflow, error) {
+	var err error
+	actionSensitive := sensitiveParameterNames(stores.ActionStore[workflow.ActionName].Parameters)
+	if workflow.ActionParameters, err = transformParameters(workflow.ActionParameters, actionSensitive, transform); err != nil {
+		return workflow, err
+	}
+	if workflow.Steps, err = transformSteps(workflow.Steps, transform); err != nil {
+		return workflow, err
+	}
+	return workflow, nil
+}
+
+// SealSensitiveParameters encrypts the sensitive parameters of the workflow
+// with the active master key before it is saved.
+func SealSensitiveParameters(workflow *models.Workflow) error {
+	sealed, err := transformSensitiveParameters(*workflow, crypto.Reencrypt)
+	if err != nil {
+		return err
+	}
+	*workflow = sealed
+	return nil
+}
+
+// UnsealSensitiveParameters returns the workflow with its sensitive parameters
+// decrypted, the ones that can't be are left encrypted.
+func UnsealSensitiveParameters(workflow models.Workflow) models.Workflow {
+	unsealed, err := transformSensitiveParameters(workflow, func(value string) (string, error) {
+		plaintext, err := crypto.Decrypt(value)
+		if err != nil {
+			log.Printf("Couldn't decrypt a parameter of workflow #%d. Err: %s\n", workflow.ID, err.Error())
+			return value, nil
+		}
+		return plaintext, nil
+	})
+	if err != nil {
+		return workflow
+	}
+	return unsealed
+}
+
+// MaskSensitiveParameters returns the workflow with its sensitive parameters
+// replaced by a placeholder, for the places they must not be shown.
+func MaskSensitiveParameters(workflow models.Workflow) models.Workflow {
+	masked, _ := transformSensitiveParameters(workflow, func(string) (string, error) {
+		return maskedValue, nil
+	})
+	return masked
+}
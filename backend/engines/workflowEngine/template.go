@@ -0,0 +1,282 @@
+package workflowEngine
+
+import (
+	"encoding/json"
+	"github.com/juju/errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Templates interpolate runtime values inside parameters using the
+// {{ name | filter | filter:"argument" }} syntax. A quoted string can be used
+// instead of a name to output a literal, e.g. {{ "{{" }}.
+
+type templateFilter struct {
+	Name     string
+	Argument string
+	HasArg   bool
+}
+
+type templateExpression struct {
+	Variable string
+	Literal  bool
+	Filters  []templateFilter
+}
+
+type templateFilterFunc func(value string, present bool, filter templateFilter) (string, bool, error)
+
+var templateFilters = map[string]templateFilterFunc{
+	"default":  filterDefault,
+	"upper":    filterUpper,
+	"lower":    filterLower,
+	"trim":     filterTrim,
+	"truncate": filterTruncate,
+	"json":     filterJSONEscape,
+	"date":     filterDate,
+}
+
+var templateDateLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func filterDefault(value string, present bool, filter templateFilter) (string, bool, error) {
+	if present && value != "" {
+		return value, true, nil
+	}
+	return filter.Argument, true, nil
+}
+
+func filterUpper(value string, present bool, _ templateFilter) (string, bool, error) {
+	return strings.ToUpper(value), present, nil
+}
+
+func filterLower(value string, present bool, _ templateFilter) (string, bool, error) {
+	return strings.ToLower(value), present, nil
+}
+
+func filterTrim(value string, present bool, _ templateFilter) (string, bool, error) {
+	return strings.TrimSpace(value), present, nil
+}
+
+func filterTruncate(value string, present bool, filter templateFilter) (string, bool, error) {
+	length, err := strconv.Atoi(filter.Argument)
+	if err != nil || length < 0 {
+		return "", false, errors.Errorf("truncate expects a positive length, got '%s'", filter.Argument)
+	}
+	if utf8.RuneCountInString(value) <= length {
+		return value, present, nil
+	}
+	return string([]rune(value)[:length]), present, nil
+}
+
+func filterJSONEscape(value string, present bool, _ templateFilter) (string, bool, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", false, err
+	}
+	return string(encoded[1 : len(encoded)-1]), present, nil
+}
+
+func filterDate(value string, present bool, filter templateFilter) (string, bool, error) {
+	if !present {
+		return value, present, nil
+	}
+	layout := filter.Argument
+	if !filter.HasArg {
+		layout = time.RFC3339
+	}
+
+	if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(timestamp, 0).Format(layout), true, nil
+	}
+	for _, inputLayout := range templateDateLayouts {
+		if date, err := time.Parse(inputLayout, value); err == nil {
+			return date.Format(layout), true, nil
+		}
+	}
+	return "", false, errors.Errorf("'%s' is not a valid date", value)
+}
+
+// splitTemplateExpression splits the content of {{ }} on the pipes that are
+// not part of a quoted argument.
+func splitTemplateExpression(content string) ([]string, error) {
+	var parts []string
+	var current strings.Builder
+	inQuotes := false
+	for i := 0; i < len(content); i++ {
+		char := content[i]
+		switch {
+		case char == '\\' && inQuotes && i+1 < len(content):
+			current.WriteByte(char)
+			current.WriteByte(content[i+1])
+			i++
+		case char == '"':
+			inQuotes = !inQuotes
+			current.WriteByte(char)
+		case char == '|' && !inQuotes:
+			parts = append(parts, strings.TrimSpace(current.String()))
+			current.Reset()
+		default:
+			current.WriteByte(char)
+		}
+	}
+	if inQuotes {
+		return nil, errors.New("unterminated quoted string")
+	}
+	return append(parts, strings.TrimSpace(current.String())), nil
+}
+
+func unquoteTemplateString(raw string) (string, error) {
+	value, err := strconv.Unquote(raw)
+	if err != nil {
+		return "", errors.Errorf("invalid quoted string %s", raw)
+	}
+	return value, nil
+}
+
+func parseTemplateExpression(content string) (templateExpression, error) {
+	parts, err := splitTemplateExpression(content)
+	if err != nil {
+		return templateExpression{}, err
+	}
+
+	var expression templateExpression
+	if parts[0] == "" {
+		return expression, errors.New("empty expression")
+	}
+	if parts[0][0] == '"' {
+		if expression.Variable, err = unquoteTemplateString(parts[0]); err != nil {
+			return expression, err
+		}
+		expression.Literal = true
+	} else {
+		expression.Variable = parts[0]
+	}
+
+	for _, part := range parts[1:] {
+		name, argument, hasArg := strings.Cut(part, ":")
+		filter := templateFilter{
+			Name:   strings.TrimSpace(name),
+			HasArg: hasArg,
+		}
+		if _, ok := templateFilters[filter.Name]; !ok {
+			return expression, errors.Errorf("unknown filter '%s'", filter.Name)
+		}
+		if hasArg {
+			argument = strings.TrimSpace(argument)
+			if len(argument) > 0 && argument[0] == '"' {
+				if argument, err = unquoteTemplateString(argument); err != nil {
+					return expression, err
+				}
+			}
+			filter.Argument = argument
+		}
+		expression.Filters = append(expression.Filters, filter)
+	}
+	return expression, nil
+}
+
+// parseTemplate splits a template in raw text chunks and expressions, the
+// two returned slices are interleaved: text[0] expr[0] text[1] ... text[n].
+func parseTemplate(template string) ([]string, []templateExpression, error) {
+	var texts []string
+	var expressions []templateExpression
+	rest := template
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			texts = append(texts, rest)
+			return texts, expressions, nil
+		}
+		end := strings.Index(rest[start+2:], "}}")
+		if end < 0 {
+			return nil, nil, errors.New("template has an unclosed '{{'")
+		}
+		expression, err := parseTemplateExpression(rest[start+2 : start+2+end])
+		if err != nil {
+			return nil, nil, errors.Errorf("invalid template expression '%s': %s", rest[start:start+4+end], err.Error())
+		}
+		texts = append(texts, rest[:start])
+		expressions = append(expressions, expression)
+		rest = rest[start+4+end:]
+	}
+}
+
+func (expression templateExpression) evaluate(data map[string]string) (string, error) {
+	value, present := expression.Variable, true
+	if !expression.Literal {
+		value, present = data[expression.Variable]
+	}
+
+	var err error
+	for _, filter := range expression.Filters {
+		value, present, err = templateFilters[filter.Name](value, present, filter)
+		if err != nil {
+			return "", errors.Errorf("filter '%s' on '%s' failed: %s", filter.Name, expression.Variable, err.Error())
+		}
+	}
+	if !present {
+		return "", errors.Errorf("runtime value '%s' is not available", expression.Variable)
+	}
+	return value, nil
+}
+
+// RenderTemplate interpolates every {{ }} expression of the template with the
+// given runtime data. Referencing a missing value without a default filter
+// results in an error.
+func RenderTemplate(template string, data map[string]string) (string, error) {
+	if !strings.Contains(template, "{{") {
+		return template, nil
+	}
+	texts, expressions, err := parseTemplate(template)
+	if err != nil {
+		return "", err
+	}
+
+	var rendered strings.Builder
+	for i, expression := range expressions {
+		rendered.WriteString(texts[i])
+		value, err := expression.evaluate(data)
+		if err != nil {
+			return "", err
+		}
+		rendered.WriteString(value)
+	}
+	rendered.WriteString(texts[len(texts)-1])
+	return rendered.String(), nil
+}
+
+// TemplateReferences returns the runtime values required by a template,
+// values guarded by a default filter are not considered required.
+func TemplateReferences(template string) ([]string, error) {
+	if !strings.Contains(template, "{{") {
+		return nil, nil
+	}
+	_, expressions, err := parseTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	var references []string
+	for _, expression := range expressions {
+		if expression.Literal {
+			continue
+		}
+		hasDefault := false
+		for _, filter := range expression.Filters {
+			if filter.Name == "default" {
+				hasDefault = true
+			}
+		}
+		if !hasDefault {
+			references = append(references, expression.Variable)
+		}
+	}
+	return references, nil
+}
@@ -0,0 +1,51 @@
+package workflowEngine
+
+import (
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"github.com/juju/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+)
+
+// GetTriggerState returns the value saved under key by the trigger of the
+// workflow the context belongs to.
+func GetTriggerState(ctx models.Context, key string) (string, bool) {
+	var state models.TriggerState
+	rst := initializers.DB.
+		Where("workflow_id=? AND trigger_name=? AND key=?", ctx.WorkflowID, ctx.ActionName, key).
+		First(&state)
+	if rst.Error != nil {
+		if !errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+			log.Printf("Couldn't load trigger state '%s' of workflow #%d. Err: %s\n", key, ctx.WorkflowID, rst.Error.Error())
+		}
+		return "", false
+	}
+	return state.Value, true
+}
+
+func SetTriggerState(ctx models.Context, key string, value string) error {
+	state := models.TriggerState{
+		WorkflowID:  ctx.WorkflowID,
+		TriggerName: ctx.ActionName,
+		Key:         key,
+		Value:       value,
+	}
+	rst := initializers.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "workflow_id"}, {Name: "trigger_name"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&state)
+	if rst.Error != nil {
+		log.Printf("Couldn't save trigger state '%s' of workflow #%d. Err: %s\n", key, ctx.WorkflowID, rst.Error.Error())
+		return rst.Error
+	}
+	return nil
+}
+
+// ClearTriggerStates forgets every cursor saved for a workflow.
+func ClearTriggerStates(workflowID uint) {
+	if rst := initializers.DB.Unscoped().Where("workflow_id=?", workflowID).Delete(&models.TriggerState{}); rst.Error != nil {
+		log.Printf("Couldn't clear trigger states of workflow #%d. Err: %s\n", workflowID, rst.Error.Error())
+	}
+}
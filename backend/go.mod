@@ -14,6 +14,7 @@ require (
 	github.com/juju/errors v1.0.0
 	github.com/loopfz/gadgeto v0.11.5
 	github.com/openai/openai-go v1.12.0
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/wI2L/fizz v0.23.0
 	golang.org/x/crypto v0.47.0
 	golang.org/x/net v0.48.0
@@ -68,7 +69,6 @@ require (
 	github.com/quic-go/qpack v0.6.0 // indirect
 	github.com/quic-go/quic-go v0.57.1 // indirect
 	github.com/redis/go-redis/v9 v9.7.3 // indirect
-	github.com/robfig/cron/v3 v3.0.1 // indirect
 	github.com/tidwall/gjson v1.14.4 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
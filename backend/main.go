@@ -1,6 +1,9 @@
 package main
 
 import (
+	"dawpitech/area/crypto"
+	"dawpitech/area/engines/clusterEngine"
+	"dawpitech/area/engines/eventEngine"
 	"dawpitech/area/engines/workflowEngine"
 	"dawpitech/area/initializers"
 	"dawpitech/area/services"
@@ -15,9 +18,14 @@ import (
 
 func init() {
 	initializers.LoadEnvironment()
+	if err := crypto.LoadMasterKeys(); err != nil {
+		log.Fatal("Couldn't load the encryption keys: " + err.Error())
+	}
 	initializers.ConnectDB()
 	services.Init()
-	workflowEngine.ReloadWorkflowTrigger()
+	clusterEngine.Start(workflowEngine.ReloadWorkflowTrigger, workflowEngine.DisarmWorkflowTriggers)
+	workflowEngine.StartTriggerReconciliation()
+	eventEngine.Start()
 }
 
 func main() {
@@ -0,0 +1,78 @@
+package middlewares
+
+import (
+	"dawpitech/area/crypto"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// checkAPIToken authenticates a request made with an API token, formatted as
+// area_<prefix>_<secret>.
+func checkAPIToken(c *gin.Context, tokenString string, scope models.APIScope) {
+	prefix, secret, found := strings.Cut(strings.TrimPrefix(tokenString, models.APITokenPrefix), "_")
+	if !found || prefix == "" || secret == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
+		return
+	}
+
+	var apiToken models.APIToken
+	rst := initializers.DB.Where("prefix=?", prefix).First(&apiToken)
+	if rst.Error != nil {
+		if errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+
+	match, err := crypto.ValidateHash(secret, apiToken.SecretHash)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+	if !match || apiToken.IsExpired() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	if scope == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This route can't be used with an API token"})
+		return
+	}
+	if !apiToken.HasScope(scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "The API token lacks the '" + string(scope) + "' scope"})
+		return
+	}
+
+	var user models.User
+	rst = initializers.DB.Where("id=?", apiToken.UserID).First(&user)
+	if rst.Error != nil {
+		if errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+
+	if user.DisabledAt != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+		return
+	}
+
+	if rst := initializers.DB.Model(&apiToken).UpdateColumn("last_used_at", time.Now()); rst.Error != nil {
+		log.Print("Couldn't save the last use of an API token. Err: " + rst.Error.Error())
+	}
+
+	c.Set("user", user)
+	c.Set("api_token", apiToken)
+	c.Next()
+}
@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"dawpitech/area/utils"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// CheckAdmin must run after CheckAuth, it only lets the admins through.
+func CheckAdmin(c *gin.Context) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is missing"})
+		return
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok || !user.IsAdmin {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This route is reserved to the admins"})
+		return
+	}
+	c.Next()
+}
@@ -14,7 +14,20 @@ import (
 	"time"
 )
 
+// CheckAuth only accepts the session tokens.
 func CheckAuth(c *gin.Context) {
+	authenticate(c, "")
+}
+
+// CheckAuthScope accepts the session tokens and the API tokens granted the
+// given scope.
+func CheckAuthScope(scope models.APIScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authenticate(c, scope)
+	}
+}
+
+func authenticate(c *gin.Context, scope models.APIScope) {
 	authHeader := c.GetHeader("Authorization")
 
 	if authHeader == "" {
@@ -29,6 +42,11 @@ func CheckAuth(c *gin.Context) {
 	}
 
 	tokenString := authToken[1]
+	if strings.HasPrefix(tokenString, models.APITokenPrefix) {
+		checkAPIToken(c, tokenString, scope)
+		return
+	}
+
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -52,8 +70,24 @@ func CheckAuth(c *gin.Context) {
 		return
 	}
 
+	var session models.Session
+	rst := initializers.DB.Where("id=? AND user_id=?", claims["session_id"], claims["user_id"]).First(&session)
+	if rst.Error != nil {
+		if errors.Is(rst.Error, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+
+	if !session.IsActive() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session revoked"})
+		return
+	}
+
 	var user models.User
-	rst := initializers.DB.Where("id=?", claims["user_id"]).First(&user)
+	rst = initializers.DB.Where("id=?", session.UserID).First(&user)
 	if rst.Error != nil {
 		if errors.Is(rst.Error, gorm.ErrRecordNotFound) {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
@@ -63,6 +97,12 @@ func CheckAuth(c *gin.Context) {
 		return
 	}
 
+	if user.DisabledAt != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+		return
+	}
+
 	c.Set("user", user)
+	c.Set("session", session)
 	c.Next()
 }
@@ -4,7 +4,10 @@ import (
 	"dawpitech/area/initializers"
 	"dawpitech/area/models"
 	"dawpitech/area/services"
+	"encoding/json"
 	"log"
+	"os"
+	"strings"
 )
 
 func init() {
@@ -19,14 +22,40 @@ func main() {
 	err := initializers.DB.AutoMigrate(
 		&models.User{},
 		&models.AuthMethods{},
+		&models.ExternalIdentity{},
 		&models.Workflow{},
 		&models.LogEntry{},
+		&models.WorkflowRun{},
+		&models.DeadLetter{},
+		&models.TriggerState{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.APIToken{},
+		&models.RecoveryCode{},
+		&models.OneTimeToken{},
+		&models.Organization{},
+		&models.OrganizationMember{},
+		&models.AuditEntry{},
+		&models.Event{},
+		&models.EventDelivery{},
 	)
 
 	if err != nil {
 		log.Panic(err.Error())
 	}
 
+	if err = migrateLegacyWorkflowSteps(); err != nil {
+		log.Panic(err.Error())
+	}
+
+	if err = protectAuditEntries(); err != nil {
+		log.Panic(err.Error())
+	}
+
+	if err = promoteAdmins(); err != nil {
+		log.Panic(err.Error())
+	}
+
 	for i := 0; i < len(services.Services); i++ {
 		if len(services.Services[i].DBModels) == 0 {
 			log.Printf("Skipping serice '%s': it has no tables.\n", services.Services[i].Name)
@@ -42,3 +71,112 @@ func main() {
 
 	log.Print("Migration successful.")
 }
+
+var legacyWorkflowColumns = []string{
+	"modifier_name",
+	"modifier_parameters",
+	"reaction_name",
+	"reaction_parameters",
+}
+
+// migrateLegacyWorkflowSteps converts workflows saved with a single modifier
+// and a single reaction into the steps list, then drops the old columns.
+func migrateLegacyWorkflowSteps() error {
+	if !initializers.DB.Migrator().HasColumn(&models.Workflow{}, "modifier_name") {
+		return nil
+	}
+	log.Println("Migrating legacy single step workflows.")
+
+	type legacyWorkflow struct {
+		ID                 uint
+		ModifierName       string
+		ModifierParameters string
+		ReactionName       string
+		ReactionParameters string
+	}
+
+	var legacyWorkflows []legacyWorkflow
+	if rst := initializers.DB.
+		Table("workflows").
+		Select("id, modifier_name, modifier_parameters, reaction_name, reaction_parameters").
+		Where("steps IS NULL OR steps = ?", "null").
+		Scan(&legacyWorkflows); rst.Error != nil {
+		return rst.Error
+	}
+
+	for _, legacy := range legacyWorkflows {
+		var modifierParams, reactionParams map[string]string
+		if legacy.ModifierParameters != "" {
+			if err := json.Unmarshal([]byte(legacy.ModifierParameters), &modifierParams); err != nil {
+				return err
+			}
+		}
+		if legacy.ReactionParameters != "" {
+			if err := json.Unmarshal([]byte(legacy.ReactionParameters), &reactionParams); err != nil {
+				return err
+			}
+		}
+
+		steps := models.StepsFromLegacy(legacy.ModifierName, modifierParams, legacy.ReactionName, reactionParams)
+		if rst := initializers.DB.
+			Model(&models.Workflow{}).
+			Where("id = ?", legacy.ID).
+			Updates(models.Workflow{Steps: steps}); rst.Error != nil {
+			return rst.Error
+		}
+	}
+	log.Printf("Migrated %d workflows.\n", len(legacyWorkflows))
+
+	for _, column := range legacyWorkflowColumns {
+		if err := initializers.DB.Migrator().DropColumn(&models.Workflow{}, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protectAuditEntries makes the database itself refuse any edit of the audit
+// log, not only the API.
+func protectAuditEntries() error {
+	return initializers.DB.Exec(`
+CREATE OR REPLACE FUNCTION audit_entries_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit entries are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_entries_no_edit ON audit_entries;
+CREATE TRIGGER audit_entries_no_edit
+	BEFORE UPDATE OR DELETE ON audit_entries
+	FOR EACH ROW EXECUTE FUNCTION audit_entries_append_only();
+
+DROP TRIGGER IF EXISTS audit_entries_no_truncate ON audit_entries;
+CREATE TRIGGER audit_entries_no_truncate
+	BEFORE TRUNCATE ON audit_entries
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_entries_append_only();
+`).Error
+}
+
+// promoteAdmins grants the admin role to the accounts listed in ADMIN_EMAILS,
+// the first admin can't be named through the API.
+func promoteAdmins() error {
+	var emails []string
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	if len(emails) == 0 {
+		return nil
+	}
+
+	rst := initializers.DB.
+		Model(&models.User{}).
+		Where("id IN (?)", initializers.DB.Model(&models.AuthMethods{}).Select("user_id").Where("email IN ?", emails)).
+		Update("is_admin", true)
+	if rst.Error != nil {
+		return rst.Error
+	}
+	log.Printf("Granted the admin role to %d users.\n", rst.RowsAffected)
+	return nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"slices"
+	"time"
+)
+
+type APIScope string
+
+const (
+	WorkflowsReadScope  APIScope = "workflows:read"
+	WorkflowsWriteScope APIScope = "workflows:write"
+	LogsReadScope       APIScope = "logs:read"
+)
+
+// APITokenPrefix starts every API token, telling them apart from the JWTs.
+const APITokenPrefix = "area_"
+
+// APIToken lets scripts call the API on behalf of a user, the token itself is
+// only shown at creation: Prefix identifies it and the secret part is hashed.
+type APIToken struct {
+	gorm.Model
+	UserID     uint `gorm:"not null;index"`
+	Name       string
+	Prefix     string     `gorm:"not null;uniqueIndex"`
+	SecretHash string     `gorm:"not null"`
+	Scopes     []APIScope `gorm:"serializer:json"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+func (t APIToken) IsExpired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
+
+func (t APIToken) HasScope(scope APIScope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
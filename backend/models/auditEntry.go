@@ -0,0 +1,68 @@
+package models
+
+import (
+	"github.com/juju/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	SignInSuccessAction         = "auth.sign_in.success"
+	SignInFailureAction         = "auth.sign_in.failure"
+	IdentityLinkAction          = "auth.identity.link"
+	IdentityUnlinkAction        = "auth.identity.unlink"
+	APITokenCreateAction        = "auth.api_token.create"
+	APITokenRevokeAction        = "auth.api_token.revoke"
+	ProviderLinkAction          = "provider.link"
+	ProviderUnlinkAction        = "provider.unlink"
+	WorkflowCreateAction        = "workflow.create"
+	WorkflowEditAction          = "workflow.edit"
+	WorkflowDeleteAction        = "workflow.delete"
+	WorkflowActivateAction      = "workflow.activate"
+	WorkflowDeactivateAction    = "workflow.deactivate"
+	WorkflowWebhookRotateAction = "workflow.webhook.rotate"
+	AdminUserDisableAction      = "admin.user.disable"
+	AdminUserEnableAction       = "admin.user.enable"
+	AdminUserDeleteAction       = "admin.user.delete"
+	AdminUserPromoteAction      = "admin.user.promote"
+	AdminUserDemoteAction       = "admin.user.demote"
+	AdminWorkflowDisableAction  = "admin.workflow.disable"
+	AdminProviderRevokeAction   = "admin.provider.revoke"
+)
+
+const (
+	UserTarget     = "user"
+	WorkflowTarget = "workflow"
+	APITokenTarget = "api_token"
+)
+
+var ErrAuditEntryImmutable = errors.New("Audit entries can't be edited nor deleted.")
+
+// AuditChange is the value of a field before and after an edit.
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditEntry records who did what on which object, entries are never edited
+// nor deleted. ActorUserID is 0 when nobody is authenticated, like on a
+// failed sign-in.
+type AuditEntry struct {
+	ID          uint      `gorm:"primaryKey"`
+	CreatedAt   time.Time `gorm:"index"`
+	ActorUserID uint      `gorm:"index"`
+	Action      string    `gorm:"not null;index"`
+	TargetType  string    `gorm:"index:idx_audit_entry_target"`
+	TargetID    uint      `gorm:"index:idx_audit_entry_target"`
+	IPAddress   string
+	Details     map[string]string      `gorm:"serializer:json"`
+	Changes     map[string]AuditChange `gorm:"serializer:json"`
+}
+
+func (AuditEntry) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditEntryImmutable
+}
+
+func (AuditEntry) BeforeDelete(*gorm.DB) error {
+	return ErrAuditEntryImmutable
+}
@@ -1,10 +1,43 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"time"
+)
 
 type AuthMethods struct {
 	gorm.Model
 	UserID       uint
 	Email        string `json:"email" gorm:"unique"`
 	PasswordHash string `json:"password_hash"`
+	// EmailVerifiedAt is nil until the user followed the link sent at signup.
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// TOTPSecret is set at enrollment but only checked on sign-in once
+	// TOTPEnabled, after the user proved their app generates valid codes.
+	TOTPSecret  string `json:"-" gorm:"type:text;serializer:encrypted"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+	// TOTPLastStep is the time step of the last accepted code, a code can't
+	// be used twice.
+	TOTPLastStep int64 `json:"-"`
+	// Identities are the provider accounts the user can sign-in with, along
+	// or instead of the password.
+	Identities []ExternalIdentity `json:"identities"`
+}
+
+// ExternalIdentity links an account on an OAuth provider to the user,
+// Subject is the provider's stable ID of the account.
+type ExternalIdentity struct {
+	gorm.Model
+	AuthMethodsID uint   `gorm:"not null;index"`
+	Provider      string `gorm:"not null;uniqueIndex:idx_external_identity"`
+	Subject       string `gorm:"not null;uniqueIndex:idx_external_identity"`
+	Email         string
+}
+
+// RecoveryCode signs the user in instead of a TOTP code, once.
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"not null;index"`
+	CodeHash string `gorm:"not null;uniqueIndex"`
+	UsedAt   *time.Time
 }
@@ -0,0 +1,32 @@
+package models
+
+type ConditionOperator string
+
+const (
+	EqualsOperator         ConditionOperator = "equals"
+	NotEqualsOperator      ConditionOperator = "not_equals"
+	ContainsOperator       ConditionOperator = "contains"
+	NotContainsOperator    ConditionOperator = "not_contains"
+	MatchesOperator        ConditionOperator = "matches"
+	GreaterOperator        ConditionOperator = "greater"
+	GreaterOrEqualOperator ConditionOperator = "greater_or_equal"
+	LowerOperator          ConditionOperator = "lower"
+	LowerOrEqualOperator   ConditionOperator = "lower_or_equal"
+	AndOperator            ConditionOperator = "and"
+	OrOperator             ConditionOperator = "or"
+	NotOperator            ConditionOperator = "not"
+)
+
+// Condition is evaluated against the runtime data of a workflow run. Left
+// and Right are either '#name' references to runtime data or templates,
+// Conditions holds the operands of the and, or & not operators.
+type Condition struct {
+	Operator   ConditionOperator
+	Left       string      `json:",omitempty"`
+	Right      string      `json:",omitempty"`
+	Conditions []Condition `json:",omitempty"`
+}
+
+func (op ConditionOperator) IsLogical() bool {
+	return op == AndOperator || op == OrOperator || op == NotOperator
+}
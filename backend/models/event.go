@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Event is published by a webhook handler for the triggers subscribed to its
+// type, it is kept until a matching workflow ran.
+type Event struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index"`
+	Type      string    `gorm:"not null;uniqueIndex:idx_event_source,where:source_id <> ''"`
+	// SourceID is the ID given by the provider, an event it sends again is
+	// ignored.
+	SourceID string `gorm:"uniqueIndex:idx_event_source,where:source_id <> ''"`
+	// Attributes are matched by the filters of the subscriptions, Data is
+	// given to the workflows as the outputs of their trigger.
+	Attributes map[string]string `gorm:"serializer:json"`
+	Data       map[string]string `gorm:"serializer:json"`
+	ClaimedAt  *time.Time
+	// RetryAt is set when no armed trigger matched the event, it is
+	// dispatched again from then on until it is delivered or forgotten.
+	RetryAt     *time.Time
+	ProcessedAt *time.Time `gorm:"index"`
+}
+
+// EventDelivery records a workflow that ran for an event, it isn't run again
+// when the event is processed again after a crash.
+type EventDelivery struct {
+	ID         uint `gorm:"primaryKey"`
+	CreatedAt  time.Time
+	EventID    uint `gorm:"not null;uniqueIndex:idx_event_delivery"`
+	WorkflowID uint `gorm:"not null;uniqueIndex:idx_event_delivery"`
+	RunID      uint
+}
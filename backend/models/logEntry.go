@@ -26,6 +26,7 @@ func (logType LogType) String() string {
 type LogEntry struct {
 	gorm.Model
 	WorkflowID  uint
+	RunID       uint `gorm:"index"`
 	OwnerUserID uint
 	Timestamp   time.Time
 	Type        string
@@ -33,6 +34,7 @@ type LogEntry struct {
 }
 
 type PublicLogEntry struct {
+	RunID     uint
 	Timestamp time.Time
 	Type      string
 	Message   string
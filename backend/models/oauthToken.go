@@ -0,0 +1,62 @@
+package models
+
+import (
+	_ "dawpitech/area/crypto" // Registers the encrypted serializer
+	"golang.org/x/oauth2"
+	"time"
+)
+
+// OAuthToken is embedded in the provider connections to keep everything
+// needed to renew their access token, the tokens are encrypted at rest.
+type OAuthToken struct {
+	AccessToken  string `gorm:"type:text;serializer:encrypted"`
+	RefreshToken string `gorm:"type:text;serializer:encrypted"`
+	TokenType    string
+	Expiry       time.Time
+	NeedsReauth  bool
+}
+
+// ProviderAccount identifies the account of a provider connection, a user can
+// link several accounts of the same provider.
+type ProviderAccount struct {
+	AccountID   string `gorm:"index"`
+	AccountName string
+}
+
+// OAuthConnection is implemented by every provider connection embedding an
+// OAuthToken.
+type OAuthConnection interface {
+	GetOAuthToken() *OAuthToken
+}
+
+func (t *OAuthToken) GetOAuthToken() *OAuthToken {
+	return t
+}
+
+func NewOAuthToken(token *oauth2.Token) OAuthToken {
+	return OAuthToken{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		TokenType:    token.TokenType,
+		Expiry:       token.Expiry,
+	}
+}
+
+func (t *OAuthToken) ToOAuth2() *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		TokenType:    t.TokenType,
+		Expiry:       t.Expiry,
+	}
+}
+
+// Renew replaces the token after a new authorization, the refresh token is
+// kept when the provider only hands it out on the first consent.
+func (t *OAuthToken) Renew(token *oauth2.Token) {
+	refreshToken := t.RefreshToken
+	*t = NewOAuthToken(token)
+	if t.RefreshToken == "" {
+		t.RefreshToken = refreshToken
+	}
+}
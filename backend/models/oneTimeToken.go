@@ -0,0 +1,33 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type TokenPurpose string
+
+const (
+	EmailVerificationPurpose TokenPurpose = "email_verification"
+	PasswordResetPurpose     TokenPurpose = "password_reset"
+	// TwoFactorChallengePurpose tokens are bound to the challenge given once
+	// the password of a user with 2FA was accepted.
+	TwoFactorChallengePurpose TokenPurpose = "two_factor_challenge"
+	// SocialLoginStatePurpose tokens are kept in a cookie of the browser
+	// going through the consent screen of a login provider.
+	SocialLoginStatePurpose TokenPurpose = "social_login_state"
+)
+
+// OneTimeToken is sent by mail to prove the user owns the address, it can
+// only be used once before ExpiresAt.
+type OneTimeToken struct {
+	gorm.Model
+	UserID    uint         `gorm:"not null;index"`
+	Purpose   TokenPurpose `gorm:"not null"`
+	TokenHash string       `gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	// Attempts counts the codes checked with the token, for the purposes
+	// where a wrong code can be sent again.
+	Attempts int
+}
@@ -0,0 +1,40 @@
+package models
+
+import "gorm.io/gorm"
+
+type OrgRole string
+
+const (
+	OwnerRole  OrgRole = "owner"
+	EditorRole OrgRole = "editor"
+	ViewerRole OrgRole = "viewer"
+)
+
+var orgRoleRank = map[OrgRole]int{
+	ViewerRole: 1,
+	EditorRole: 2,
+	OwnerRole:  3,
+}
+
+// Allows tells if the role grants at least the permissions of the required
+// one: owners manage the members, editors the workflows, viewers only read.
+func (r OrgRole) Allows(required OrgRole) bool {
+	return orgRoleRank[r] >= orgRoleRank[required]
+}
+
+// Organization shares workflows and provider connections between its
+// members. ServiceUserID is a user that can't sign-in, the connections
+// linked for the organization belong to it so workflows can run without
+// depending on a member's accounts.
+type Organization struct {
+	gorm.Model
+	Name          string
+	ServiceUserID uint `gorm:"not null"`
+}
+
+type OrganizationMember struct {
+	gorm.Model
+	OrganizationID uint    `gorm:"not null;uniqueIndex:idx_organization_member"`
+	UserID         uint    `gorm:"not null;uniqueIndex:idx_organization_member;index"`
+	Role           OrgRole `gorm:"not null"`
+}
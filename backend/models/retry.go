@@ -0,0 +1,88 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+type ErrorClass string
+
+const (
+	AnyErrorClass       ErrorClass = "any"
+	NetworkErrorClass   ErrorClass = "network"
+	TimeoutErrorClass   ErrorClass = "timeout"
+	RateLimitErrorClass ErrorClass = "rate_limit"
+	ServerErrorClass    ErrorClass = "server_error"
+	PermanentErrorClass ErrorClass = "permanent"
+	UnknownErrorClass   ErrorClass = "unknown"
+)
+
+// RetryableErrorClasses are the classes a retry policy can retry on.
+var RetryableErrorClasses = []ErrorClass{
+	AnyErrorClass,
+	NetworkErrorClass,
+	TimeoutErrorClass,
+	RateLimitErrorClass,
+	ServerErrorClass,
+}
+
+// StepError lets a handler tell the engine what kind of failure occurred so
+// the retry policy of the workflow can decide whether to try again.
+type StepError struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e *StepError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+func NewStepError(class ErrorClass, err error) error {
+	return &StepError{Class: class, Err: err}
+}
+
+// NewStatusStepError classifies the error of a failed HTTP response from its
+// status code.
+func NewStatusStepError(code int, err error) error {
+	switch {
+	case code == http.StatusTooManyRequests:
+		return NewStepError(RateLimitErrorClass, err)
+	case code == http.StatusRequestTimeout || code == http.StatusGatewayTimeout:
+		return NewStepError(TimeoutErrorClass, err)
+	case code >= http.StatusInternalServerError:
+		return NewStepError(ServerErrorClass, err)
+	}
+	return NewStepError(PermanentErrorClass, err)
+}
+
+// RetryPolicy defines how failed reactions of a workflow are retried. Delays
+// grow exponentially from InitialDelayMs up to MaxDelayMs, Jitter (0 to 1) is
+// the fraction of each delay that is randomized.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialDelayMs int
+	MaxDelayMs     int
+	Multiplier     float64
+	Jitter         float64
+	RetryOn        []ErrorClass
+}
+
+type DeadLetter struct {
+	gorm.Model
+	WorkflowID  uint `gorm:"index"`
+	OwnerUserID uint `gorm:"index"`
+	RunID       uint
+	TriggerData map[string]string `gorm:"serializer:json"`
+	RuntimeData map[string]string `gorm:"serializer:json"`
+	StepLabel   string
+	FailedStep  string
+	Error       string
+	Attempts    int
+	ReplayedAt  *time.Time
+	ReplayRunID uint
+}
@@ -0,0 +1,95 @@
+package routes
+
+import "time"
+
+type AdminUserListRequest struct {
+	// Search filters the users on their email.
+	Search string `query:"search"`
+	Limit  int    `query:"limit" default:"50" validate:"min=1,max=200"`
+	Offset int    `query:"offset" default:"0" validate:"min=0"`
+}
+
+type AdminUserID struct {
+	UserID uint `path:"user_id" validate:"required"`
+}
+
+type AdminSetAdminRequest struct {
+	UserID  uint `path:"user_id" validate:"required"`
+	IsAdmin bool `json:"is_admin"`
+}
+
+type AdminProviderRequest struct {
+	UserID   uint   `path:"user_id" validate:"required"`
+	Provider string `path:"provider" validate:"required"`
+}
+
+type AdminPublicUser struct {
+	UserID         uint       `json:"user_id"`
+	Email          string     `json:"email"`
+	IsAdmin        bool       `json:"is_admin"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DisabledAt     *time.Time `json:"disabled_at"`
+	WorkflowsCount int64      `json:"workflows_count"`
+}
+
+type AdminUserListResponse struct {
+	Users []AdminPublicUser `json:"users"`
+	Total int64             `json:"total"`
+}
+
+type AdminWorkflowListRequest struct {
+	OwnerUserID uint `query:"owner_user_id"`
+	// Active only lists the active workflows when set.
+	Active bool `query:"active"`
+	Limit  int  `query:"limit" default:"50" validate:"min=1,max=200"`
+	Offset int  `query:"offset" default:"0" validate:"min=0"`
+}
+
+type AdminPublicWorkflow struct {
+	WorkflowID     uint      `json:"workflow_id"`
+	Name           string    `json:"name"`
+	OwnerUserID    uint      `json:"owner_user_id"`
+	OrganizationID *uint     `json:"organization_id"`
+	ActionName     string    `json:"action_name"`
+	Active         bool      `json:"active"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type AdminWorkflowListResponse struct {
+	Workflows []AdminPublicWorkflow `json:"workflows"`
+	Total     int64                 `json:"total"`
+}
+
+type AdminServiceStatsRequest struct {
+	// Since is the start of the window, the last 24 hours when not given. It
+	// can't go back further than 30 days.
+	Since *time.Time `query:"since"`
+}
+
+type AdminServiceStats struct {
+	Service   string  `json:"service"`
+	Steps     int64   `json:"steps"`
+	Failures  int64   `json:"failures"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+type AdminServiceStatsResponse struct {
+	Since    time.Time           `json:"since"`
+	Services []AdminServiceStats `json:"services"`
+}
+
+type AdminTriggerJob struct {
+	WorkflowID uint       `json:"workflow_id"`
+	ActionName string     `json:"action_name"`
+	JobID      string     `json:"job_id,omitempty"`
+	LastRun    *time.Time `json:"last_run,omitempty"`
+	NextRun    *time.Time `json:"next_run,omitempty"`
+}
+
+type AdminTriggerJobsResponse struct {
+	NodeName string `json:"node_name"`
+	// IsLeader tells if this instance runs the triggers, the other ones
+	// have none.
+	IsLeader bool              `json:"is_leader"`
+	Jobs     []AdminTriggerJob `json:"jobs"`
+}
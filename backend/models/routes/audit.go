@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"dawpitech/area/models"
+	"time"
+)
+
+type AuditLogRequest struct {
+	// ActorUserID, TargetType and TargetID are only honored for the admins,
+	// the other users only get the entries about themselves.
+	ActorUserID uint       `query:"actor_user_id"`
+	Action      string     `query:"action"`
+	TargetType  string     `query:"target_type"`
+	TargetID    uint       `query:"target_id"`
+	Since       *time.Time `query:"since"`
+	Until       *time.Time `query:"until"`
+	Limit       int        `query:"limit" default:"50" validate:"min=1,max=200"`
+	Offset      int        `query:"offset" default:"0" validate:"min=0"`
+}
+
+type PublicAuditEntry struct {
+	EntryID     uint                          `json:"entry_id"`
+	CreatedAt   time.Time                     `json:"created_at"`
+	ActorUserID uint                          `json:"actor_user_id"`
+	Action      string                        `json:"action"`
+	TargetType  string                        `json:"target_type"`
+	TargetID    uint                          `json:"target_id"`
+	IPAddress   string                        `json:"ip_address"`
+	Details     map[string]string             `json:"details,omitempty"`
+	Changes     map[string]models.AuditChange `json:"changes,omitempty"`
+}
+
+type AuditLogResponse struct {
+	Entries []PublicAuditEntry `json:"entries"`
+	Total   int64              `json:"total"`
+}
@@ -1,18 +1,170 @@
 package routes
 
+import (
+	"dawpitech/area/models"
+	"time"
+)
+
 type AuthRequest struct {
 	Email    string `json:"email" validate:"required"`
 	Password string `json:"password" validate:"required"`
 }
 
 type AuthResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	// TwoFactorRequired is set instead of the tokens when the user enabled
+	// 2FA, ChallengeToken must then be sent back with a code to sign-in.
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
+}
+
+type TwoFactorSignInRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	// Code is either a TOTP code or a recovery code.
+	Code string `json:"code" validate:"required"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TwoFactorVerifyRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type TwoFactorVerifyResponse struct {
+	// RecoveryCodes are only returned once, when 2FA gets enabled.
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorDisableRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type SessionID struct {
+	SessionID uint `path:"session_id" validate:"required"`
+}
+
+type PublicSession struct {
+	SessionID  uint      `json:"session_id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+type GetAllSessionsResponse struct {
+	Sessions []PublicSession `json:"sessions"`
 }
 
 type ThirdPartyAuthCheck struct {
 	IsConnected bool `json:"is_connected"`
+	NeedsReauth bool `json:"needs_reauth"`
 }
 
 type ThirdPartyAuthInit struct {
 	Platform string `query:"platform" validate:"required,oneof=web mobile"`
+	// OrganizationID links the provider for the organization instead of the
+	// user.
+	OrganizationID uint `query:"organization_id"`
+}
+
+type ThirdPartyAuthCheckRequest struct {
+	OrganizationID uint `query:"organization_id"`
+}
+
+type ThirdPartyAuthDeleteRequest struct {
+	OrganizationID uint `query:"organization_id"`
+	// ConnectionID only removes this account, every account of the provider
+	// is removed when not given.
+	ConnectionID uint `query:"connection_id"`
+}
+
+type PublicConnection struct {
+	ConnectionID uint      `json:"connection_id"`
+	Provider     string    `json:"provider"`
+	AccountID    string    `json:"account_id"`
+	AccountName  string    `json:"account_name"`
+	Scopes       []string  `json:"scopes"`
+	NeedsReauth  bool      `json:"needs_reauth"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Webhook is set for the providers sending their events to a URL of
+	// each connection.
+	Webhook *models.ConnectionWebhook `json:"webhook,omitempty"`
+}
+
+type GetAllConnectionsResponse struct {
+	Connections []PublicConnection `json:"connections"`
+}
+
+type SocialLoginInitRequest struct {
+	Provider string `path:"provider" validate:"required"`
+	Platform string `query:"platform" validate:"required,oneof=web mobile"`
+}
+
+type SocialLoginInitResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+type SocialLoginCallbackRequest struct {
+	Provider string `path:"provider" validate:"required"`
+	State    string `query:"state" validate:"required"`
+	Code     string `query:"code"`
+	Error    string `query:"error"`
+}
+
+type IdentityID struct {
+	IdentityID uint `path:"identity_id" validate:"required"`
+}
+
+type PublicIdentity struct {
+	IdentityID uint      `json:"identity_id"`
+	Provider   string    `json:"provider"`
+	Email      string    `json:"email"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type GetAllIdentitiesResponse struct {
+	HasPassword bool             `json:"has_password"`
+	Identities  []PublicIdentity `json:"identities"`
+}
+
+type CreateAPITokenRequest struct {
+	Name      string            `json:"name" validate:"required"`
+	Scopes    []models.APIScope `json:"scopes" validate:"required,min=1,dive,oneof=workflows:read workflows:write logs:read"`
+	ExpiresAt *time.Time        `json:"expires_at"`
+}
+
+type APITokenID struct {
+	TokenID uint `path:"token_id" validate:"required"`
+}
+
+type PublicAPIToken struct {
+	TokenID    uint              `json:"token_id"`
+	Name       string            `json:"name"`
+	Prefix     string            `json:"prefix"`
+	Scopes     []models.APIScope `json:"scopes"`
+	CreatedAt  time.Time         `json:"created_at"`
+	ExpiresAt  *time.Time        `json:"expires_at"`
+	LastUsedAt *time.Time        `json:"last_used_at"`
+}
+
+type CreateAPITokenResponse struct {
+	// Token is only returned once, at creation.
+	Token   string         `json:"token"`
+	Details PublicAPIToken `json:"details"`
+}
+
+type GetAllAPITokensResponse struct {
+	Tokens []PublicAPIToken `json:"tokens"`
 }
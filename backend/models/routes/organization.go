@@ -0,0 +1,57 @@
+package routes
+
+import "dawpitech/area/models"
+
+type OrganizationID struct {
+	OrganizationID uint `path:"org_id" validate:"required"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type EditOrganizationRequest struct {
+	OrganizationID uint   `path:"org_id" validate:"required"`
+	Name           string `json:"name" validate:"required"`
+}
+
+type PublicOrganization struct {
+	OrganizationID uint   `json:"organization_id"`
+	Name           string `json:"name"`
+	// ServiceUserID is the value to give as run_as_user_id for the workflows
+	// using the organization's provider connections.
+	ServiceUserID uint           `json:"service_user_id"`
+	Role          models.OrgRole `json:"role"`
+}
+
+type GetAllOrganizationsResponse struct {
+	Organizations []PublicOrganization `json:"organizations"`
+}
+
+type PublicMember struct {
+	UserID uint           `json:"user_id"`
+	Email  string         `json:"email"`
+	Role   models.OrgRole `json:"role"`
+}
+
+type GetOrganizationResponse struct {
+	Details PublicOrganization `json:"details"`
+	Members []PublicMember     `json:"members"`
+}
+
+type AddMemberRequest struct {
+	OrganizationID uint           `path:"org_id" validate:"required"`
+	Email          string         `json:"email" validate:"required"`
+	Role           models.OrgRole `json:"role" validate:"required,oneof=owner editor viewer"`
+}
+
+type MemberID struct {
+	OrganizationID uint `path:"org_id" validate:"required"`
+	UserID         uint `path:"user_id" validate:"required"`
+}
+
+type EditMemberRequest struct {
+	OrganizationID uint           `path:"org_id" validate:"required"`
+	UserID         uint           `path:"user_id" validate:"required"`
+	Role           models.OrgRole `json:"role" validate:"required,oneof=owner editor viewer"`
+}
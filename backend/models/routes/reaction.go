@@ -11,6 +11,7 @@ type ResponseGetReactionInfo struct {
 	PrettyName  string
 	Description string
 	Parameters  []models.PublicParameter
+	Outputs     []models.PublicParameter
 }
 
 type GetAllReactionResponse struct {
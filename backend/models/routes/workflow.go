@@ -1,32 +1,59 @@
 package routes
 
+import "dawpitech/area/models"
+
 type WorkflowID struct {
 	WorkflowID uint `path:"id" validate:"required"`
 }
 
 type GetAllWorkflowResponse struct {
-	WorkflowID uint
-	Name       string
-	Active     bool
+	WorkflowID     uint
+	Name           string
+	OrganizationID *uint
+	Active         bool
+}
+
+type CreateWorkflowRequest struct {
+	// OrganizationID creates the workflow in the organization instead of the
+	// personal space of the user.
+	OrganizationID *uint
 }
 
 type GetWorkflowResponse struct {
-	WorkflowID         uint
-	Name               string
-	ActionName         string
-	ActionParameters   map[string]string
-	ModifierName       string
-	ModifierParameters map[string]string
-	ReactionName       string
-	ReactionParameters map[string]string
-	Active             bool
+	WorkflowID          uint
+	Name                string
+	ActionName          string
+	ActionParameters    map[string]string
+	ActionConnectionID  uint
+	Steps               []models.WorkflowStep
+	RetryPolicy         *models.RetryPolicy
+	CatchUp             bool
+	PollIntervalSeconds int
+	OrganizationID      *uint
+	RunAsUserID         uint
+	ModifierName        string
+	ModifierParameters  map[string]string
+	ReactionName        string
+	ReactionParameters  map[string]string
+	Active              bool
 }
 
 type EditWorkflowRequest struct {
-	WorkflowID         uint `path:"id"`
-	Name               string
-	ActionName         string
-	ActionParameters   map[string]string
+	WorkflowID       uint `path:"id"`
+	Name             string
+	ActionName       string
+	ActionParameters map[string]string
+	// ActionConnectionID and the ConnectionID of the steps pick the
+	// provider accounts used, among the ones of RunAsUserID.
+	ActionConnectionID uint
+	Steps              []models.WorkflowStep
+	RetryPolicy        *models.RetryPolicy
+	CatchUp            bool
+	// PollIntervalSeconds is the delay between two checks of a polling
+	// trigger, 0 to use the default one.
+	PollIntervalSeconds int
+	// RunAsUserID keeps the current provider accounts when not given.
+	RunAsUserID        *uint
 	ModifierName       string
 	ModifierParameters map[string]string
 	ReactionName       string
@@ -35,15 +62,23 @@ type EditWorkflowRequest struct {
 }
 
 type CheckWorkflowRequest struct {
-	ActionName         string
-	ActionParameters   map[string]string
-	ModifierName       string
-	ModifierParameters map[string]string
-	ReactionName       string
-	ReactionParameters map[string]string
+	ActionName          string
+	ActionParameters    map[string]string
+	Steps               []models.WorkflowStep
+	RetryPolicy         *models.RetryPolicy
+	PollIntervalSeconds int
+	ModifierName        string
+	ModifierParameters  map[string]string
+	ReactionName        string
+	ReactionParameters  map[string]string
 }
 
 type CheckWorkflowResponse struct {
 	SyntaxValid bool
 	Error       string
 }
+
+type GetWorkflowWebhookResponse struct {
+	// URL is secret, anyone knowing it can trigger the workflow.
+	URL string
+}
@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"dawpitech/area/models"
+	"time"
+)
+
+type GetAllWorkflowRunsRequest struct {
+	WorkflowID uint `path:"id" validate:"required"`
+	Limit      int  `query:"limit" default:"50" validate:"min=1,max=200"`
+	Offset     int  `query:"offset" default:"0" validate:"min=0"`
+}
+
+type WorkflowRunID struct {
+	WorkflowID uint `path:"id" validate:"required"`
+	RunID      uint `path:"run_id" validate:"required"`
+}
+
+type RunWorkflowRequest struct {
+	WorkflowID     uint `path:"id" validate:"required"`
+	TriggerOutputs map[string]string
+	DryRun         bool
+}
+
+type WorkflowRunSummary struct {
+	RunID       uint
+	Mode        models.RunMode
+	TriggeredAt time.Time
+	FinishedAt  time.Time
+	Status      models.RunStatus
+	Error       string
+}
+
+type GetAllWorkflowRunsResponse struct {
+	Runs []WorkflowRunSummary
+}
+
+type GetWorkflowRunResponse struct {
+	RunID       uint
+	WorkflowID  uint
+	Mode        models.RunMode
+	TriggeredAt time.Time
+	FinishedAt  time.Time
+	Status      models.RunStatus
+	Error       string
+	TriggerData map[string]string
+	Steps       []models.StepTrace
+	Logs        []models.PublicLogEntry
+}
+
+type DeadLetterID struct {
+	WorkflowID   uint `path:"id" validate:"required"`
+	DeadLetterID uint `path:"letter_id" validate:"required"`
+}
+
+type PublicDeadLetter struct {
+	DeadLetterID uint
+	RunID        uint
+	FailedAt     time.Time
+	FailedStep   string
+	Error        string
+	Attempts     int
+	TriggerData  map[string]string
+	ReplayedAt   *time.Time
+	ReplayRunID  uint
+}
+
+type GetAllDeadLettersResponse struct {
+	DeadLetters []PublicDeadLetter
+}
@@ -1,14 +1,29 @@
 package models
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+	"net/http"
+	"time"
+)
 
 type Handler func(Context) error
 
 type Context struct {
-	OwnerUserID        uint
+	OwnerUserID       uint
+	CredentialsUserID uint
+	// ConnectionID is the provider connection the running action, modifier
+	// or reaction must use, 0 to use the first one linked.
+	ConnectionID       uint
 	WorkflowID         uint
+	RunID              uint
+	RunMode            RunMode
 	ActionName         string
 	ActionParameters   map[string]string
+	Steps              []WorkflowStep
+	RetryPolicy        *RetryPolicy
+	CatchUp            bool
+	PollInterval       time.Duration
 	ModifierName       string
 	ModifierParameters map[string]string
 	ModifierHandler    Handler
@@ -22,6 +37,7 @@ type PublicParameter struct {
 	Name       string
 	PrettyName string
 	Type       string `validate:"oneof=string date"`
+	Sensitive  bool
 }
 
 type ParameterType int
@@ -45,6 +61,7 @@ func (p Parameter) ToPublic() PublicParameter {
 		Name:       p.Name,
 		PrettyName: p.PrettyName,
 		Type:       p.Type.String(),
+		Sensitive:  p.Sensitive,
 	}
 }
 
@@ -52,22 +69,62 @@ type Parameter struct {
 	Name       string
 	PrettyName string
 	Type       ParameterType
+	// Sensitive parameters are encrypted when saved and hidden from run traces.
+	Sensitive bool
 }
 
 type Authentification struct {
 	HandlerAuthInit     interface{}
 	HandlerAuthCallback interface{}
 	HandlerAuthCheck    interface{}
+	// RevokeToken invalidates the token on the provider side when a
+	// connection is deleted, nil when the provider has no such API.
+	RevokeToken func(token *OAuthToken) error
+	// ConnectionWebhook returns where the provider must send the events of
+	// a connection, nil when the provider has no webhooks to set up.
+	ConnectionWebhook func(connectionID uint) (*ConnectionWebhook, error)
+}
+
+// ConnectionWebhook is the URL to give to the provider for the events of a
+// connection.
+type ConnectionWebhook struct {
+	URL string `json:"url"`
+	// VerificationToken is sent by the provider to the URL once, it is then
+	// pasted back in the provider's settings to confirm the URL.
+	VerificationToken string `json:"verification_token,omitempty"`
+}
+
+// ProviderIdentity is the account of the user on a provider, as returned by
+// its API.
+type ProviderIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// LoginMethod lets the users sign-in with their account on the service, it
+// only asks for the scopes needed to identify them.
+type LoginMethod struct {
+	OAuthConfig   *oauth2.Config
+	FetchIdentity func(client *http.Client) (*ProviderIdentity, error)
 }
 
 type Action struct {
-	Name          string
-	PrettyName    string
-	Description   string
-	Parameters    []Parameter
-	Outputs       []Parameter
-	SetupTrigger  Handler
-	RemoveTrigger Handler
+	Name        string
+	PrettyName  string
+	Description string
+	Parameters  []Parameter
+	Outputs     []Parameter
+	// DynamicOutputs returns the outputs depending on the parameters of the
+	// workflow, nil when Outputs are all the action gives.
+	DynamicOutputs func(parameters map[string]string) ([]Parameter, error)
+	SetupTrigger   Handler
+	RemoveTrigger  Handler
+	// SuspendTrigger stops the trigger when this instance stops running it
+	// while the workflow is unchanged, like when the leadership is lost. It
+	// keeps what was registered on the provider for the next leader, nil to
+	// use RemoveTrigger.
+	SuspendTrigger Handler
 }
 
 type Modifier struct {
@@ -76,7 +133,10 @@ type Modifier struct {
 	Description string
 	Parameters  []Parameter
 	Outputs     []Parameter
-	Handler     Handler
+	// DynamicOutputs works like the one of Action, with the parameters of
+	// the step.
+	DynamicOutputs func(parameters map[string]string) ([]Parameter, error)
+	Handler        Handler
 }
 
 type Reaction struct {
@@ -84,6 +144,7 @@ type Reaction struct {
 	PrettyName  string
 	Description string
 	Parameters  []Parameter
+	Outputs     []Parameter
 	Handler     Handler
 }
 
@@ -101,6 +162,7 @@ type Service struct {
 	Modifiers        []Modifier
 	Reactions        []Reaction
 	AuthMethod       *Authentification
+	LoginMethod      *LoginMethod
 	WebhookEndpoints []WebhookEndpoint
 	DBModels         []interface{}
 }
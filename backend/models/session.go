@@ -0,0 +1,30 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Session is a signed-in device, each refresh rotates its refresh token. All
+// the refresh tokens issued for a session form a family which is revoked as
+// a whole when an already used token is presented again.
+type Session struct {
+	gorm.Model
+	UserID     uint `gorm:"not null;index"`
+	UserAgent  string
+	IPAddress  string
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+}
+
+func (s Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+type RefreshToken struct {
+	gorm.Model
+	SessionID uint   `gorm:"not null;index"`
+	TokenHash string `gorm:"not null;uniqueIndex"`
+	UsedAt    *time.Time
+}
@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// TriggerState persists the cursor values of a workflow trigger (last seen
+// commit, message, ...) so polling survives restarts.
+type TriggerState struct {
+	gorm.Model
+	WorkflowID  uint   `gorm:"uniqueIndex:idx_trigger_state_key"`
+	TriggerName string `gorm:"uniqueIndex:idx_trigger_state_key"`
+	Key         string `gorm:"uniqueIndex:idx_trigger_state_key"`
+	Value       string
+}
@@ -1,9 +1,16 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"time"
+)
 
 type User struct {
 	gorm.Model
 	Username string
 	Auth     AuthMethods
+	IsAdmin  bool `json:"is_admin"`
+	// DisabledAt is set by an admin, the user can't sign-in nor use the API
+	// until enabled again.
+	DisabledAt *time.Time `json:"disabled_at"`
 }
@@ -2,15 +2,91 @@ package models
 
 import "gorm.io/gorm"
 
+type StepType string
+
+const (
+	ModifierStep StepType = "modifier"
+	ReactionStep StepType = "reaction"
+	FilterStep   StepType = "filter"
+	BranchStep   StepType = "branch"
+)
+
+// WorkflowStep is either a modifier or reaction call, a filter stopping the
+// run when its condition is false, or a branch running Then or Else.
+type WorkflowStep struct {
+	ID         string
+	Type       StepType
+	Name       string            `json:",omitempty"`
+	Parameters map[string]string `json:",omitempty"`
+	Condition  *Condition        `json:",omitempty"`
+	Then       []WorkflowStep    `json:",omitempty"`
+	Else       []WorkflowStep    `json:",omitempty"`
+	// ConnectionID picks the provider account used by the step, the first
+	// one linked is used when 0.
+	ConnectionID uint `json:",omitempty"`
+}
+
 type Workflow struct {
 	gorm.Model
-	Name               string
-	OwnerUserID        uint
-	ActionName         string
-	ActionParameters   map[string]string `gorm:"serializer:json"`
-	ModifierName       string
-	ModifierParameters map[string]string `gorm:"serializer:json"`
-	ReactionName       string
-	ReactionParameters map[string]string `gorm:"serializer:json"`
-	Active             bool
+	Name        string
+	OwnerUserID uint
+	// OrganizationID is set for the workflows shared with an organization,
+	// OwnerUserID is then only the member who created it.
+	OrganizationID *uint `gorm:"index"`
+	// RunAsUserID is the user whose provider connections are used by the
+	// triggers and reactions, the owner for personal workflows.
+	RunAsUserID      uint
+	ActionName       string
+	ActionParameters map[string]string `gorm:"serializer:json"`
+	// ActionConnectionID picks the provider account used by the trigger,
+	// like WorkflowStep.ConnectionID.
+	ActionConnectionID uint
+	Steps              []WorkflowStep `gorm:"serializer:json"`
+	RetryPolicy        *RetryPolicy   `gorm:"serializer:json"`
+	CatchUp            bool
+	// PollIntervalSeconds is the delay between two checks of a polling
+	// trigger, 0 to use the default one.
+	PollIntervalSeconds int
+	Active              bool
+}
+
+// StepsFromLegacy builds the steps list of a workflow using the old single
+// modifier / single reaction shape.
+func StepsFromLegacy(modifierName string, modifierParams map[string]string, reactionName string, reactionParams map[string]string) []WorkflowStep {
+	var steps []WorkflowStep
+	if modifierName != "" {
+		steps = append(steps, WorkflowStep{
+			Type:       ModifierStep,
+			Name:       modifierName,
+			Parameters: modifierParams,
+		})
+	}
+	if reactionName != "" {
+		steps = append(steps, WorkflowStep{
+			Type:       ReactionStep,
+			Name:       reactionName,
+			Parameters: reactionParams,
+		})
+	}
+	return steps
+}
+
+// FirstStepOfType returns the first step of the given type, used to expose
+// workflows to clients only knowing the single modifier / reaction shape.
+func (w Workflow) FirstStepOfType(stepType StepType) (WorkflowStep, bool) {
+	for _, step := range w.Steps {
+		if step.Type == stepType {
+			return step, true
+		}
+	}
+	return WorkflowStep{}, false
+}
+
+// CredentialsUserID returns the user whose provider connections the workflow
+// runs with.
+func (w Workflow) CredentialsUserID() uint {
+	if w.RunAsUserID != 0 {
+		return w.RunAsUserID
+	}
+	return w.OwnerUserID
 }
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type RunStatus string
+
+type RunMode string
+
+const (
+	TriggeredRunMode RunMode = "triggered"
+	ManualRunMode    RunMode = "manual"
+	DryRunMode       RunMode = "dry_run"
+	ReplayRunMode    RunMode = "replay"
+)
+
+const (
+	RunningRun RunStatus = "running"
+	SuccessRun RunStatus = "success"
+	StoppedRun RunStatus = "stopped"
+	FailedRun  RunStatus = "failed"
+)
+
+// StepTrace records what went through a step during a workflow run.
+type StepTrace struct {
+	Label      string
+	Type       StepType
+	Name       string            `json:",omitempty"`
+	Parameters map[string]string `json:",omitempty"`
+	Outputs    map[string]string `json:",omitempty"`
+	StartedAt  time.Time
+	DurationMs int64
+	Attempts   int    `json:",omitempty"`
+	Skipped    bool   `json:",omitempty"`
+	Error      string `json:",omitempty"`
+}
+
+type WorkflowRun struct {
+	gorm.Model
+	WorkflowID  uint `gorm:"index"`
+	OwnerUserID uint `gorm:"index"`
+	Mode        RunMode
+	TriggeredAt time.Time
+	FinishedAt  time.Time
+	Status      RunStatus
+	TriggerData map[string]string `gorm:"serializer:json"`
+	Steps       []StepTrace       `gorm:"serializer:json"`
+	Error       string
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"dawpitech/area/crypto"
+	"dawpitech/area/engines/workflowEngine"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"dawpitech/area/services"
+	"dawpitech/area/services/github"
+	"dawpitech/area/services/notion"
+	"dawpitech/area/services/webhook"
+	"log"
+	"reflect"
+)
+
+func init() {
+	initializers.LoadEnvironment()
+	initializers.ConnectDB()
+}
+
+// Re-encrypts every secret with the first key of ENCRYPTION_MASTER_KEYS, once
+// done the other keys can be removed from the environment.
+func main() {
+	if err := crypto.LoadMasterKeys(); err != nil {
+		log.Panic(err.Error())
+	}
+	services.Init()
+
+	log.Println("Starting secrets rotation.")
+	for i := 0; i < len(services.Services); i++ {
+		for _, model := range services.Services[i].DBModels {
+			if _, ok := model.(models.OAuthConnection); !ok {
+				continue
+			}
+			log.Printf("Rotating service '%s' tokens.\n", services.Services[i].Name)
+			if err := rotateConnections(model); err != nil {
+				log.Panic(err.Error())
+			}
+		}
+	}
+
+	log.Println("Rotating two-factor secrets.")
+	if err := rotateTOTPSecrets(); err != nil {
+		log.Panic(err.Error())
+	}
+
+	log.Println("Rotating Notion webhook secrets.")
+	if err := rotateNotionWebhooks(); err != nil {
+		log.Panic(err.Error())
+	}
+
+	log.Println("Rotating Github webhook secrets.")
+	if err := rotateGithubHooks(); err != nil {
+		log.Panic(err.Error())
+	}
+
+	log.Println("Rotating webhook URLs.")
+	if err := rotateWebhookTokens(); err != nil {
+		log.Panic(err.Error())
+	}
+
+	log.Println("Rotating sensitive workflow parameters.")
+	if err := rotateWorkflows(); err != nil {
+		log.Panic(err.Error())
+	}
+
+	log.Print("Rotation successful.")
+}
+
+// rotateConnections saves back every provider connection of the given model,
+// the encrypted serializer encrypts them again with the active key.
+func rotateConnections(model interface{}) error {
+	connections := reflect.New(reflect.SliceOf(reflect.TypeOf(model)))
+	if rst := initializers.DB.Unscoped().Find(connections.Interface()); rst.Error != nil {
+		return rst.Error
+	}
+
+	for i := 0; i < connections.Elem().Len(); i++ {
+		connection := connections.Elem().Index(i).Interface()
+		if rst := initializers.DB.
+			Unscoped().
+			Model(connection).
+			Select("access_token", "refresh_token").
+			UpdateColumns(connection); rst.Error != nil {
+			return rst.Error
+		}
+	}
+	log.Printf("Rotated %d connections.\n", connections.Elem().Len())
+	return nil
+}
+
+func rotateTOTPSecrets() error {
+	var authMethods []models.AuthMethods
+	if rst := initializers.DB.Unscoped().Where("totp_secret <> ''").Find(&authMethods); rst.Error != nil {
+		return rst.Error
+	}
+
+	for _, auth := range authMethods {
+		if rst := initializers.DB.
+			Unscoped().
+			Model(&auth).
+			Select("totp_secret").
+			UpdateColumns(&auth); rst.Error != nil {
+			return rst.Error
+		}
+	}
+	log.Printf("Rotated %d two-factor secrets.\n", len(authMethods))
+	return nil
+}
+
+func rotateNotionWebhooks() error {
+	var connections []notion.ProviderNotionAuthData
+	if rst := initializers.DB.Unscoped().Where("webhook_key <> ''").Find(&connections); rst.Error != nil {
+		return rst.Error
+	}
+
+	for _, connection := range connections {
+		if rst := initializers.DB.
+			Unscoped().
+			Model(&connection).
+			Select("webhook_key", "webhook_verification_token").
+			UpdateColumns(&connection); rst.Error != nil {
+			return rst.Error
+		}
+	}
+	log.Printf("Rotated %d Notion webhook secrets.\n", len(connections))
+	return nil
+}
+
+func rotateGithubHooks() error {
+	var hooks []github.GithubRepositoryHook
+	if rst := initializers.DB.Unscoped().Find(&hooks); rst.Error != nil {
+		return rst.Error
+	}
+
+	for _, hook := range hooks {
+		if rst := initializers.DB.
+			Unscoped().
+			Model(&hook).
+			Select("secret").
+			UpdateColumns(&hook); rst.Error != nil {
+			return rst.Error
+		}
+	}
+	log.Printf("Rotated %d Github webhook secrets.\n", len(hooks))
+	return nil
+}
+
+func rotateWebhookTokens() error {
+	var ingests []webhook.WebhookIngest
+	if rst := initializers.DB.Unscoped().Find(&ingests); rst.Error != nil {
+		return rst.Error
+	}
+
+	for _, ingest := range ingests {
+		if rst := initializers.DB.
+			Unscoped().
+			Model(&ingest).
+			Select("token").
+			UpdateColumns(&ingest); rst.Error != nil {
+			return rst.Error
+		}
+	}
+	log.Printf("Rotated %d webhook URLs.\n", len(ingests))
+	return nil
+}
+
+func rotateWorkflows() error {
+	var workflows []models.Workflow
+	if rst := initializers.DB.Unscoped().Find(&workflows); rst.Error != nil {
+		return rst.Error
+	}
+
+	for _, workflow := range workflows {
+		if err := workflowEngine.SealSensitiveParameters(&workflow); err != nil {
+			return err
+		}
+		if rst := initializers.DB.
+			Unscoped().
+			Model(&workflow).
+			Select("action_parameters", "steps").
+			UpdateColumns(&workflow); rst.Error != nil {
+			return rst.Error
+		}
+	}
+	log.Printf("Rotated %d workflows.\n", len(workflows))
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"dawpitech/area/controllers"
 	"dawpitech/area/middlewares"
+	"dawpitech/area/models"
 	"dawpitech/area/services"
 	"github.com/loopfz/gadgeto/tonic"
 	"github.com/wI2L/fizz"
@@ -27,6 +28,230 @@ func RegisterRoutes(fizzRouter *fizz.Fizz) {
 		middlewares.RateLimitMiddleWare,
 		tonic.Handler(controllers.LoginUser, 200),
 	)
+	authRoutes.POST(
+		"/sign-in/2fa",
+		[]fizz.OperationOption{
+			fizz.Summary("Finish the log-in with a two-factor code"),
+		},
+		middlewares.RateLimitMiddleWare,
+		tonic.Handler(controllers.SignInTwoFactor, 200),
+	)
+	authRoutes.GET(
+		"/social/:provider/init",
+		[]fizz.OperationOption{
+			fizz.Summary("Start a log-in through an OAuth provider"),
+		},
+		middlewares.RateLimitMiddleWare,
+		tonic.Handler(controllers.InitSocialLogin, 200),
+	)
+	authRoutes.GET(
+		"/social/:provider/link",
+		[]fizz.OperationOption{
+			fizz.Summary("Link an OAuth provider account as a login method"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.InitSocialLink, 200),
+	)
+	authRoutes.GET(
+		"/social/:provider/callback",
+		[]fizz.OperationOption{
+			fizz.Summary("End a log-in or a link through an OAuth provider"),
+		},
+		tonic.Handler(controllers.SocialLoginCallback, 200),
+	)
+	authRoutes.GET(
+		"/identities",
+		[]fizz.OperationOption{
+			fizz.Summary("Retrieve the login methods of the user"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.GetAllIdentities, 200),
+	)
+	authRoutes.DELETE(
+		"/identities/:identity_id",
+		[]fizz.OperationOption{
+			fizz.Summary("Remove a login method"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.UnlinkIdentity, 200),
+	)
+	authRoutes.POST(
+		"/verify-email",
+		[]fizz.OperationOption{
+			fizz.Summary("Verify the email address with the token sent by mail"),
+		},
+		middlewares.RateLimitMiddleWare,
+		tonic.Handler(controllers.VerifyEmail, 200),
+	)
+	authRoutes.POST(
+		"/verify-email/resend",
+		[]fizz.OperationOption{
+			fizz.Summary("Send the email verification mail again"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.RateLimitMiddleWare,
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.ResendVerificationEmail, 200),
+	)
+	authRoutes.POST(
+		"/password-reset",
+		[]fizz.OperationOption{
+			fizz.Summary("Send a password reset link by mail"),
+		},
+		middlewares.RateLimitMiddleWare,
+		tonic.Handler(controllers.RequestPasswordReset, 200),
+	)
+	authRoutes.POST(
+		"/password-reset/confirm",
+		[]fizz.OperationOption{
+			fizz.Summary("Set a new password with the token sent by mail"),
+		},
+		middlewares.RateLimitMiddleWare,
+		tonic.Handler(controllers.ConfirmPasswordReset, 200),
+	)
+	authRoutes.POST(
+		"/change-password",
+		[]fizz.OperationOption{
+			fizz.Summary("Change the password of the user"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.RateLimitMiddleWare,
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.ChangePassword, 200),
+	)
+	authRoutes.POST(
+		"/refresh",
+		[]fizz.OperationOption{
+			fizz.Summary("Exchange a refresh token for new tokens"),
+		},
+		middlewares.RateLimitMiddleWare,
+		tonic.Handler(controllers.RefreshSession, 200),
+	)
+	authRoutes.POST(
+		"/logout",
+		[]fizz.OperationOption{
+			fizz.Summary("Revoke the current session"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.LogoutUser, 200),
+	)
+	authRoutes.GET(
+		"/sessions",
+		[]fizz.OperationOption{
+			fizz.Summary("Retrieve the active sessions of the user"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.GetAllSessions, 200),
+	)
+	authRoutes.DELETE(
+		"/sessions",
+		[]fizz.OperationOption{
+			fizz.Summary("Revoke every session of the user"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.RevokeAllSessions, 200),
+	)
+	authRoutes.DELETE(
+		"/sessions/:session_id",
+		[]fizz.OperationOption{
+			fizz.Summary("Revoke a session"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.RevokeSession, 200),
+	)
+	authRoutes.POST(
+		"/2fa/setup",
+		[]fizz.OperationOption{
+			fizz.Summary("Start the two-factor authentication enrollment"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.SetupTwoFactor, 200),
+	)
+	authRoutes.POST(
+		"/2fa/verify",
+		[]fizz.OperationOption{
+			fizz.Summary("Enable two-factor authentication with a first code"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.RateLimitMiddleWare,
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.VerifyTwoFactor, 200),
+	)
+	authRoutes.POST(
+		"/2fa/disable",
+		[]fizz.OperationOption{
+			fizz.Summary("Disable two-factor authentication"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.RateLimitMiddleWare,
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.DisableTwoFactor, 200),
+	)
+	authRoutes.GET(
+		"/tokens",
+		[]fizz.OperationOption{
+			fizz.Summary("Retrieve the API tokens of the user"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.GetAllAPITokens, 200),
+	)
+	authRoutes.POST(
+		"/tokens",
+		[]fizz.OperationOption{
+			fizz.Summary("Create an API token"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.CreateAPIToken, 200),
+	)
+	authRoutes.DELETE(
+		"/tokens/:token_id",
+		[]fizz.OperationOption{
+			fizz.Summary("Revoke an API token"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.RevokeAPIToken, 200),
+	)
 
 	miscRoutes := fizzRouter.Group("/", "Misc", "WIP")
 	miscRoutes.GET(
@@ -46,7 +271,7 @@ func RegisterRoutes(fizzRouter *fizz.Fizz) {
 				"bearerAuth": []string{},
 			}),
 		},
-		middlewares.CheckAuth,
+		middlewares.CheckAuthScope(models.WorkflowsReadScope),
 		tonic.Handler(controllers.GetAllWorkflows, 200),
 	)
 	workflowRoutes.POST(
@@ -57,7 +282,7 @@ func RegisterRoutes(fizzRouter *fizz.Fizz) {
 				"bearerAuth": []string{},
 			}),
 		},
-		middlewares.CheckAuth,
+		middlewares.CheckAuthScope(models.WorkflowsWriteScope),
 		tonic.Handler(controllers.CreateNewWorkflow, 200),
 	)
 	workflowRoutes.POST(
@@ -75,7 +300,7 @@ func RegisterRoutes(fizzRouter *fizz.Fizz) {
 				"bearerAuth": []string{},
 			}),
 		},
-		middlewares.CheckAuth,
+		middlewares.CheckAuthScope(models.WorkflowsWriteScope),
 		tonic.Handler(controllers.DeleteWorkflow, 200),
 	)
 	workflowRoutes.GET(
@@ -86,7 +311,7 @@ func RegisterRoutes(fizzRouter *fizz.Fizz) {
 				"bearerAuth": []string{},
 			}),
 		},
-		middlewares.CheckAuth,
+		middlewares.CheckAuthScope(models.WorkflowsReadScope),
 		tonic.Handler(controllers.GetWorkflow, 200),
 	)
 	workflowRoutes.PATCH(
@@ -97,9 +322,324 @@ func RegisterRoutes(fizzRouter *fizz.Fizz) {
 				"bearerAuth": []string{},
 			}),
 		},
-		middlewares.CheckAuth,
+		middlewares.CheckAuthScope(models.WorkflowsWriteScope),
 		tonic.Handler(controllers.EditWorkflow, 200),
 	)
+	workflowRoutes.POST(
+		"/:id/run",
+		[]fizz.OperationOption{
+			fizz.Summary("Run a workflow now with mock trigger outputs, or dry-run it"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuthScope(models.WorkflowsWriteScope),
+		tonic.Handler(controllers.RunWorkflowNow, 200),
+	)
+	workflowRoutes.GET(
+		"/:id/runs",
+		[]fizz.OperationOption{
+			fizz.Summary("Retrieve the run history of a workflow"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuthScope(models.WorkflowsReadScope),
+		tonic.Handler(controllers.GetAllWorkflowRuns, 200),
+	)
+	workflowRoutes.GET(
+		"/:id/runs/:run_id",
+		[]fizz.OperationOption{
+			fizz.Summary("Retrieve the details of a workflow run"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuthScope(models.WorkflowsReadScope),
+		tonic.Handler(controllers.GetWorkflowRun, 200),
+	)
+	workflowRoutes.GET(
+		"/:id/dead-letters",
+		[]fizz.OperationOption{
+			fizz.Summary("Retrieve the runs of a workflow whose reaction kept failing"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuthScope(models.WorkflowsReadScope),
+		tonic.Handler(controllers.GetAllDeadLetters, 200),
+	)
+	workflowRoutes.POST(
+		"/:id/dead-letters/:letter_id/replay",
+		[]fizz.OperationOption{
+			fizz.Summary("Replay the failed reaction of a run with the data it failed with"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuthScope(models.WorkflowsWriteScope),
+		tonic.Handler(controllers.ReplayDeadLetter, 200),
+	)
+
+	workflowRoutes.GET(
+		"/:id/webhook",
+		[]fizz.OperationOption{
+			fizz.Summary("Retrieve the secret URL triggering a webhook workflow"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuthScope(models.WorkflowsWriteScope),
+		tonic.Handler(controllers.GetWorkflowWebhook, 200),
+	)
+	workflowRoutes.POST(
+		"/:id/webhook/rotate",
+		[]fizz.OperationOption{
+			fizz.Summary("Replace the secret URL of a webhook workflow"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuthScope(models.WorkflowsWriteScope),
+		tonic.Handler(controllers.RotateWorkflowWebhook, 200),
+	)
+
+	organizationRoutes := fizzRouter.Group("/organizations", "Organizations", "WIP")
+	organizationRoutes.POST(
+		"/",
+		[]fizz.OperationOption{
+			fizz.Summary("Create an organization"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.CreateOrganization, 200),
+	)
+	organizationRoutes.GET(
+		"/",
+		[]fizz.OperationOption{
+			fizz.Summary("Retrieve the organizations of the user"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.GetAllOrganizations, 200),
+	)
+	organizationRoutes.GET(
+		"/:org_id",
+		[]fizz.OperationOption{
+			fizz.Summary("Retrieve an organization and its members"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.GetOrganization, 200),
+	)
+	organizationRoutes.PATCH(
+		"/:org_id",
+		[]fizz.OperationOption{
+			fizz.Summary("Edit an organization"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.EditOrganization, 200),
+	)
+	organizationRoutes.DELETE(
+		"/:org_id",
+		[]fizz.OperationOption{
+			fizz.Summary("Delete an organization"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.DeleteOrganization, 200),
+	)
+	organizationRoutes.POST(
+		"/:org_id/members",
+		[]fizz.OperationOption{
+			fizz.Summary("Add a member to an organization"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.AddMember, 200),
+	)
+	organizationRoutes.PATCH(
+		"/:org_id/members/:user_id",
+		[]fizz.OperationOption{
+			fizz.Summary("Change the role of a member"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.EditMember, 200),
+	)
+	organizationRoutes.DELETE(
+		"/:org_id/members/:user_id",
+		[]fizz.OperationOption{
+			fizz.Summary("Remove a member, or leave the organization"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.RemoveMember, 200),
+	)
+
+	auditRoutes := fizzRouter.Group("/audit", "Audit log", "WIP")
+	auditRoutes.GET(
+		"/",
+		[]fizz.OperationOption{
+			fizz.Summary("Query the audit log, admins see every entry"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(controllers.GetAuditLog, 200),
+	)
+
+	adminRoutes := fizzRouter.Group("/admin", "Administration", "WIP")
+	adminRoutes.GET(
+		"/users",
+		[]fizz.OperationOption{
+			fizz.Summary("List and search the users"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		middlewares.CheckAdmin,
+		tonic.Handler(controllers.AdminGetAllUsers, 200),
+	)
+	adminRoutes.GET(
+		"/users/:user_id",
+		[]fizz.OperationOption{
+			fizz.Summary("Retrieve a user"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		middlewares.CheckAdmin,
+		tonic.Handler(controllers.AdminGetUser, 200),
+	)
+	adminRoutes.POST(
+		"/users/:user_id/disable",
+		[]fizz.OperationOption{
+			fizz.Summary("Disable a user account"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		middlewares.CheckAdmin,
+		tonic.Handler(controllers.AdminDisableUser, 200),
+	)
+	adminRoutes.POST(
+		"/users/:user_id/enable",
+		[]fizz.OperationOption{
+			fizz.Summary("Enable a disabled user account"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		middlewares.CheckAdmin,
+		tonic.Handler(controllers.AdminEnableUser, 200),
+	)
+	adminRoutes.DELETE(
+		"/users/:user_id",
+		[]fizz.OperationOption{
+			fizz.Summary("Delete a user account"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		middlewares.CheckAdmin,
+		tonic.Handler(controllers.AdminDeleteUser, 200),
+	)
+	adminRoutes.PUT(
+		"/users/:user_id/admin",
+		[]fizz.OperationOption{
+			fizz.Summary("Grant or remove the admin role"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		middlewares.CheckAdmin,
+		tonic.Handler(controllers.AdminSetAdmin, 200),
+	)
+	adminRoutes.DELETE(
+		"/users/:user_id/providers/:provider",
+		[]fizz.OperationOption{
+			fizz.Summary("Revoke the connections of a user to a provider"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		middlewares.CheckAdmin,
+		tonic.Handler(controllers.AdminRevokeProvider, 200),
+	)
+	adminRoutes.GET(
+		"/workflows",
+		[]fizz.OperationOption{
+			fizz.Summary("List the workflows of every user"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		middlewares.CheckAdmin,
+		tonic.Handler(controllers.AdminGetAllWorkflows, 200),
+	)
+	adminRoutes.POST(
+		"/workflows/:id/disable",
+		[]fizz.OperationOption{
+			fizz.Summary("Force-disable a workflow"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		middlewares.CheckAdmin,
+		tonic.Handler(controllers.AdminDisableWorkflow, 200),
+	)
+	adminRoutes.GET(
+		"/stats/services",
+		[]fizz.OperationOption{
+			fizz.Summary("Retrieve the error rate of every service"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		middlewares.CheckAdmin,
+		tonic.Handler(controllers.AdminGetServiceStats, 200),
+	)
+	adminRoutes.GET(
+		"/jobs",
+		[]fizz.OperationOption{
+			fizz.Summary("Retrieve the trigger jobs armed on this instance"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		middlewares.CheckAdmin,
+		tonic.Handler(controllers.AdminGetTriggerJobs, 200),
+	)
 
 	actionsRoutes := fizzRouter.Group("/action", "Actions details", "WIP")
 	actionsRoutes.GET(
@@ -154,7 +694,11 @@ func RegisterRoutes(fizzRouter *fizz.Fizz) {
 		"/workflow/:id",
 		[]fizz.OperationOption{
 			fizz.Summary("Retrieve logs for a workflow"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
 		},
+		middlewares.CheckAuthScope(models.LogsReadScope),
 		tonic.Handler(controllers.GetAllLogsByWorkflow, 200),
 	)
 
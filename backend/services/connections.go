@@ -0,0 +1,340 @@
+package services
+
+import (
+	"dawpitech/area/engines/auditEngine"
+	"dawpitech/area/engines/organizationEngine"
+	"dawpitech/area/engines/workflowEngine"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"dawpitech/area/models/routes"
+	"dawpitech/area/utils"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// connectionRow reads the provider connections of any service, they all
+// embed the same fields.
+type connectionRow struct {
+	ID        uint
+	CreatedAt time.Time
+	models.ProviderAccount
+	Scope       string
+	NeedsReauth bool
+}
+
+type tokenRow struct {
+	ID uint
+	models.ProviderAccount
+	models.OAuthToken
+}
+
+// connectionModel returns the table of the provider connections of the
+// service, if it has any.
+func connectionModel(service models.Service) (interface{}, bool) {
+	for _, model := range service.DBModels {
+		if _, ok := model.(models.OAuthConnection); ok {
+			return model, true
+		}
+	}
+	return nil, false
+}
+
+// handlerService returns the service of the action, modifier or reaction.
+func handlerService(handlerName string) (models.Service, bool) {
+	for _, service := range Services {
+		for _, action := range service.Actions {
+			if action.Name == handlerName {
+				return service, true
+			}
+		}
+		for _, modifier := range service.Modifiers {
+			if modifier.Name == handlerName {
+				return service, true
+			}
+		}
+		for _, reaction := range service.Reactions {
+			if reaction.Name == handlerName {
+				return service, true
+			}
+		}
+	}
+	return models.Service{}, false
+}
+
+// CheckConnection makes sure the connection chosen for a workflow action or
+// step is an account of its provider linked by the user.
+func CheckConnection(handlerName string, connectionID uint, userID uint) error {
+	service, ok := handlerService(handlerName)
+	if !ok {
+		return errors.NewBadRequest(nil, fmt.Sprintf("Unknown action, modifier or reaction '%s'.", handlerName))
+	}
+	model, ok := connectionModel(service)
+	if !ok {
+		return errors.NewBadRequest(nil, fmt.Sprintf("'%s' doesn't use a provider account.", handlerName))
+	}
+
+	var count int64
+	if rst := initializers.DB.
+		Model(model).
+		Where("id=? AND user_id=?", connectionID, userID).
+		Count(&count); rst.Error != nil {
+		return errors.New("Internal server error.")
+	}
+	if count == 0 {
+		return errors.NewBadRequest(nil, fmt.Sprintf("The provider account chosen for '%s' isn't linked.", handlerName))
+	}
+	return nil
+}
+
+// DeleteConnections revokes the tokens of the user's connections to the
+// service and deletes them, only the given one when connectionID isn't 0.
+// The accounts removed are returned.
+func DeleteConnections(service models.Service, userID uint, connectionID uint) ([]models.ProviderAccount, error) {
+	model, ok := connectionModel(service)
+	if !ok {
+		return nil, nil
+	}
+
+	query := initializers.DB.Model(model).Where("user_id=?", userID)
+	if connectionID != 0 {
+		query = query.Where("id=?", connectionID)
+	}
+	var rows []tokenRow
+	if rst := query.Find(&rows); rst.Error != nil {
+		return nil, rst.Error
+	}
+
+	accounts := make([]models.ProviderAccount, 0, len(rows))
+	ids := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		// The connection is deleted anyway, the user can still revoke the
+		// access from the provider's settings.
+		if service.AuthMethod.RevokeToken != nil {
+			if err := service.AuthMethod.RevokeToken(&row.OAuthToken); err != nil {
+				log.Printf("Couldn't revoke the %s token of connection #%d. Err: %s\n", service.Name, row.ID, err.Error())
+			}
+		}
+		accounts = append(accounts, row.ProviderAccount)
+		ids = append(ids, row.ID)
+	}
+	if len(ids) == 0 {
+		return accounts, nil
+	}
+
+	if rst := initializers.DB.Unscoped().Where("id IN ?", ids).Delete(model); rst.Error != nil {
+		return nil, rst.Error
+	}
+	return accounts, nil
+}
+
+// releaseConnectionWorkflows deactivates the workflows run with the user's
+// connections to the service which use the ones about to be deleted, once
+// their triggers released what they registered with them. The deleted
+// connections they picked are forgotten, the handlers left on the first
+// connection linked only lose it when no other remains.
+func releaseConnectionWorkflows(service models.Service, userID uint, connectionID uint) error {
+	model, ok := connectionModel(service)
+	if !ok {
+		return nil
+	}
+
+	query := initializers.DB.Model(model).Where("user_id=?", userID)
+	if connectionID != 0 {
+		query = query.Where("id=?", connectionID)
+	}
+	var ids []uint
+	if rst := query.Pluck("id", &ids); rst.Error != nil {
+		return rst.Error
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var remaining int64
+	if rst := initializers.DB.
+		Model(model).
+		Where("user_id=? AND id NOT IN ?", userID, ids).
+		Count(&remaining); rst.Error != nil {
+		return rst.Error
+	}
+	deleted := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		deleted[id] = true
+	}
+	uses := func(handlerName string, connectionID uint) bool {
+		if current, ok := handlerService(handlerName); !ok || current.Name != service.Name {
+			return false
+		}
+		return deleted[connectionID] || (connectionID == 0 && remaining == 0)
+	}
+
+	var workflows []models.Workflow
+	if rst := initializers.DB.
+		Where("run_as_user_id=? OR (run_as_user_id=0 AND owner_user_id=?)", userID, userID).
+		Find(&workflows); rst.Error != nil {
+		return rst.Error
+	}
+	for _, workflow := range workflows {
+		affected := uses(workflow.ActionName, workflow.ActionConnectionID)
+		if forgetStepsConnections(workflow.Steps, deleted, uses) {
+			affected = true
+		}
+		if !affected {
+			continue
+		}
+
+		if workflow.Active {
+			if err, ok := workflowEngine.ReleaseWorkflowTrigger(workflow); !ok {
+				log.Print(err.Error())
+			}
+		}
+		workflow.Active = false
+		if deleted[workflow.ActionConnectionID] {
+			workflow.ActionConnectionID = 0
+		}
+		if rst := initializers.DB.
+			Select("active", "action_connection_id", "steps").
+			Updates(&workflow); rst.Error != nil {
+			return rst.Error
+		}
+	}
+	return nil
+}
+
+// forgetStepsConnections resets the deleted connections picked by the steps
+// and tells if any of them used one.
+func forgetStepsConnections(steps []models.WorkflowStep, deleted map[uint]bool, uses func(string, uint) bool) bool {
+	affected := false
+	for i := range steps {
+		if uses(steps[i].Name, steps[i].ConnectionID) {
+			affected = true
+		}
+		if deleted[steps[i].ConnectionID] {
+			steps[i].ConnectionID = 0
+		}
+		if forgetStepsConnections(steps[i].Then, deleted, uses) {
+			affected = true
+		}
+		if forgetStepsConnections(steps[i].Else, deleted, uses) {
+			affected = true
+		}
+	}
+	return affected
+}
+
+// deleteConnectionHandler returns the handler unlinking the accounts of the
+// service.
+func deleteConnectionHandler(service models.Service) func(*gin.Context, *routes.ThirdPartyAuthDeleteRequest) error {
+	return func(c *gin.Context, in *routes.ThirdPartyAuthDeleteRequest) error {
+		maybeUser, ok := c.Get("user")
+		if !ok {
+			return errors.BadRequest
+		}
+
+		user, ok := utils.MaybeGetUser(maybeUser)
+		if !ok {
+			return errors.BadRequest
+		}
+
+		ownerID, err := organizationEngine.ConnectionOwner(user.ID, in.OrganizationID, models.EditorRole)
+		if err != nil {
+			return err
+		}
+
+		if err := releaseConnectionWorkflows(service, ownerID, in.ConnectionID); err != nil {
+			log.Print(err.Error())
+			return errors.New("Internal server error.")
+		}
+
+		accounts, err := DeleteConnections(service, ownerID, in.ConnectionID)
+		if err != nil {
+			log.Print(err.Error())
+			return errors.New("Internal server error.")
+		}
+		if in.ConnectionID != 0 && len(accounts) == 0 {
+			return errors.NewNotFound(nil, "No connection found with the given ID.")
+		}
+
+		for _, account := range accounts {
+			auditEngine.RecordRequest(c, models.AuditEntry{
+				Action:     models.ProviderUnlinkAction,
+				TargetType: models.UserTarget,
+				TargetID:   ownerID,
+				Details: map[string]string{
+					"provider": strings.ToLower(service.Name),
+					"account":  account.AccountName,
+				},
+			})
+		}
+		return nil
+	}
+}
+
+// splitScopes reads the scopes granted to a connection, Github separates them
+// with commas and the others with spaces.
+func splitScopes(scope string) []string {
+	return strings.FieldsFunc(scope, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+}
+
+// GetAllConnections lists the provider accounts linked by the user, or by
+// the organization when one is given.
+func GetAllConnections(c *gin.Context, in *routes.ThirdPartyAuthCheckRequest) (*routes.GetAllConnectionsResponse, error) {
+	maybeUser, ok := c.Get("user")
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	user, ok := utils.MaybeGetUser(maybeUser)
+	if !ok {
+		return nil, errors.BadRequest
+	}
+
+	ownerID, err := organizationEngine.ConnectionOwner(user.ID, in.OrganizationID, models.ViewerRole)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &routes.GetAllConnectionsResponse{
+		Connections: make([]routes.PublicConnection, 0),
+	}
+	for _, service := range Services {
+		model, ok := connectionModel(service)
+		if !ok {
+			continue
+		}
+
+		var rows []connectionRow
+		if rst := initializers.DB.
+			Model(model).
+			Where("user_id=?", ownerID).
+			Order("id asc").
+			Find(&rows); rst.Error != nil {
+			return nil, errors.New("Internal server error.")
+		}
+		for _, row := range rows {
+			connection := routes.PublicConnection{
+				ConnectionID: row.ID,
+				Provider:     strings.ToLower(service.Name),
+				AccountID:    row.AccountID,
+				AccountName:  row.AccountName,
+				Scopes:       splitScopes(row.Scope),
+				NeedsReauth:  row.NeedsReauth,
+				CreatedAt:    row.CreatedAt,
+			}
+			if service.AuthMethod != nil && service.AuthMethod.ConnectionWebhook != nil {
+				if connection.Webhook, err = service.AuthMethod.ConnectionWebhook(row.ID); err != nil {
+					log.Print(err.Error())
+					return nil, errors.New("Internal server error.")
+				}
+			}
+			response.Connections = append(response.Connections, connection)
+		}
+	}
+	return response, nil
+}
@@ -22,6 +22,7 @@ var Provider = models.Service{
 					Name:       "discord_wh_url",
 					PrettyName: "Webhook URL",
 					Type:       models.String,
+					Sensitive:  true,
 				},
 				{
 					Name:       "discord_wh_username",
@@ -39,5 +40,6 @@ var Provider = models.Service{
 	},
 	AuthMethod:       nil,
 	WebhookEndpoints: nil,
+	LoginMethod:      nil,
 	DBModels:         nil,
 }
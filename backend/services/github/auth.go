@@ -1,25 +1,25 @@
 package github
 
 import (
+	"bytes"
 	"context"
-	"crypto/rand"
+	"dawpitech/area/engines/auditEngine"
+	"dawpitech/area/engines/oauthEngine"
+	"dawpitech/area/engines/organizationEngine"
 	"dawpitech/area/initializers"
+	"dawpitech/area/models"
 	"dawpitech/area/models/routes"
 	"dawpitech/area/utils"
-	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/juju/errors"
+	"log"
 	"net/http"
 	"os"
+	"strconv"
 )
 
-type AuthInitInfo struct {
-	UserID   uint
-	Platform string
-}
-
-var AuthStateMap = map[string]AuthInitInfo{}
-
 func AuthGithubInit(g *gin.Context, in *routes.ThirdPartyAuthInit) error {
 	maybeUser, ok := g.Get("user")
 
@@ -32,19 +32,23 @@ func AuthGithubInit(g *gin.Context, in *routes.ThirdPartyAuthInit) error {
 		return errors.BadRequest
 	}
 
-	bytes := make([]byte, 16)
-	if _, err := rand.Read(bytes); err != nil {
+	ownerID, err := organizationEngine.ConnectionOwner(user.ID, in.OrganizationID, models.EditorRole)
+	if err != nil {
+		return err
+	}
+
+	state, err := oauthEngine.SignState("github", oauthEngine.AuthState{
+		UserID:      ownerID,
+		ActorUserID: user.ID,
+		Platform:    in.Platform,
+	})
+	if err != nil {
 		g.AbortWithStatus(http.StatusInternalServerError)
 		return nil
 	}
-	randomString := hex.EncodeToString(bytes)
-	AuthStateMap[randomString] = AuthInitInfo{
-		UserID:   user.ID,
-		Platform: in.Platform,
-	}
 
 	g.IndentedJSON(http.StatusOK, gin.H{
-		"redirect_to": oauthConfig.AuthCodeURL(randomString),
+		"redirect_to": oauthConfig.AuthCodeURL(state),
 	})
 
 	return nil
@@ -57,7 +61,7 @@ func AuthGithubCallback(g *gin.Context) error {
 		return nil
 	}
 
-	authInfo, ok := AuthStateMap[reqState]
+	authInfo, ok := oauthEngine.ParseState("github", reqState)
 	if !ok {
 		g.AbortWithStatus(http.StatusBadRequest)
 		return nil
@@ -82,17 +86,41 @@ func AuthGithubCallback(g *gin.Context) error {
 		return nil
 	}
 
-	model := &ProviderGithubAuthData{
-		UserID:      authInfo.UserID,
-		AccessToken: token.AccessToken,
-		Scope:       scope,
+	account, err := fetchAccount(oauthConfig.Client(context.Background(), token))
+	if err != nil {
+		log.Print(err.Error())
+		g.AbortWithStatus(http.StatusBadGateway)
+		return nil
+	}
+
+	// Linking an account again replaces the token of its connection, another
+	// account of the same provider gets a new one.
+	var model ProviderGithubAuthData
+	if err := oauthEngine.FindAccountConnection(&model, authInfo.UserID, account.AccountID); err != nil {
+		g.AbortWithStatus(http.StatusInternalServerError)
+		return nil
 	}
+	model.UserID = authInfo.UserID
+	model.ProviderAccount = account
+	model.Renew(token)
+	model.Scope = scope
 
-	if rst := initializers.DB.Create(&model); rst.Error != nil {
+	if rst := initializers.DB.Save(&model); rst.Error != nil {
 		g.AbortWithStatus(http.StatusInternalServerError)
 		return nil
 	}
 
+	auditEngine.RecordRequest(g, models.AuditEntry{
+		ActorUserID: authInfo.ActorUserID,
+		Action:      models.ProviderLinkAction,
+		TargetType:  models.UserTarget,
+		TargetID:    authInfo.UserID,
+		Details: map[string]string{
+			"provider": "github",
+			"account":  account.AccountName,
+		},
+	})
+
 	var redirectUrl string
 	if authInfo.Platform == "web" {
 		redirectUrl = os.Getenv("PROVIDER_OAUTH2_CALLBACK_URL_WEB")
@@ -105,7 +133,7 @@ func AuthGithubCallback(g *gin.Context) error {
 	return nil
 }
 
-func AuthGithubCheck(g *gin.Context) (*routes.ThirdPartyAuthCheck, error) {
+func AuthGithubCheck(g *gin.Context, in *routes.ThirdPartyAuthCheckRequest) (*routes.ThirdPartyAuthCheck, error) {
 	maybeUser, ok := g.Get("user")
 
 	if !ok {
@@ -117,15 +145,75 @@ func AuthGithubCheck(g *gin.Context) (*routes.ThirdPartyAuthCheck, error) {
 		return nil, errors.BadRequest
 	}
 
-	var count int64
+	ownerID, err := organizationEngine.ConnectionOwner(user.ID, in.OrganizationID, models.ViewerRole)
+	if err != nil {
+		return nil, err
+	}
+
+	var connections []ProviderGithubAuthData
 	if rst := initializers.DB.
-		Model(&ProviderGithubAuthData{}).
-		Where("user_id=?", user.ID).
-		Count(&count); rst.Error != nil {
+		Where("user_id=?", ownerID).
+		Find(&connections); rst.Error != nil {
 		return nil, errors.New("Internal server error")
 	}
 
+	needsReauth := false
+	for _, connection := range connections {
+		needsReauth = needsReauth || connection.NeedsReauth
+	}
+
 	return &routes.ThirdPartyAuthCheck{
-		IsConnected: count >= 1,
+		IsConnected: len(connections) >= 1,
+		NeedsReauth: needsReauth,
 	}, nil
 }
+
+// fetchAccount returns the Github account the token was issued for.
+func fetchAccount(client *http.Client) (models.ProviderAccount, error) {
+	resp, err := getGithubRequest(client, "https://api.github.com/user", "application/vnd.github+json")
+	if err != nil {
+		return models.ProviderAccount{}, err
+	}
+	var user githubUser
+	if err := readGithubResponse(resp, &user); err != nil {
+		return models.ProviderAccount{}, err
+	}
+	if user.ID == 0 {
+		return models.ProviderAccount{}, errors.New("Github didn't return the account ID")
+	}
+	return models.ProviderAccount{
+		AccountID:   strconv.FormatInt(user.ID, 10),
+		AccountName: user.Login,
+	}, nil
+}
+
+// revokeToken deletes the token through the OAuth app API, a token Github
+// doesn't know anymore is already revoked.
+func revokeToken(token *models.OAuthToken) error {
+	body, err := json.Marshal(map[string]string{
+		"access_token": token.AccessToken,
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("https://api.github.com/applications/%s/token", oauthConfig.ClientID)
+	req, err := http.NewRequest(http.MethodDelete, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(oauthConfig.ClientID, oauthConfig.ClientSecret)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.New("Github API is not reachable")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return errors.New(fmt.Sprintf("Github API error: %s", resp.Status))
+	}
+	return nil
+}
@@ -1,12 +1,26 @@
 package github
 
 import (
+	"dawpitech/area/models"
 	"gorm.io/gorm"
 )
 
 type ProviderGithubAuthData struct {
 	gorm.Model
-	UserID      uint   `gorm:"not null;index"`
-	AccessToken string `gorm:"size:2048"`
-	Scope       string
+	UserID uint `gorm:"not null;index"`
+	models.ProviderAccount
+	models.OAuthToken
+	Scope string
+}
+
+// GithubRepositoryHook is the webhook registered on the repository watched
+// by a workflow, it lives as long as the trigger is enabled and unchanged.
+type GithubRepositoryHook struct {
+	gorm.Model
+	WorkflowID uint   `gorm:"not null;uniqueIndex"`
+	HookID     int64  `gorm:"not null"`
+	Repository string `gorm:"not null"`
+	Branch     string
+	KeyHash    string `gorm:"not null;uniqueIndex"`
+	Secret     string `gorm:"type:text;serializer:encrypted"`
 }
@@ -30,8 +30,9 @@ var Provider = models.Service{
 					Type:       models.String,
 				},
 			},
-			SetupTrigger:  TriggerNewStarOnRepo,
-			RemoveTrigger: RemoveNewStarOnRepo,
+			SetupTrigger:   TriggerNewStarOnRepo,
+			RemoveTrigger:  RemoveNewStarOnRepo,
+			SuspendTrigger: suspendHookTrigger,
 		},
 		{
 			Name:        "github_new_commit",
@@ -61,8 +62,9 @@ var Provider = models.Service{
 					Type:       models.String,
 				},
 			},
-			SetupTrigger:  TriggerNewCommitOnRepo,
-			RemoveTrigger: RemoveNewCommitOnRepo,
+			SetupTrigger:   TriggerNewCommitOnRepo,
+			RemoveTrigger:  RemoveNewCommitOnRepo,
+			SuspendTrigger: suspendHookTrigger,
 		},
 	},
 	Modifiers: nil,
@@ -95,10 +97,21 @@ var Provider = models.Service{
 		HandlerAuthInit:     AuthGithubInit,
 		HandlerAuthCallback: AuthGithubCallback,
 		HandlerAuthCheck:    AuthGithubCheck,
+		RevokeToken:         revokeToken,
+	},
+	WebhookEndpoints: []models.WebhookEndpoint{
+		{
+			EndpointURL:   "/providers/github/webhooks/:key",
+			HandlerMethod: ReceiveGithubWebhook,
+		},
+	},
+	LoginMethod: &models.LoginMethod{
+		OAuthConfig:   loginOAuthConfig,
+		FetchIdentity: fetchIdentity,
 	},
-	WebhookEndpoints: nil,
 	DBModels: []interface{}{
 		&ProviderGithubAuthData{},
+		&GithubRepositoryHook{},
 	},
 }
 
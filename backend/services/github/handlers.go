@@ -3,8 +3,8 @@ package github
 import (
 	"bytes"
 	"dawpitech/area/engines/logEngine"
+	"dawpitech/area/engines/oauthEngine"
 	"dawpitech/area/engines/workflowEngine"
-	"dawpitech/area/initializers"
 	"dawpitech/area/models"
 	"encoding/json"
 	"fmt"
@@ -23,35 +23,20 @@ type IssueRequest struct {
 }
 
 func HandlerCreateAnIssue(ctx models.Context) error {
-	var count int64
-	if rst := initializers.DB.
-		Model(&ProviderGithubAuthData{}).
-		Where("user_id=?", ctx.OwnerUserID).
-		Count(&count); rst.Error != nil {
-		return errors.New("Internal server error.")
-	}
-
-	if count < 1 {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "No Github Account linked, a github action cannot be used.")
-		return errors.New("The user has not github account linked.")
-	}
-
 	target, targetOK := workflowEngine.GetParam(workflowEngine.ReactionHandler, "target_repository", ctx)
-	issueName, issueNameOK := workflowEngine.GetParam(workflowEngine.ModifierHandler, "issue_name", ctx)
-	issueContent, issueContentOK := workflowEngine.GetParam(workflowEngine.ModifierHandler, "issue_content", ctx)
+	issueName, issueNameOK := workflowEngine.GetParam(workflowEngine.ReactionHandler, "issue_name", ctx)
+	issueContent, issueContentOK := workflowEngine.GetParam(workflowEngine.ReactionHandler, "issue_content", ctx)
 
 	if !(targetOK || issueNameOK || issueContentOK) {
 		return errors.New("Missing parameters")
 	}
 
 	var OwnerOAuth2Access ProviderGithubAuthData
-	rst := initializers.DB.Where("user_id=?", ctx.OwnerUserID).First(&OwnerOAuth2Access)
-	if rst.Error != nil {
-		return errors.New("Workflow owner doesn't exist")
+	if err := oauthEngine.FindConnection(ctx, &OwnerOAuth2Access); err != nil {
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
+		return err
 	}
 
-	token := OwnerOAuth2Access.AccessToken
-
 	reqBody := IssueRequest{
 		Title: issueName,
 		Body:  issueContent,
@@ -70,16 +55,18 @@ func HandlerCreateAnIssue(ctx models.Context) error {
 	}
 
 	req.Header.Set("Accept", "application/vnd.github+json")
-	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
+	client := oauthEngine.NewClient(oauthConfig, &OwnerOAuth2Access)
 
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Print(err)
-		return errors.New("Github API is not reachable")
+		if errors.Is(err, oauthEngine.ErrNeedsReauth) {
+			return models.NewStepError(models.PermanentErrorClass, oauthEngine.ErrNeedsReauth)
+		}
+		return models.NewStepError(models.NetworkErrorClass, errors.New("Github API is not reachable"))
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
@@ -91,5 +78,9 @@ func HandlerCreateAnIssue(ctx models.Context) error {
 	_, _ = io.ReadAll(resp.Body)
 	fmt.Printf("Response status: %s\n", resp.Status)
 	//fmt.Printf("Response body:\n%s\n", string(respBody))
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return models.NewStatusStepError(resp.StatusCode, errors.New("Github API error: "+resp.Status))
+	}
 	return nil
 }
@@ -0,0 +1,71 @@
+package github
+
+import (
+	"dawpitech/area/models"
+	"github.com/juju/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// loginOAuthConfig only identifies the user, the repositories access is
+// asked when linking the provider.
+var loginOAuthConfig = &oauth2.Config{
+	ClientID:     os.Getenv("GITHUB_OAUTH2_CLIENT_ID"),
+	ClientSecret: os.Getenv("GITHUB_OAUTH2_CLIENT_SECRET"),
+	Endpoint:     github.Endpoint,
+	RedirectURL:  os.Getenv("PUBLIC_URL") + "/auth/social/github/callback",
+	Scopes: []string{
+		"read:user",
+		"user:email",
+	},
+}
+
+type githubUser struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// fetchIdentity returns the Github account with its primary email, the one
+// shown on the profile may be missing or unverified.
+func fetchIdentity(client *http.Client) (*models.ProviderIdentity, error) {
+	resp, err := getGithubRequest(client, "https://api.github.com/user", "application/vnd.github+json")
+	if err != nil {
+		return nil, err
+	}
+	var user githubUser
+	if err := readGithubResponse(resp, &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, errors.New("Github didn't return the account ID")
+	}
+
+	resp, err = getGithubRequest(client, "https://api.github.com/user/emails", "application/vnd.github+json")
+	if err != nil {
+		return nil, err
+	}
+	var emails []githubEmail
+	if err := readGithubResponse(resp, &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &models.ProviderIdentity{
+		Subject: strconv.FormatInt(user.ID, 10),
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+		}
+	}
+	return identity, nil
+}
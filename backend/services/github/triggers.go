@@ -1,36 +1,23 @@
 package github
 
 import (
+	"bytes"
+	"dawpitech/area/engines/eventEngine"
 	"dawpitech/area/engines/logEngine"
+	"dawpitech/area/engines/oauthEngine"
+	"dawpitech/area/engines/schedulerEngine"
 	"dawpitech/area/engines/workflowEngine"
-	"dawpitech/area/initializers"
 	"dawpitech/area/models"
 	"encoding/json"
 	"fmt"
-	"github.com/go-co-op/gocron/v2"
-	"github.com/google/uuid"
 	"github.com/juju/errors"
 	"io"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
-var scheduler gocron.Scheduler
-var workflowJobUUID = make(map[uint]uuid.UUID)
-
-func init() {
-	var err error
-	if scheduler, err = gocron.NewScheduler(); err != nil {
-		log.Panic("Module github couldn't init a job scheduler")
-	}
-	scheduler.Start()
-	if commitScheduler, err = gocron.NewScheduler(); err != nil {
-		log.Panic("Module github couldn't init a commit job scheduler")
-	}
-	commitScheduler.Start()
-}
-
 type StarDetail struct {
 	StarredAt string `json:"starred_at"`
 	User      struct {
@@ -39,9 +26,16 @@ type StarDetail struct {
 	} `json:"user"`
 }
 
-var commitScheduler gocron.Scheduler
-var commitWorkflowJobUUID = make(map[uint]uuid.UUID)
-var lastCommitSHA = make(map[uint]string)
+const lastCommitStateKey = "last_commit_sha"
+const lastStarStateKey = "last_starred_at"
+
+// commitsPageSize bounds how many commits a single check can catch up on.
+const commitsPageSize = 30
+
+// comparePageSize and maxCompareCommits bound the commits fetched for a push
+// whose delivery didn't list them all.
+const comparePageSize = 100
+const maxCompareCommits = 5000
 
 type CommitDetail struct {
 	SHA    string `json:"sha"`
@@ -60,67 +54,44 @@ type CommitDetail struct {
 }
 
 func RemoveNewCommitOnRepo(ctx models.Context) error {
-	err := commitScheduler.RemoveJob(commitWorkflowJobUUID[ctx.WorkflowID])
-	if err != nil {
-		return errors.New("Removal of given job resulted in an error.  Err " + err.Error())
-	}
-	delete(commitWorkflowJobUUID, ctx.WorkflowID)
-	delete(lastCommitSHA, ctx.WorkflowID)
-	return nil
+	removeHookTrigger(ctx)
+	return schedulerEngine.Unschedule(ctx)
 }
 
-func checkNewCommitOnRepo(ctx models.Context) {
-	target, targetOK := workflowEngine.GetParam(workflowEngine.Trigger, "commit_target_repository", ctx)
-	branch, branchOK := workflowEngine.GetParam(workflowEngine.Trigger, "commit_target_branch", ctx)
-
-	if !targetOK || !branchOK {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Missing parameter is required.")
-		return
-	}
-
-	var count int64
-	if rst := initializers.DB.
-		Model(&ProviderGithubAuthData{}).
-		Where("user_id=?", ctx.OwnerUserID).
-		Count(&count); rst.Error != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Internal server error.")
-		return
-	}
-
-	if count < 1 {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "No Github Account linked, a github action cannot be used.")
-		return
-	}
+func getGithubRequest(client *http.Client, url string, accept string) (*http.Response, error) {
+	return sendGithubRequest(client, "GET", url, accept, nil)
+}
 
-	var OwnerOAuth2Access ProviderGithubAuthData
-	rst := initializers.DB.Where("user_id=?", ctx.OwnerUserID).First(&OwnerOAuth2Access)
-	if rst.Error != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Internal server error.")
-		return
+// sendGithubRequest sends body as JSON when it isn't nil.
+func sendGithubRequest(client *http.Client, method string, url string, accept string, body []byte) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
 	}
-
-	token := OwnerOAuth2Access.AccessToken
-
-	url := fmt.Sprintf("https://api.github.com/repos/%s/commits?sha=%s&per_page=1", target, branch)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequest(method, url, bodyReader)
 	if err != nil {
 		log.Print(err)
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Github API is not reachable")
-		return
+		return nil, errors.New("Github API is not reachable")
 	}
 
-	req.Header.Set("Accept", "application/vnd.github+json")
-	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", accept)
 	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
-
-	client := &http.Client{}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Print(err)
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Github API is not reachable")
-		return
+		if errors.Is(err, oauthEngine.ErrNeedsReauth) {
+			return nil, oauthEngine.ErrNeedsReauth
+		}
+		return nil, errors.New("Github API is not reachable")
 	}
+	return resp, nil
+}
+
+func readGithubResponse(resp *http.Response, target interface{}) error {
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
@@ -128,235 +99,337 @@ func checkNewCommitOnRepo(ctx models.Context) {
 		}
 	}(resp.Body)
 
-	if resp.StatusCode != http.StatusOK {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, fmt.Sprintf("Github API error: %s", resp.Status))
-		return
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New(fmt.Sprintf("Github API error: %s", resp.Status))
 	}
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Failed to read response body")
-		return
+		return errors.New("Failed to read response body")
 	}
 
-	var commits []CommitDetail
-	if err := json.Unmarshal(respBody, &commits); err != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Failed to parse Github response")
-		return
+	if err := json.Unmarshal(respBody, target); err != nil {
+		return errors.New("Failed to parse Github response")
 	}
+	return nil
+}
 
-	if len(commits) == 0 {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.WarnLog, "No commits found for the specified branch")
-		return
+// listCommits returns the latest commits of the branch, newest first.
+func listCommits(client *http.Client, target string, branch string, perPage int) ([]CommitDetail, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/commits?sha=%s&per_page=%d", target, branch, perPage)
+	resp, err := getGithubRequest(client, url, "application/vnd.github+json")
+	if err != nil {
+		return nil, err
 	}
 
-	latestCommit := commits[0]
-
-	//log.Printf("Used commit hash %s as base, compared to %s\n", lastCommitSHA[ctx.WorkflowID][:7], latestCommit.SHA[:7])
-
-	if lastCommitSHA[ctx.WorkflowID] != latestCommit.SHA {
-		lastCommitSHA[ctx.WorkflowID] = latestCommit.SHA
-		ctx.RuntimeData["github_new_commit_message"] = latestCommit.Commit.Message
-		ctx.RuntimeData["github_new_commit_author"] = latestCommit.Commit.Author.Name
-		workflowEngine.RunWorkflow(ctx)
+	var commits []CommitDetail
+	if err := readGithubResponse(resp, &commits); err != nil {
+		return nil, err
 	}
+	return commits, nil
 }
 
-func TriggerNewCommitOnRepo(ctx models.Context) error {
-	target, targetOK := workflowEngine.GetParam(workflowEngine.Trigger, "commit_target_repository", ctx)
-	branch, branchOK := workflowEngine.GetParam(workflowEngine.Trigger, "commit_target_branch", ctx)
+// compareCommits returns the commits pushed between the two commits, oldest
+// first. It fails when there are more than maxCompareCommits of them.
+func compareCommits(client *http.Client, target string, base string, head string) ([]CommitDetail, error) {
+	var commits []CommitDetail
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("https://api.github.com/repos/%s/compare/%s...%s?per_page=%d&page=%d", target, base, head, comparePageSize, page)
+		resp, err := getGithubRequest(client, url, "application/vnd.github+json")
+		if err != nil {
+			return nil, err
+		}
 
-	if !targetOK || !branchOK {
-		return errors.New("Missing required parameters: commit_target_repository or commit_target_branch")
+		var comparison struct {
+			TotalCommits int            `json:"total_commits"`
+			Commits      []CommitDetail `json:"commits"`
+		}
+		if err := readGithubResponse(resp, &comparison); err != nil {
+			return nil, err
+		}
+		if comparison.TotalCommits > maxCompareCommits {
+			return nil, errors.Errorf("The push has %d commits, more than the %d which can be fetched.", comparison.TotalCommits, maxCompareCommits)
+		}
+		commits = append(commits, comparison.Commits...)
+		if len(comparison.Commits) < comparePageSize || len(commits) >= comparison.TotalCommits {
+			return commits, nil
+		}
 	}
+}
 
-	var count int64
-	if rst := initializers.DB.
-		Model(&ProviderGithubAuthData{}).
-		Where("user_id=?", ctx.OwnerUserID).
-		Count(&count); rst.Error != nil {
-		return errors.New("Internal server error")
+// getOwnerClient returns an HTTP client authenticated as the Github account
+// of the workflow owner.
+func getOwnerClient(ctx models.Context) (*http.Client, error) {
+	var OwnerOAuth2Access ProviderGithubAuthData
+	if err := oauthEngine.FindConnection(ctx, &OwnerOAuth2Access); err != nil {
+		return nil, err
 	}
 
-	if count < 1 {
-		return errors.New("No Github Account linked, a github action cannot be used")
-	}
+	return oauthEngine.NewClient(oauthConfig, &OwnerOAuth2Access), nil
+}
 
-	var OwnerOAuth2Access ProviderGithubAuthData
-	rst := initializers.DB.Where("user_id=?", ctx.OwnerUserID).First(&OwnerOAuth2Access)
-	if rst.Error != nil {
-		return errors.New("Internal server error")
+// commitsSince returns the commits of the page pushed after the saved one,
+// newest first. When the saved commit isn't part of the page only the latest
+// one is.
+func commitsSince(commits []CommitDetail, lastSHA string) []CommitDetail {
+	if len(commits) == 0 || commits[0].SHA == lastSHA {
+		return nil
 	}
+	for i, commit := range commits {
+		if commit.SHA == lastSHA {
+			return commits[:i]
+		}
+	}
+	return commits[:1]
+}
 
-	token := OwnerOAuth2Access.AccessToken
-
-	url := fmt.Sprintf("https://api.github.com/repos/%s/commits?sha=%s&per_page=1", target, branch)
-	req, err := http.NewRequest("GET", url, nil)
+// publishMissedCommits catches up on the commits pushed while the hook of the
+// workflow didn't exist.
+func publishMissedCommits(ctx models.Context, client *http.Client, target string, branch string) error {
+	commits, err := listCommits(client, target, branch, commitsPageSize)
 	if err != nil {
-		return errors.New("Github API is not reachable")
+		return err
 	}
 
-	req.Header.Set("Accept", "application/vnd.github+json")
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	lastSHA, _ := workflowEngine.GetTriggerState(ctx, lastCommitStateKey)
+	newCommits := commitsSince(commits, lastSHA)
+	for i := len(newCommits) - 1; i >= 0; i-- {
+		event := commitEvent(ctx.WorkflowID, newCommits[i].SHA, newCommits[i].Commit.Message, newCommits[i].Commit.Author.Name)
+		if err := eventEngine.Publish(event); err != nil {
+			return errors.New("Couldn't save the missed commits.")
+		}
+	}
+	if len(newCommits) == 0 {
+		return nil
+	}
+	return workflowEngine.SetTriggerState(ctx, lastCommitStateKey, newCommits[0].SHA)
+}
 
-	client := &http.Client{}
+func checkNewCommitOnRepo(ctx models.Context) {
+	target, targetOK := workflowEngine.GetParam(workflowEngine.Trigger, "commit_target_repository", ctx)
+	branch, branchOK := workflowEngine.GetParam(workflowEngine.Trigger, "commit_target_branch", ctx)
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return errors.New("Github API is not reachable")
+	if !targetOK || !branchOK {
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, "Missing parameter is required.")
+		return
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			log.Print(err)
-		}
-	}(resp.Body)
 
-	if resp.StatusCode != http.StatusOK {
-		return errors.New(fmt.Sprintf("Github API error: %s", resp.Status))
+	client, err := getOwnerClient(ctx)
+	if err != nil {
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
+		return
 	}
 
-	respBody, err := io.ReadAll(resp.Body)
+	commits, err := listCommits(client, target, branch, commitsPageSize)
 	if err != nil {
-		return errors.New("Failed to read response body")
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
+		return
 	}
 
-	var commits []CommitDetail
-	if err := json.Unmarshal(respBody, &commits); err != nil {
-		return errors.New("Failed to parse Github response")
+	if len(commits) == 0 {
+		logEngine.NewContextLogEntry(ctx, models.WarnLog, "No commits found for the specified branch")
+		return
 	}
 
-	if len(commits) == 0 {
-		lastCommitSHA[ctx.WorkflowID] = "fffffffffffffffffffffffffff"
-	} else {
-		lastCommitSHA[ctx.WorkflowID] = commits[0].SHA
+	lastSHA, _ := workflowEngine.GetTriggerState(ctx, lastCommitStateKey)
+	newCommits := commitsSince(commits, lastSHA)
+	for i := len(newCommits) - 1; i >= 0; i-- {
+		if err := workflowEngine.SetTriggerState(ctx, lastCommitStateKey, newCommits[i].SHA); err != nil {
+			logEngine.NewContextLogEntry(ctx, models.ErrorLog, "Couldn't save the last processed commit.")
+			return
+		}
+		ctx.RuntimeData["github_new_commit_message"] = newCommits[i].Commit.Message
+		ctx.RuntimeData["github_new_commit_author"] = newCommits[i].Commit.Author.Name
+		workflowEngine.RunWorkflow(ctx)
 	}
+}
 
-	//log.Printf("Used commit hash %s as base\n", lastCommitSHA[ctx.WorkflowID][:7])
+func TriggerNewCommitOnRepo(ctx models.Context) error {
+	target, targetOK := workflowEngine.GetParam(workflowEngine.Trigger, "commit_target_repository", ctx)
+	branch, branchOK := workflowEngine.GetParam(workflowEngine.Trigger, "commit_target_branch", ctx)
 
-	job, err := commitScheduler.NewJob(
-		gocron.CronJob("* * * * *", false),
-		gocron.NewTask(checkNewCommitOnRepo, ctx),
-	)
+	if !targetOK || !branchOK {
+		return errors.New("Missing required parameters: commit_target_repository or commit_target_branch")
+	}
 
+	client, err := getOwnerClient(ctx)
 	if err != nil {
-		return errors.New("Set-up of the trigger failed, please re-try later. Err: " + err.Error())
+		return err
 	}
-	commitWorkflowJobUUID[ctx.WorkflowID] = job.ID()
-
-	return nil
-}
 
-func RemoveNewStarOnRepo(ctx models.Context) error {
-	err := scheduler.RemoveJob(workflowJobUUID[ctx.WorkflowID])
+	commits, err := listCommits(client, target, branch, 1)
 	if err != nil {
-		return errors.New("Removal of given job resulted in an error. Err " + err.Error())
+		return err
 	}
-	delete(workflowJobUUID, ctx.WorkflowID)
-	return nil
-}
 
-func checkNewStarOnRepo(ctx models.Context) {
-	target, targetOK := workflowEngine.GetParam(workflowEngine.Trigger, "star_target_repository", ctx)
+	// Without catch up, the commits pushed while the trigger was down are
+	// ignored by starting over from the current head.
+	if _, saved := workflowEngine.GetTriggerState(ctx, lastCommitStateKey); !ctx.CatchUp || !saved {
+		lastSHA := ""
+		if len(commits) > 0 {
+			lastSHA = commits[0].SHA
+		}
+		if err := workflowEngine.SetTriggerState(ctx, lastCommitStateKey, lastSHA); err != nil {
+			return errors.New("Internal server error")
+		}
+	}
 
-	if !targetOK {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Missing parameters.")
-		return
+	// The commits are pushed by the hook of the repository when it could be
+	// registered, the polling is only a fallback.
+	eventEngine.Subscribe(ctx, commitEventType, workflowFilter(ctx))
+	if registerHook(ctx, client, target, branch, []string{"push"}) {
+		if ctx.CatchUp {
+			if err := publishMissedCommits(ctx, client, target, branch); err != nil {
+				logEngine.NewContextLogEntry(ctx, models.WarnLog, "Couldn't catch up on the missed commits. Err: "+err.Error())
+			}
+		}
+		return nil
 	}
+	eventEngine.Unsubscribe(ctx)
 
-	var count int64
-	if rst := initializers.DB.
-		Model(&ProviderGithubAuthData{}).
-		Where("user_id=?", ctx.OwnerUserID).
-		Count(&count); rst.Error != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Internal server error.")
-		return
+	return schedulerEngine.SchedulePolling(ctx, ctx.PollInterval, checkNewCommitOnRepo)
+}
+
+func RemoveNewStarOnRepo(ctx models.Context) error {
+	removeHookTrigger(ctx)
+	return schedulerEngine.Unschedule(ctx)
+}
+
+// listStargazers returns the stargazers of the last page, the API lists
+// them from the oldest to the most recent one.
+func listStargazers(client *http.Client, target string) ([]StarDetail, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/stargazers?per_page=100", target)
+	resp, err := getGithubRequest(client, url, "application/vnd.github.star+json")
+	if err != nil {
+		return nil, err
 	}
 
-	if count < 1 {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "No Github Account linked, a github action cannot be used.")
-		return
+	if lastPage, ok := lastPageURL(resp.Header.Get("Link")); ok {
+		if err := resp.Body.Close(); err != nil {
+			log.Print(err)
+		}
+		if resp, err = getGithubRequest(client, lastPage, "application/vnd.github.star+json"); err != nil {
+			return nil, err
+		}
 	}
 
-	var OwnerOAuth2Access ProviderGithubAuthData
-	rst := initializers.DB.Where("user_id=?", ctx.OwnerUserID).First(&OwnerOAuth2Access)
-	if rst.Error != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Internal server error.")
-		return
+	var starDetails []StarDetail
+	if err := readGithubResponse(resp, &starDetails); err != nil {
+		return nil, err
 	}
+	return starDetails, nil
+}
 
-	token := OwnerOAuth2Access.AccessToken
+func lastPageURL(link string) (string, bool) {
+	for _, part := range strings.Split(link, ",") {
+		url, rel, found := strings.Cut(part, ";")
+		if found && strings.TrimSpace(rel) == `rel="last"` {
+			return strings.Trim(strings.TrimSpace(url), "<>"), true
+		}
+	}
+	return "", false
+}
 
-	url := fmt.Sprintf("https://api.github.com/repos/%s/stargazers", target)
-	req, err := http.NewRequest("GET", url, nil)
+// starCursor returns the date of the last star processed, now when none is
+// saved.
+func starCursor(ctx models.Context) time.Time {
+	saved, ok := workflowEngine.GetTriggerState(ctx, lastStarStateKey)
+	if !ok {
+		return time.Now()
+	}
+	lastStarredAt, err := time.Parse(time.RFC3339, saved)
 	if err != nil {
-		log.Print(err)
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Github API is not reachable")
-		return
+		logEngine.NewContextLogEntry(ctx, models.WarnLog, "Saved star cursor is invalid, starting over from now.")
+		return time.Now()
 	}
+	return lastStarredAt
+}
 
-	req.Header.Set("Accept", "application/vnd.github.star+json")
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
-
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+// publishMissedStars catches up on the stars given while the hook of the
+// workflow didn't exist.
+func publishMissedStars(ctx models.Context, client *http.Client, target string) error {
+	starDetails, err := listStargazers(client, target)
 	if err != nil {
-		log.Print(err)
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Github API is not reachable")
-		return
+		return err
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			log.Print(err)
+
+	lastStarredAt := starCursor(ctx)
+	for _, star := range starDetails {
+		starredAt, err := time.Parse(time.RFC3339, star.StarredAt)
+		if err != nil || !starredAt.After(lastStarredAt) {
+			continue
 		}
-	}(resp.Body)
+		lastStarredAt = starredAt
+		if err := eventEngine.Publish(starEvent(ctx.WorkflowID, star.User.Login)); err != nil {
+			return errors.New("Couldn't save the missed stars.")
+		}
+	}
+	return workflowEngine.SetTriggerState(ctx, lastStarStateKey, lastStarredAt.Format(time.RFC3339))
+}
 
-	if resp.StatusCode != http.StatusOK {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, fmt.Sprintf("Github API error: %s", resp.Status))
+func checkNewStarOnRepo(ctx models.Context) {
+	target, targetOK := workflowEngine.GetParam(workflowEngine.Trigger, "star_target_repository", ctx)
+
+	if !targetOK {
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, "Missing parameters.")
 		return
 	}
 
-	respBody, err := io.ReadAll(resp.Body)
+	client, err := getOwnerClient(ctx)
 	if err != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Failed to read response body")
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
 		return
 	}
 
-	var starDetails []StarDetail
-	if err := json.Unmarshal(respBody, &starDetails); err != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Failed to parse Github response")
+	starDetails, err := listStargazers(client, target)
+	if err != nil {
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
 		return
 	}
 
-	now := time.Now()
+	lastStarredAt := starCursor(ctx)
 	for _, star := range starDetails {
 		starredAt, err := time.Parse(time.RFC3339, star.StarredAt)
 		if err != nil {
-			logEngine.NewLogEntry(ctx.WorkflowID, models.WarnLog, "Error occurred during date parsing of github response")
+			logEngine.NewContextLogEntry(ctx, models.WarnLog, "Error occurred during date parsing of github response")
 			continue
 		}
 
-		if now.Sub(starredAt) <= time.Minute {
-			workflowEngine.RunWorkflow(ctx)
+		if !starredAt.After(lastStarredAt) {
+			continue
+		}
+		lastStarredAt = starredAt
+		if err := workflowEngine.SetTriggerState(ctx, lastStarStateKey, starredAt.Format(time.RFC3339)); err != nil {
+			logEngine.NewContextLogEntry(ctx, models.ErrorLog, "Couldn't save the last processed star.")
 			return
 		}
+		ctx.RuntimeData["new_star_user"] = star.User.Login
+		workflowEngine.RunWorkflow(ctx)
 	}
 }
 
 func TriggerNewStarOnRepo(ctx models.Context) error {
-	job, err := scheduler.NewJob(
-		gocron.CronJob("* * * * *", false),
-		gocron.NewTask(checkNewStarOnRepo, ctx),
-	)
+	if _, saved := workflowEngine.GetTriggerState(ctx, lastStarStateKey); !ctx.CatchUp || !saved {
+		if err := workflowEngine.SetTriggerState(ctx, lastStarStateKey, time.Now().Format(time.RFC3339)); err != nil {
+			return errors.New("Internal server error")
+		}
+	}
 
-	if err != nil {
-		return errors.New("Set-up of the trigger failed, please re-try later. Err: " + err.Error())
+	// Like the commits, the stars come from the hook of the repository when
+	// it could be registered.
+	target, targetOK := workflowEngine.GetParam(workflowEngine.Trigger, "star_target_repository", ctx)
+	if client, err := getOwnerClient(ctx); targetOK && err == nil {
+		eventEngine.Subscribe(ctx, starEventType, workflowFilter(ctx))
+		if registerHook(ctx, client, target, "", []string{"watch"}) {
+			if ctx.CatchUp {
+				if err := publishMissedStars(ctx, client, target); err != nil {
+					logEngine.NewContextLogEntry(ctx, models.WarnLog, "Couldn't catch up on the missed stars. Err: "+err.Error())
+				}
+			}
+			return nil
+		}
+		eventEngine.Unsubscribe(ctx)
 	}
-	workflowJobUUID[ctx.WorkflowID] = job.ID()
 
-	return nil
+	return schedulerEngine.SchedulePolling(ctx, ctx.PollInterval, checkNewStarOnRepo)
 }
@@ -0,0 +1,408 @@
+package github
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"dawpitech/area/crypto"
+	"dawpitech/area/engines/eventEngine"
+	"dawpitech/area/engines/logEngine"
+	"dawpitech/area/engines/schedulerEngine"
+	"dawpitech/area/engines/workflowEngine"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signatureHeader   = "X-Hub-Signature-256"
+	eventHeader       = "X-GitHub-Event"
+	commitEventType   = "github.commit"
+	starEventType     = "github.star"
+	workflowAttribute = "workflow_id"
+	// maxDeliverySize is the largest payload Github delivers.
+	maxDeliverySize = 25 << 20
+	// maxPushCommits is how many commits a push webhook delivery lists at
+	// most, the others are fetched from the API.
+	maxPushCommits = 2048
+	nullCommitSHA  = "0000000000000000000000000000000000000000"
+)
+
+type hookRequest struct {
+	Name   string   `json:"name"`
+	Active bool     `json:"active"`
+	Events []string `json:"events"`
+	Config struct {
+		URL         string `json:"url"`
+		ContentType string `json:"content_type"`
+		Secret      string `json:"secret"`
+	} `json:"config"`
+}
+
+type PushEvent struct {
+	Ref     string `json:"ref"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+	Deleted bool   `json:"deleted"`
+	Commits []struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+		Author  struct {
+			Name string `json:"name"`
+		} `json:"author"`
+	} `json:"commits"`
+}
+
+type WatchEvent struct {
+	Action string `json:"action"`
+	Sender struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+}
+
+func randomToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func workflowAttributes(workflowID uint) map[string]string {
+	return map[string]string{
+		workflowAttribute: strconv.FormatUint(uint64(workflowID), 10),
+	}
+}
+
+// workflowFilter accepts the events received by the hook of the workflow of
+// the context, each workflow registers its own.
+func workflowFilter(ctx models.Context) eventEngine.Filter {
+	workflowID := strconv.FormatUint(uint64(ctx.WorkflowID), 10)
+	return func(event models.Event) bool {
+		return event.Attributes[workflowAttribute] == workflowID
+	}
+}
+
+// commitEvent is published once per commit, the ones caught up on when the
+// trigger is armed again are ignored if the hook delivers them too.
+func commitEvent(workflowID uint, sha string, message string, author string) models.Event {
+	return models.Event{
+		Type:       commitEventType,
+		SourceID:   fmt.Sprintf("%d:%s", workflowID, sha),
+		Attributes: workflowAttributes(workflowID),
+		Data: map[string]string{
+			"github_new_commit_message": message,
+			"github_new_commit_author":  author,
+		},
+	}
+}
+
+// starEvent is published once per user, starring the repository again
+// before the event is forgotten doesn't run the workflow twice.
+func starEvent(workflowID uint, login string) models.Event {
+	return models.Event{
+		Type:       starEventType,
+		SourceID:   fmt.Sprintf("%d:%s", workflowID, login),
+		Attributes: workflowAttributes(workflowID),
+		Data: map[string]string{
+			"new_star_user": login,
+		},
+	}
+}
+
+type repositoryHook struct {
+	Active bool     `json:"active"`
+	Events []string `json:"events"`
+	Config struct {
+		URL string `json:"url"`
+	} `json:"config"`
+}
+
+func hookURLPrefix() string {
+	return os.Getenv("PUBLIC_URL") + "/providers/github/webhooks/"
+}
+
+func sameEvents(current []string, expected []string) bool {
+	if len(current) != len(expected) {
+		return false
+	}
+	for _, event := range expected {
+		if !slices.Contains(current, event) {
+			return false
+		}
+	}
+	return true
+}
+
+// reusableHook tells if the hook saved for the workflow still delivers the
+// expected events of the repository, it is then kept as is.
+func reusableHook(client *http.Client, hook GithubRepositoryHook, repository string, branch string, events []string) bool {
+	if hook.Repository != repository || hook.Branch != branch {
+		return false
+	}
+	url := fmt.Sprintf("https://api.github.com/repos/%s/hooks/%d", repository, hook.HookID)
+	resp, err := getGithubRequest(client, url, "application/vnd.github+json")
+	if err != nil {
+		return false
+	}
+	var current repositoryHook
+	if err := readGithubResponse(resp, &current); err != nil {
+		return false
+	}
+	return current.Active && sameEvents(current.Events, events) && strings.HasPrefix(current.Config.URL, hookURLPrefix())
+}
+
+// registerHook creates the webhook of the workflow on the repository, false
+// when the token or the repository doesn't allow it. Github refuses the URLs
+// it can't reach, like the ones of a local PUBLIC_URL.
+func registerHook(ctx models.Context, client *http.Client, repository string, branch string, events []string) bool {
+	// The hook is kept when the trigger is only armed again, like by a new
+	// leader. A hook which doesn't deliver the events anymore is replaced.
+	var existing GithubRepositoryHook
+	rst := initializers.DB.Where("workflow_id=?", ctx.WorkflowID).Limit(1).Find(&existing)
+	if rst.Error == nil && rst.RowsAffected == 1 && reusableHook(client, existing, repository, branch, events) {
+		return true
+	}
+	removeHook(ctx, client)
+
+	key, keyErr := randomToken()
+	secret, secretErr := randomToken()
+	if keyErr != nil || secretErr != nil {
+		log.Printf("Couldn't generate the Github webhook secrets of workflow #%d.\n", ctx.WorkflowID)
+		return false
+	}
+
+	request := hookRequest{
+		Name:   "web",
+		Active: true,
+		Events: events,
+	}
+	request.Config.URL = hookURLPrefix() + key
+	request.Config.ContentType = "json"
+	request.Config.Secret = secret
+	body, err := json.Marshal(request)
+	if err != nil {
+		return false
+	}
+
+	url := fmt.Sprintf("https://api.github.com/repos/%s/hooks", repository)
+	resp, err := sendGithubRequest(client, "POST", url, "application/vnd.github+json", body)
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err == nil {
+		err = readGithubResponse(resp, &created)
+	}
+	if err != nil {
+		logEngine.NewContextLogEntry(ctx, models.WarnLog, "Couldn't register a webhook on the repository, it is polled instead. Err: "+err.Error())
+		return false
+	}
+
+	hook := GithubRepositoryHook{
+		WorkflowID: ctx.WorkflowID,
+		HookID:     created.ID,
+		Repository: repository,
+		Branch:     branch,
+		KeyHash:    crypto.HashToken(key),
+		Secret:     secret,
+	}
+	if rst := initializers.DB.Create(&hook); rst.Error != nil {
+		log.Printf("Couldn't save the Github webhook of workflow #%d. Err: %s\n", ctx.WorkflowID, rst.Error.Error())
+		if err := deleteRepositoryHook(client, repository, created.ID); err != nil {
+			log.Print(err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+func deleteRepositoryHook(client *http.Client, repository string, hookID int64) error {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/hooks/%d", repository, hookID)
+	resp, err := sendGithubRequest(client, "DELETE", url, "application/vnd.github+json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return errors.New(fmt.Sprintf("Github API error: %s", resp.Status))
+	}
+	return nil
+}
+
+// removeHook deletes the webhook of the workflow, when the repository can't
+// be reached anymore it is only forgotten. A nil client only forgets it.
+func removeHook(ctx models.Context, client *http.Client) {
+	var hook GithubRepositoryHook
+	rst := initializers.DB.Where("workflow_id=?", ctx.WorkflowID).Limit(1).Find(&hook)
+	if rst.Error != nil {
+		log.Printf("Couldn't load the Github webhook of workflow #%d. Err: %s\n", ctx.WorkflowID, rst.Error.Error())
+		return
+	}
+	if rst.RowsAffected == 0 {
+		return
+	}
+
+	if client == nil {
+		logEngine.NewContextLogEntry(ctx, models.WarnLog, "The Github account is unreachable, the webhook stays on the repository.")
+	} else if err := deleteRepositoryHook(client, hook.Repository, hook.HookID); err != nil {
+		logEngine.NewContextLogEntry(ctx, models.WarnLog, "Couldn't delete the webhook of the repository. Err: "+err.Error())
+	}
+	if rst := initializers.DB.Unscoped().Delete(&hook); rst.Error != nil {
+		log.Printf("Couldn't delete the Github webhook of workflow #%d. Err: %s\n", ctx.WorkflowID, rst.Error.Error())
+	}
+}
+
+// removeHookTrigger stops the events of the workflow and deletes its hook,
+// the workflow was disabled, deleted or edited.
+func removeHookTrigger(ctx models.Context) {
+	eventEngine.Unsubscribe(ctx)
+	client, _ := getOwnerClient(ctx)
+	removeHook(ctx, client)
+}
+
+// suspendHookTrigger stops the trigger on this instance only, the hook keeps
+// delivering the events for the next leader.
+func suspendHookTrigger(ctx models.Context) error {
+	eventEngine.Unsubscribe(ctx)
+	return schedulerEngine.Unschedule(ctx)
+}
+
+// validSignature checks the 'sha256=<hex>' HMAC of the body computed with
+// the secret of the hook.
+func validSignature(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// pushedCommits fetches the commits of a push too large for its delivery to
+// list them all, oldest first.
+func pushedCommits(hook GithubRepositoryHook, push PushEvent) ([]CommitDetail, error) {
+	var workflow models.Workflow
+	if rst := initializers.DB.Where("id=?", hook.WorkflowID).First(&workflow); rst.Error != nil {
+		return nil, rst.Error
+	}
+	client, err := getOwnerClient(workflowEngine.NewContext(workflow))
+	if err != nil {
+		return nil, err
+	}
+	return compareCommits(client, hook.Repository, push.Before, push.After)
+}
+
+func receivePush(hook GithubRepositoryHook, body []byte) error {
+	var push PushEvent
+	if err := json.Unmarshal(body, &push); err != nil {
+		return errors.NewBadRequest(err, "Invalid event.")
+	}
+	if push.Deleted || push.Ref != "refs/heads/"+hook.Branch {
+		return nil
+	}
+
+	// Github lists the commits of the push from the oldest one.
+	commits := make([]CommitDetail, len(push.Commits))
+	for i, commit := range push.Commits {
+		commits[i].SHA = commit.ID
+		commits[i].Commit.Message = commit.Message
+		commits[i].Commit.Author.Name = commit.Author.Name
+	}
+	complete := true
+	if len(push.Commits) >= maxPushCommits && push.Before != "" && push.Before != nullCommitSHA {
+		fetched, err := pushedCommits(hook, push)
+		if err == nil {
+			commits = fetched
+		} else {
+			log.Printf("Couldn't fetch the commits pushed to the repository of workflow #%d. Err: %s\n", hook.WorkflowID, err.Error())
+			complete = false
+		}
+	}
+
+	for _, commit := range commits {
+		if err := eventEngine.Publish(commitEvent(hook.WorkflowID, commit.SHA, commit.Commit.Message, commit.Commit.Author.Name)); err != nil {
+			return errors.New("Internal server error.")
+		}
+	}
+
+	// The cursor of the polling is kept up to date for the catch up, unless
+	// some commits are missing so the catch up can find them.
+	if !complete {
+		return nil
+	}
+	ctx := models.Context{WorkflowID: hook.WorkflowID, ActionName: "github_new_commit"}
+	if err := workflowEngine.SetTriggerState(ctx, lastCommitStateKey, push.After); err != nil {
+		return errors.New("Internal server error.")
+	}
+	return nil
+}
+
+func receiveWatch(hook GithubRepositoryHook, body []byte) error {
+	var watch WatchEvent
+	if err := json.Unmarshal(body, &watch); err != nil {
+		return errors.NewBadRequest(err, "Invalid event.")
+	}
+	if watch.Action != "started" || watch.Sender.Login == "" {
+		return nil
+	}
+
+	if err := eventEngine.Publish(starEvent(hook.WorkflowID, watch.Sender.Login)); err != nil {
+		return errors.New("Internal server error.")
+	}
+
+	ctx := models.Context{WorkflowID: hook.WorkflowID, ActionName: "github_new_star"}
+	if err := workflowEngine.SetTriggerState(ctx, lastStarStateKey, time.Now().Format(time.RFC3339)); err != nil {
+		return errors.New("Internal server error.")
+	}
+	return nil
+}
+
+// ReceiveGithubWebhook receives the deliveries of the hook of a workflow, the
+// URL is given to each hook so they can be told apart.
+func ReceiveGithubWebhook(c *gin.Context) error {
+	var hook GithubRepositoryHook
+	if rst := initializers.DB.Where("key_hash=?", crypto.HashToken(c.Param("key"))).First(&hook); rst.Error != nil {
+		return errors.NotFound
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxDeliverySize))
+	if err != nil {
+		return errors.NewBadRequest(err, "The body of the request couldn't be read or is too large.")
+	}
+	if !validSignature(hook.Secret, body, c.GetHeader(signatureHeader)) {
+		return errors.NewUnauthorized(nil, "Missing or invalid signature.")
+	}
+
+	// Github sends a 'ping' when the hook is created, it only needs to be
+	// acknowledged like the events no trigger uses.
+	switch c.GetHeader(eventHeader) {
+	case "push":
+		err = receivePush(hook, body)
+	case "watch":
+		err = receiveWatch(hook, body)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return nil
+}
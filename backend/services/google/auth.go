@@ -2,24 +2,23 @@ package google
 
 import (
 	"context"
-	"crypto/rand"
+	"dawpitech/area/engines/auditEngine"
+	"dawpitech/area/engines/oauthEngine"
+	"dawpitech/area/engines/organizationEngine"
 	"dawpitech/area/initializers"
+	"dawpitech/area/models"
 	"dawpitech/area/models/routes"
 	"dawpitech/area/utils"
-	"encoding/hex"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/juju/errors"
+	"golang.org/x/oauth2"
+	"log"
 	"net/http"
+	"net/url"
 	"os"
 )
 
-type AuthInitInfo struct {
-	UserID   uint
-	Platform string
-}
-
-var AuthStateMap = map[string]AuthInitInfo{}
-
 func AuthGoogleInit(g *gin.Context, in *routes.ThirdPartyAuthInit) error {
 	maybeUser, ok := g.Get("user")
 
@@ -32,19 +31,23 @@ func AuthGoogleInit(g *gin.Context, in *routes.ThirdPartyAuthInit) error {
 		return errors.BadRequest
 	}
 
-	bytes := make([]byte, 16)
-	if _, err := rand.Read(bytes); err != nil {
+	ownerID, err := organizationEngine.ConnectionOwner(user.ID, in.OrganizationID, models.EditorRole)
+	if err != nil {
+		return err
+	}
+
+	state, err := oauthEngine.SignState("google", oauthEngine.AuthState{
+		UserID:      ownerID,
+		ActorUserID: user.ID,
+		Platform:    in.Platform,
+	})
+	if err != nil {
 		g.AbortWithStatus(http.StatusInternalServerError)
 		return nil
 	}
-	randomString := hex.EncodeToString(bytes)
-	AuthStateMap[randomString] = AuthInitInfo{
-		UserID:   user.ID,
-		Platform: in.Platform,
-	}
 
 	g.IndentedJSON(http.StatusOK, gin.H{
-		"redirect_to": oauthConfig.AuthCodeURL(randomString),
+		"redirect_to": oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce),
 	})
 
 	return nil
@@ -57,7 +60,7 @@ func AuthGoogleCallback(g *gin.Context) error {
 		return nil
 	}
 
-	authInfo, ok := AuthStateMap[reqState]
+	authInfo, ok := oauthEngine.ParseState("google", reqState)
 	if !ok {
 		g.AbortWithStatus(http.StatusBadRequest)
 		return nil
@@ -82,17 +85,41 @@ func AuthGoogleCallback(g *gin.Context) error {
 		return nil
 	}
 
-	model := &ProviderGoogleAuthData{
-		UserID:      authInfo.UserID,
-		AccessToken: token.AccessToken,
-		Scope:       scope,
+	account, err := fetchAccount(oauthConfig.Client(context.Background(), token))
+	if err != nil {
+		log.Print(err.Error())
+		g.AbortWithStatus(http.StatusBadGateway)
+		return nil
+	}
+
+	// Linking an account again replaces the token of its connection, another
+	// account of the same provider gets a new one.
+	var model ProviderGoogleAuthData
+	if err := oauthEngine.FindAccountConnection(&model, authInfo.UserID, account.AccountID); err != nil {
+		g.AbortWithStatus(http.StatusInternalServerError)
+		return nil
 	}
+	model.UserID = authInfo.UserID
+	model.ProviderAccount = account
+	model.Renew(token)
+	model.Scope = scope
 
-	if rst := initializers.DB.Create(&model); rst.Error != nil {
+	if rst := initializers.DB.Save(&model); rst.Error != nil {
 		g.AbortWithStatus(http.StatusInternalServerError)
 		return nil
 	}
 
+	auditEngine.RecordRequest(g, models.AuditEntry{
+		ActorUserID: authInfo.ActorUserID,
+		Action:      models.ProviderLinkAction,
+		TargetType:  models.UserTarget,
+		TargetID:    authInfo.UserID,
+		Details: map[string]string{
+			"provider": "google",
+			"account":  account.AccountName,
+		},
+	})
+
 	var redirectUrl string
 	if authInfo.Platform == "web" {
 		redirectUrl = os.Getenv("PROVIDER_OAUTH2_CALLBACK_URL_WEB")
@@ -105,7 +132,7 @@ func AuthGoogleCallback(g *gin.Context) error {
 	return nil
 }
 
-func AuthGoogleCheck(g *gin.Context) (*routes.ThirdPartyAuthCheck, error) {
+func AuthGoogleCheck(g *gin.Context, in *routes.ThirdPartyAuthCheckRequest) (*routes.ThirdPartyAuthCheck, error) {
 	maybeUser, ok := g.Get("user")
 
 	if !ok {
@@ -117,15 +144,60 @@ func AuthGoogleCheck(g *gin.Context) (*routes.ThirdPartyAuthCheck, error) {
 		return nil, errors.BadRequest
 	}
 
-	var count int64
+	ownerID, err := organizationEngine.ConnectionOwner(user.ID, in.OrganizationID, models.ViewerRole)
+	if err != nil {
+		return nil, err
+	}
+
+	var connections []ProviderGoogleAuthData
 	if rst := initializers.DB.
-		Model(&ProviderGoogleAuthData{}).
-		Where("user_id=?", user.ID).
-		Count(&count); rst.Error != nil {
+		Where("user_id=?", ownerID).
+		Find(&connections); rst.Error != nil {
 		return nil, errors.New("Internal server error")
 	}
 
+	needsReauth := false
+	for _, connection := range connections {
+		needsReauth = needsReauth || connection.NeedsReauth
+	}
+
 	return &routes.ThirdPartyAuthCheck{
-		IsConnected: count >= 1,
+		IsConnected: len(connections) >= 1,
+		NeedsReauth: needsReauth,
 	}, nil
 }
+
+// fetchAccount returns the Google account the token was issued for, its Gmail
+// address identifies it with the scopes we ask.
+func fetchAccount(client *http.Client) (models.ProviderAccount, error) {
+	address, err := getGmailAddress(client)
+	if err != nil {
+		return models.ProviderAccount{}, err
+	}
+	return models.ProviderAccount{
+		AccountID:   address,
+		AccountName: address,
+	}, nil
+}
+
+// revokeToken revokes the whole grant, through the refresh token when there
+// is one since it outlives the access token.
+func revokeToken(token *models.OAuthToken) error {
+	value := token.RefreshToken
+	if value == "" {
+		value = token.AccessToken
+	}
+
+	resp, err := http.PostForm("https://oauth2.googleapis.com/revoke", url.Values{
+		"token": {value},
+	})
+	if err != nil {
+		return errors.New("Google API is not reachable")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("Google API error: %s", resp.Status))
+	}
+	return nil
+}
@@ -1,10 +1,14 @@
 package google
 
-import "gorm.io/gorm"
+import (
+	"dawpitech/area/models"
+	"gorm.io/gorm"
+)
 
 type ProviderGoogleAuthData struct {
 	gorm.Model
-	UserID      uint   `gorm:"not null;index"`
-	AccessToken string `gorm:"size:2048"`
-	Scope       string
+	UserID uint `gorm:"not null;index"`
+	models.ProviderAccount
+	models.OAuthToken
+	Scope string
 }
@@ -113,8 +113,13 @@ var Provider = models.Service{
 		HandlerAuthInit:     AuthGoogleInit,
 		HandlerAuthCallback: AuthGoogleCallback,
 		HandlerAuthCheck:    AuthGoogleCheck,
+		RevokeToken:         revokeToken,
 	},
 	WebhookEndpoints: nil,
+	LoginMethod: &models.LoginMethod{
+		OAuthConfig:   loginOAuthConfig,
+		FetchIdentity: fetchIdentity,
+	},
 	DBModels: []interface{}{
 		&ProviderGoogleAuthData{},
 	},
@@ -3,42 +3,24 @@ package google
 import (
 	"context"
 	"dawpitech/area/engines/logEngine"
+	"dawpitech/area/engines/oauthEngine"
 	"dawpitech/area/engines/workflowEngine"
-	"dawpitech/area/initializers"
 	"dawpitech/area/models"
 	"encoding/base64"
 	"github.com/juju/errors"
-	"golang.org/x/oauth2"
 	"google.golang.org/api/calendar/v3"
 	"google.golang.org/api/gmail/v1"
 	"google.golang.org/api/option"
 )
 
 func HandlerEmptyTrash(ctx models.Context) error {
-	var count int64
-	if rst := initializers.DB.
-		Model(&ProviderGoogleAuthData{}).
-		Where("user_id=?", ctx.OwnerUserID).
-		Count(&count); rst.Error != nil {
-		return errors.New("Internal server error.")
-	}
-
-	if count < 1 {
-		return errors.New("The user has not google account linked.")
-	}
-
 	var OwnerOAuth2Access ProviderGoogleAuthData
-	rst := initializers.DB.Where("user_id=?", ctx.OwnerUserID).First(&OwnerOAuth2Access)
-	if rst.Error != nil {
-		return errors.New("Workflow owner doesn't exist")
-	}
-
-	token := oauth2.Token{
-		AccessToken: OwnerOAuth2Access.AccessToken,
-		TokenType:   "Bearer",
+	if err := oauthEngine.FindConnection(ctx, &OwnerOAuth2Access); err != nil {
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
+		return err
 	}
 
-	client := oauthConfig.Client(context.Background(), &token)
+	client := oauthEngine.NewClient(oauthConfig, &OwnerOAuth2Access)
 	srv, err := gmail.NewService(context.Background(), option.WithHTTPClient(client))
 	if err != nil {
 		return errors.New(err.Error())
@@ -47,14 +29,14 @@ func HandlerEmptyTrash(ctx models.Context) error {
 	listCall := srv.Users.Messages.List("me").Q("in:trash")
 	messagesResponse, err := listCall.Do()
 	if err != nil {
-		return errors.New("Failed to list trash messages: " + err.Error())
+		return apiError(errors.Annotate(err, "Failed to list trash messages"))
 	}
 
 	if messagesResponse.Messages != nil {
 		for _, msg := range messagesResponse.Messages {
 			err = srv.Users.Messages.Delete("me", msg.Id).Do()
 			if err != nil {
-				logEngine.NewLogEntry(ctx.WorkflowID, models.WarnLog, "Failed to delete message "+msg.Id+": "+err.Error())
+				logEngine.NewContextLogEntry(ctx, models.WarnLog, "Failed to delete message "+msg.Id+": "+err.Error())
 				continue
 			}
 		}
@@ -64,19 +46,6 @@ func HandlerEmptyTrash(ctx models.Context) error {
 }
 
 func HandlerSendEmail(ctx models.Context) error {
-	var count int64
-	if rst := initializers.DB.
-		Model(&ProviderGoogleAuthData{}).
-		Where("user_id=?", ctx.OwnerUserID).
-		Count(&count); rst.Error != nil {
-		return errors.New("Internal server error.")
-	}
-
-	if count < 1 {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "No Google Account linked, a github action cannot be used.")
-		return errors.New("The user has not google account linked.")
-	}
-
 	target, targetOK := workflowEngine.GetParam(workflowEngine.ReactionHandler, "google_send_email_target", ctx)
 	body, bodyOK := workflowEngine.GetParam(workflowEngine.ReactionHandler, "google_send_email_body", ctx)
 	subject, subjectOK := workflowEngine.GetParam(workflowEngine.ReactionHandler, "google_send_email_subject", ctx)
@@ -86,17 +55,12 @@ func HandlerSendEmail(ctx models.Context) error {
 	}
 
 	var OwnerOAuth2Access ProviderGoogleAuthData
-	rst := initializers.DB.Where("user_id=?", ctx.OwnerUserID).First(&OwnerOAuth2Access)
-	if rst.Error != nil {
-		return errors.New("Workflow owner doesn't exist")
-	}
-
-	token := oauth2.Token{
-		AccessToken: OwnerOAuth2Access.AccessToken,
-		TokenType:   "Bearer",
+	if err := oauthEngine.FindConnection(ctx, &OwnerOAuth2Access); err != nil {
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
+		return err
 	}
 
-	client := oauthConfig.Client(context.Background(), &token)
+	client := oauthEngine.NewClient(oauthConfig, &OwnerOAuth2Access)
 	srv, err := gmail.NewService(context.Background(), option.WithHTTPClient(client))
 	if err != nil {
 		return errors.New(err.Error())
@@ -119,26 +83,13 @@ func HandlerSendEmail(ctx models.Context) error {
 
 	_, err = srv.Users.Messages.Send("me", &msg).Do()
 	if err != nil {
-		return err
+		return apiError(err)
 	}
 
 	return nil
 }
 
 func HandlerNewCalendarEvent(ctx models.Context) error {
-	var count int64
-	if rst := initializers.DB.
-		Model(&ProviderGoogleAuthData{}).
-		Where("user_id=?", ctx.OwnerUserID).
-		Count(&count); rst.Error != nil {
-		return errors.New("Internal server error.")
-	}
-
-	if count < 1 {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "No Google Account linked, a github action cannot be used.")
-		return errors.New("The user has not google account linked.")
-	}
-
 	name, nameOK := workflowEngine.GetParam(workflowEngine.ReactionHandler, "google_create_event_name", ctx)
 	desc, descOK := workflowEngine.GetParam(workflowEngine.ReactionHandler, "google_create_event_desc", ctx)
 	loc, locOK := workflowEngine.GetParam(workflowEngine.ReactionHandler, "google_create_event_loc", ctx)
@@ -150,17 +101,12 @@ func HandlerNewCalendarEvent(ctx models.Context) error {
 	}
 
 	var OwnerOAuth2Access ProviderGoogleAuthData
-	rst := initializers.DB.Where("user_id=?", ctx.OwnerUserID).First(&OwnerOAuth2Access)
-	if rst.Error != nil {
-		return errors.New("Workflow owner doesn't exist")
-	}
-
-	token := oauth2.Token{
-		AccessToken: OwnerOAuth2Access.AccessToken,
-		TokenType:   "Bearer",
+	if err := oauthEngine.FindConnection(ctx, &OwnerOAuth2Access); err != nil {
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
+		return err
 	}
 
-	client := oauthConfig.Client(context.Background(), &token)
+	client := oauthEngine.NewClient(oauthConfig, &OwnerOAuth2Access)
 	srv, err := calendar.NewService(context.Background(), option.WithHTTPClient(client))
 	if err != nil {
 		return errors.New(err.Error())
@@ -182,8 +128,8 @@ func HandlerNewCalendarEvent(ctx models.Context) error {
 
 	event, err = srv.Events.Insert("primary", event).Do()
 	if err != nil {
-		return errors.New(err.Error())
+		return apiError(err)
 	}
-	logEngine.NewLogEntry(ctx.WorkflowID, models.InfoLog, "Google Calendar event created: "+event.HtmlLink)
+	logEngine.NewContextLogEntry(ctx, models.InfoLog, "Google Calendar event created: "+event.HtmlLink)
 	return nil
 }
@@ -0,0 +1,65 @@
+package google
+
+import (
+	"dawpitech/area/models"
+	"encoding/json"
+	"fmt"
+	"github.com/juju/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"io"
+	"log"
+	"net/http"
+	"os"
+)
+
+// loginOAuthConfig only identifies the user, the Gmail and Calendar access is
+// asked when linking the provider.
+var loginOAuthConfig = &oauth2.Config{
+	ClientID:     os.Getenv("GOOGLE_OAUTH2_CLIENT_ID"),
+	ClientSecret: os.Getenv("GOOGLE_OAUTH2_CLIENT_SECRET"),
+	Endpoint:     google.Endpoint,
+	RedirectURL:  os.Getenv("PUBLIC_URL") + "/auth/social/google/callback",
+	Scopes: []string{
+		"openid",
+		"email",
+	},
+}
+
+type googleUserInfo struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+func fetchIdentity(client *http.Client) (*models.ProviderIdentity, error) {
+	resp, err := client.Get("https://openidconnect.googleapis.com/v1/userinfo")
+	if err != nil {
+		log.Print(err)
+		return nil, errors.New("Google API is not reachable")
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			log.Print(err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("Google API error: %s", resp.Status))
+	}
+
+	var userInfo googleUserInfo
+	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
+		return nil, errors.New("Failed to parse Google response")
+	}
+	if userInfo.Subject == "" {
+		return nil, errors.New("Google didn't return the account ID")
+	}
+
+	return &models.ProviderIdentity{
+		Subject:       userInfo.Subject,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.EmailVerified,
+	}, nil
+}
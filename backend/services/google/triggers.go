@@ -2,85 +2,46 @@ package google
 
 import (
 	"dawpitech/area/engines/logEngine"
+	"dawpitech/area/engines/oauthEngine"
+	"dawpitech/area/engines/schedulerEngine"
 	"dawpitech/area/engines/workflowEngine"
-	"dawpitech/area/initializers"
 	"dawpitech/area/models"
-	"github.com/go-co-op/gocron/v2"
-	"github.com/google/uuid"
 	"github.com/juju/errors"
 	"golang.org/x/net/context"
-	"golang.org/x/oauth2"
 	"google.golang.org/api/calendar/v3"
 	"google.golang.org/api/gmail/v1"
 	"google.golang.org/api/option"
-	"log"
 	"time"
 )
 
-var scheduler gocron.Scheduler
+const lastMessageStateKey = "last_message_id"
+const meetingCooldownStateKey = "meeting_cooldown_until"
 
-var workflowJobUUID = make(map[uint]uuid.UUID)
-var emailJobUUID = make(map[uint]uuid.UUID)
-
-var KnownMeetingCooldownTable = make(map[uint]time.Time)
-var lastCheckedMessageID = make(map[uint]string)
-
-func init() {
-	var err error
-	if scheduler, err = gocron.NewScheduler(); err != nil {
-		log.Panic("Module google couldn't init a job scheduler")
-	}
-	scheduler.Start()
-}
+// messagesPageSize bounds how many unread emails a single check can catch up on.
+const messagesPageSize = 20
 
 func RemoveNewEmailReceived(ctx models.Context) error {
-	err := scheduler.RemoveJob(emailJobUUID[ctx.WorkflowID])
-	if err != nil {
-		return errors.New("Removal of given job resulted in an error.  Err " + err.Error())
-	}
-	delete(emailJobUUID, ctx.WorkflowID)
-	delete(lastCheckedMessageID, ctx.WorkflowID)
-	return nil
+	return schedulerEngine.Unschedule(ctx)
 }
 
 func checkNewEmailReceived(ctx models.Context) {
-	var count int64
-	if rst := initializers.DB.
-		Model(&ProviderGoogleAuthData{}).
-		Where("user_id=?", ctx.OwnerUserID).
-		Count(&count); rst.Error != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Internal server error.")
-		return
-	}
-
-	if count < 1 {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "No Google Account linked, a github action cannot be used.")
-		return
-	}
-
 	var OwnerOAuth2Access ProviderGoogleAuthData
-	rst := initializers.DB.Where("user_id=?", ctx.OwnerUserID).First(&OwnerOAuth2Access)
-	if rst.Error != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Internal server error.")
+	if err := oauthEngine.FindConnection(ctx, &OwnerOAuth2Access); err != nil {
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
 		return
 	}
 
-	token := oauth2.Token{
-		AccessToken: OwnerOAuth2Access.AccessToken,
-		TokenType:   "Bearer",
-	}
-
-	client := oauthConfig.Client(context.Background(), &token)
+	client := oauthEngine.NewClient(oauthConfig, &OwnerOAuth2Access)
 	srv, err := gmail.NewService(context.Background(), option.WithHTTPClient(client))
 	if err != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, err.Error())
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
 		return
 	}
 
-	listCall := srv.Users.Messages.List("me").Q("in:inbox is:unread").MaxResults(1)
+	listCall := srv.Users.Messages.List("me").Q("in:inbox is:unread").MaxResults(messagesPageSize)
 	messagesResponse, err := listCall.Do()
 	if err != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Failed to list messages: "+err.Error())
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, "Failed to list messages: "+err.Error())
 		return
 	}
 
@@ -88,120 +49,100 @@ func checkNewEmailReceived(ctx models.Context) {
 		return
 	}
 
-	latestMessage := messagesResponse.Messages[0]
-	lastMessageID, exists := lastCheckedMessageID[ctx.WorkflowID]
-	if exists && lastMessageID == latestMessage.Id {
+	lastMessageID, _ := workflowEngine.GetTriggerState(ctx, lastMessageStateKey)
+	if lastMessageID == messagesResponse.Messages[0].Id {
 		return
 	}
 
-	message, err := srv.Users.Messages.Get("me", latestMessage.Id).Do()
-	if err != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Failed to get message details: "+err.Error())
-		return
+	// Every email received since the saved one is processed oldest first, when
+	// the saved email isn't part of the page only the latest one is.
+	newMessages := messagesResponse.Messages[:1]
+	for i, message := range messagesResponse.Messages {
+		if message.Id == lastMessageID {
+			newMessages = messagesResponse.Messages[:i]
+			break
+		}
 	}
 
-	var sender, subject string
-	for _, header := range message.Payload.Headers {
-		switch header.Name {
-		case "From":
-			sender = header.Value
-		case "Subject":
-			subject = header.Value
+	for i := len(newMessages) - 1; i >= 0; i-- {
+		message, err := srv.Users.Messages.Get("me", newMessages[i].Id).Do()
+		if err != nil {
+			logEngine.NewContextLogEntry(ctx, models.ErrorLog, "Failed to get message details: "+err.Error())
+			return
 		}
-	}
-	lastCheckedMessageID[ctx.WorkflowID] = latestMessage.Id
 
-	ctx.RuntimeData["google_new_email_sender"] = sender
-	ctx.RuntimeData["google_new_email_subject"] = subject
+		var sender, subject string
+		for _, header := range message.Payload.Headers {
+			switch header.Name {
+			case "From":
+				sender = header.Value
+			case "Subject":
+				subject = header.Value
+			}
+		}
+		if err := workflowEngine.SetTriggerState(ctx, lastMessageStateKey, message.Id); err != nil {
+			logEngine.NewContextLogEntry(ctx, models.ErrorLog, "Couldn't save the last processed email.")
+			return
+		}
+
+		ctx.RuntimeData["google_new_email_sender"] = sender
+		ctx.RuntimeData["google_new_email_subject"] = subject
 
-	workflowEngine.RunWorkflow(ctx)
+		workflowEngine.RunWorkflow(ctx)
+	}
 }
 
 func TriggerNewEmailReceived(ctx models.Context) error {
 	var OwnerOAuth2Access ProviderGoogleAuthData
-	rst := initializers.DB.Where("user_id=?", ctx.OwnerUserID).First(&OwnerOAuth2Access)
-	if rst.Error != nil {
-		return errors.New("Workflow owner doesn't exist")
+	if err := oauthEngine.FindConnection(ctx, &OwnerOAuth2Access); err != nil {
+		return err
 	}
 
-	token := oauth2.Token{
-		AccessToken: OwnerOAuth2Access.AccessToken,
-		TokenType:   "Bearer",
-	}
-
-	client := oauthConfig.Client(context.Background(), &token)
+	client := oauthEngine.NewClient(oauthConfig, &OwnerOAuth2Access)
 	srv, err := gmail.NewService(context.Background(), option.WithHTTPClient(client))
 	if err != nil {
 		return errors.New("Failed to initialize Gmail service: " + err.Error())
 	}
 
-	listCall := srv.Users.Messages.List("me").Q("in:inbox is:unread").MaxResults(1)
-	messagesResponse, err := listCall.Do()
-	if err == nil && messagesResponse.Messages != nil && len(messagesResponse.Messages) > 0 {
-		lastCheckedMessageID[ctx.WorkflowID] = messagesResponse.Messages[0].Id
-	}
-
-	job, err := scheduler.NewJob(
-		gocron.CronJob("* * * * *", false),
-		gocron.NewTask(checkNewEmailReceived, ctx),
-	)
-
-	if err != nil {
-		return errors.New("Set-up of the trigger failed, please re-try later. Err: " + err.Error())
+	// Without catch up, the emails received while the trigger was down are
+	// ignored by starting over from the latest unread one.
+	if _, saved := workflowEngine.GetTriggerState(ctx, lastMessageStateKey); !ctx.CatchUp || !saved {
+		lastMessageID := ""
+		listCall := srv.Users.Messages.List("me").Q("in:inbox is:unread").MaxResults(1)
+		messagesResponse, err := listCall.Do()
+		if err == nil && messagesResponse.Messages != nil && len(messagesResponse.Messages) > 0 {
+			lastMessageID = messagesResponse.Messages[0].Id
+		}
+		if err := workflowEngine.SetTriggerState(ctx, lastMessageStateKey, lastMessageID); err != nil {
+			return errors.New("Internal server error")
+		}
 	}
-	emailJobUUID[ctx.WorkflowID] = job.ID()
 
-	return nil
+	return schedulerEngine.SchedulePolling(ctx, ctx.PollInterval, checkNewEmailReceived)
 }
 
 func RemoveIsInAMeeting(ctx models.Context) error {
-	err := scheduler.RemoveJob(workflowJobUUID[ctx.WorkflowID])
-	if err != nil {
-		return errors.New("Removal of given job resulted in an error. Err " + err.Error())
-	}
-	delete(workflowJobUUID, ctx.WorkflowID)
-	return nil
+	return schedulerEngine.Unschedule(ctx)
 }
 
 func checkIsInAMeeting(ctx models.Context) {
-	var count int64
-	if rst := initializers.DB.
-		Model(&ProviderGoogleAuthData{}).
-		Where("user_id=?", ctx.OwnerUserID).
-		Count(&count); rst.Error != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Internal server error.")
-		return
-	}
-
-	if count < 1 {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "No Google Account linked, a github action cannot be used.")
-		return
-	}
-
 	var OwnerOAuth2Access ProviderGoogleAuthData
-	rst := initializers.DB.Where("user_id=?", ctx.OwnerUserID).First(&OwnerOAuth2Access)
-	if rst.Error != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Internal server error.")
+	if err := oauthEngine.FindConnection(ctx, &OwnerOAuth2Access); err != nil {
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
 		return
 	}
 
-	token := oauth2.Token{
-		AccessToken: OwnerOAuth2Access.AccessToken,
-		TokenType:   "Bearer",
-	}
-
-	_, present := KnownMeetingCooldownTable[ctx.WorkflowID]
-	if present {
-		if time.Now().Before(KnownMeetingCooldownTable[ctx.WorkflowID]) {
+	if cooldown, present := workflowEngine.GetTriggerState(ctx, meetingCooldownStateKey); present {
+		cooldownEnd, err := time.Parse(time.RFC3339, cooldown)
+		if err == nil && time.Now().Before(cooldownEnd) {
 			return
 		}
-		delete(KnownMeetingCooldownTable, ctx.WorkflowID)
 	}
 
-	client := oauthConfig.Client(context.Background(), &token)
+	client := oauthEngine.NewClient(oauthConfig, &OwnerOAuth2Access)
 	srv, err := calendar.NewService(context.Background(), option.WithHTTPClient(client))
 	if err != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, err.Error())
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
 		return
 	}
 
@@ -238,13 +179,13 @@ func checkIsInAMeeting(ctx models.Context) {
 	event, err := srv.Freebusy.Query(freeBusyRequest).Do()
 
 	if err != nil {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, err.Error())
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
 		return
 	}
 
 	freeBusyCalendar, exist := event.Calendars["primary"]
 	if !exist {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Primary google freeBusyCalendar not found")
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, "Primary google freeBusyCalendar not found")
 		return
 	}
 
@@ -254,18 +195,21 @@ func checkIsInAMeeting(ctx models.Context) {
 		for _, busyPeriod := range freeBusyCalendar.Busy {
 			startTime, err := time.Parse(time.RFC3339, busyPeriod.Start)
 			if err != nil {
-				logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Failed to parse start time: "+err.Error())
+				logEngine.NewContextLogEntry(ctx, models.ErrorLog, "Failed to parse start time: "+err.Error())
 				continue
 			}
 
 			endTime, err := time.Parse(time.RFC3339, busyPeriod.End)
 			if err != nil {
-				logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "Failed to parse end time: "+err.Error())
+				logEngine.NewContextLogEntry(ctx, models.ErrorLog, "Failed to parse end time: "+err.Error())
 				continue
 			}
 
 			if now.After(startTime) && now.Before(endTime) {
-				KnownMeetingCooldownTable[ctx.WorkflowID] = endTime
+				if err := workflowEngine.SetTriggerState(ctx, meetingCooldownStateKey, endTime.Format(time.RFC3339)); err != nil {
+					logEngine.NewContextLogEntry(ctx, models.ErrorLog, "Couldn't save the meeting cooldown.")
+					return
+				}
 				workflowEngine.RunWorkflow(ctx)
 				return
 			}
@@ -275,15 +219,5 @@ func checkIsInAMeeting(ctx models.Context) {
 }
 
 func TriggerIsInAMeeting(ctx models.Context) error {
-	job, err := scheduler.NewJob(
-		gocron.CronJob("* * * * *", false),
-		gocron.NewTask(checkIsInAMeeting, ctx),
-	)
-
-	if err != nil {
-		return errors.New("Set-up of the trigger failed, please re-try later. Err: " + err.Error())
-	}
-	workflowJobUUID[ctx.WorkflowID] = job.ID()
-
-	return nil
+	return schedulerEngine.SchedulePolling(ctx, ctx.PollInterval, checkIsInAMeeting)
 }
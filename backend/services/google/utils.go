@@ -1,12 +1,25 @@
 package google
 
 import (
+	"dawpitech/area/models"
 	"encoding/json"
 	"fmt"
+	"github.com/juju/errors"
+	"google.golang.org/api/googleapi"
 	"io"
 	"net/http"
 )
 
+// apiError classifies the errors returned by the Google API clients from the
+// status code of the failed response.
+func apiError(err error) error {
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		return models.NewStatusStepError(googleErr.Code, err)
+	}
+	return err
+}
+
 func getGmailAddress(client *http.Client) (string, error) {
 	url := "https://gmail.googleapis.com/gmail/v1/users/me/profile"
 
@@ -24,7 +37,7 @@ func getGmailAddress(client *http.Client) (string, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return "", models.NewStatusStepError(resp.StatusCode, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body)))
 	}
 
 	// Read and parse the response body
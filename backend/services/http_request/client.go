@@ -0,0 +1,143 @@
+package http_request
+
+import (
+	"context"
+	"dawpitech/area/models"
+	"github.com/juju/errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "github.com/joho/godotenv/autoload" // Assure that the allowlist is loaded before init
+)
+
+const maxRedirects = 5
+
+// blockedNetworks completes the ranges net.IP already knows as private,
+// loopback or link-local.
+var blockedNetworks = parseNetworks([]string{
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+})
+
+// allowedNetworks and allowedHosts come from HTTP_REQUEST_ALLOWLIST, they
+// can be reached even when private.
+var allowedNetworks, allowedHosts = loadAllowlist(os.Getenv("HTTP_REQUEST_ALLOWLIST"))
+
+func parseNetworks(cidrs []string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Panicf("Invalid network '%s'.", cidr)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// loadAllowlist reads a comma separated list of CIDRs, IPs and host names.
+func loadAllowlist(allowlist string) ([]*net.IPNet, map[string]bool) {
+	var networks []*net.IPNet
+	hosts := make(map[string]bool)
+	for _, entry := range strings.Split(allowlist, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			networks = append(networks, network)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		hosts[strings.ToLower(entry)] = true
+	}
+	return networks, hosts
+}
+
+func isBlocked(ip net.IP) bool {
+	for _, network := range allowedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDialedAddress runs once the host name is resolved, right before
+// connecting, so a host name can't resolve to another address afterwards.
+func checkDialedAddress(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || isBlocked(ip) {
+		return models.NewStepError(models.PermanentErrorClass, errors.Errorf("Requests to %s are not allowed.", host))
+	}
+	return nil
+}
+
+func dialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if !allowedHosts[strings.ToLower(host)] {
+		dialer.Control = checkDialedAddress
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+func checkURL(target *url.URL) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return models.NewStepError(models.PermanentErrorClass, errors.Errorf("Unsupported URL scheme '%s'.", target.Scheme))
+	}
+	if target.Hostname() == "" {
+		return models.NewStepError(models.PermanentErrorClass, errors.New("The URL has no host."))
+	}
+	return nil
+}
+
+// client never goes through a proxy, the dialed addresses are the ones
+// checked.
+var client = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          16,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	},
+	CheckRedirect: func(request *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return models.NewStepError(models.PermanentErrorClass, errors.Errorf("Stopped after %d redirects.", maxRedirects))
+		}
+		return checkURL(request.URL)
+	},
+}
@@ -0,0 +1,255 @@
+package http_request
+
+import (
+	"context"
+	"dawpitech/area/engines/workflowEngine"
+	"dawpitech/area/models"
+	"encoding/json"
+	"github.com/juju/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout  = 10 * time.Second
+	maxTimeout      = 60 * time.Second
+	maxResponseSize = 1 << 20
+	headersSource   = "headers"
+)
+
+var allowedMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+type response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+func invalidParameter(format string, args ...interface{}) error {
+	return models.NewStepError(models.PermanentErrorClass, errors.Errorf(format, args...))
+}
+
+func parseTimeout(spec string) (time.Duration, error) {
+	if strings.TrimSpace(spec) == "" {
+		return defaultTimeout, nil
+	}
+	seconds, err := strconv.Atoi(strings.TrimSpace(spec))
+	if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > maxTimeout {
+		return 0, invalidParameter("Invalid timeout '%s', expected 1 to %d seconds.", spec, int(maxTimeout.Seconds()))
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// parseExpectedStatus reads comma separated codes, ranges like '200-204' and
+// classes like '2xx'.
+func parseExpectedStatus(spec string) (func(int) bool, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = "2xx"
+	}
+
+	var ranges [][2]int
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if len(entry) == 3 && strings.HasSuffix(entry, "xx") && entry[0] >= '1' && entry[0] <= '5' {
+			class := int(entry[0]-'0') * 100
+			ranges = append(ranges, [2]int{class, class + 99})
+			continue
+		}
+		low, high, isRange := strings.Cut(entry, "-")
+		lowCode, lowErr := strconv.Atoi(strings.TrimSpace(low))
+		highCode, highErr := lowCode, error(nil)
+		if isRange {
+			highCode, highErr = strconv.Atoi(strings.TrimSpace(high))
+		}
+		if lowErr != nil || highErr != nil || lowCode < 100 || highCode > 599 || lowCode > highCode {
+			return nil, invalidParameter("Invalid expected status '%s'.", entry)
+		}
+		ranges = append(ranges, [2]int{lowCode, highCode})
+	}
+
+	return func(status int) bool {
+		for _, current := range ranges {
+			if status >= current[0] && status <= current[1] {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func parseHeaders(spec string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, line := range strings.Split(spec, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, value, found := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, invalidParameter("Invalid header line, expected 'Name: value'.")
+		}
+		headers.Add(name, strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
+// statusError tells the retry policy which failed responses are worth
+// retrying.
+func statusError(status string, code int) error {
+	return models.NewStatusStepError(code, errors.New("Unexpected HTTP response status: "+status))
+}
+
+func sendRequest(hdxType workflowEngine.HandlerType, ctx models.Context) (*response, error) {
+	rawURL, urlOK := workflowEngine.GetParam(hdxType, "http_url", ctx)
+	if !urlOK {
+		return nil, errors.New("Missing parameters")
+	}
+	method, _ := workflowEngine.GetParam(hdxType, "http_method", ctx)
+	headersSpec, _ := workflowEngine.GetParam(hdxType, "http_headers", ctx)
+	body, _ := workflowEngine.GetParam(hdxType, "http_body", ctx)
+	timeoutSpec, _ := workflowEngine.GetParam(hdxType, "http_timeout", ctx)
+	expectedSpec, _ := workflowEngine.GetParam(hdxType, "http_expected_status", ctx)
+
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if method == "" {
+		method = http.MethodGet
+	}
+	if !slices.Contains(allowedMethods, method) {
+		return nil, invalidParameter("Unsupported method '%s'.", method)
+	}
+	target, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, invalidParameter("Invalid URL.")
+	}
+	if err := checkURL(target); err != nil {
+		return nil, err
+	}
+	headers, err := parseHeaders(headersSpec)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := parseTimeout(timeoutSpec)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := parseExpectedStatus(expectedSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	requestCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var bodyReader io.Reader
+	if body != "" {
+		bodyReader = strings.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(requestCtx, method, target.String(), bodyReader)
+	if err != nil {
+		return nil, invalidParameter("Couldn't build the request: %s", err.Error())
+	}
+	request.Header = headers
+	if body != "" && request.Header.Get("Content-Type") == "" {
+		if json.Valid([]byte(body)) {
+			request.Header.Set("Content-Type", "application/json")
+		} else {
+			request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		}
+	}
+	if request.Header.Get("User-Agent") == "" {
+		request.Header.Set("User-Agent", "AREA")
+	}
+
+	// Only the requests which can't change anything are sent by a dry run.
+	if ctx.RunMode == models.DryRunMode && method != http.MethodGet && method != http.MethodHead {
+		return nil, workflowEngine.ErrSkippedInDryRun
+	}
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if !expected(resp.StatusCode) {
+		return nil, statusError(resp.Status, resp.StatusCode)
+	}
+	return &response{
+		Status: resp.StatusCode,
+		Header: resp.Header,
+		Body:   responseBody,
+	}, nil
+}
+
+func parseExtractions(spec string) ([]workflowEngine.Extraction, error) {
+	return workflowEngine.ParseExtractions(spec, []string{headersSource}, []string{"http_status", "http_response_headers", "http_response_body"})
+}
+
+func extractionOutputs(parameters map[string]string) ([]models.Parameter, error) {
+	extractions, err := parseExtractions(parameters["http_extract"])
+	if err != nil {
+		return nil, err
+	}
+	return workflowEngine.ExtractionOutputs(extractions), nil
+}
+
+func HandlerSend(ctx models.Context) error {
+	_, err := sendRequest(workflowEngine.ReactionHandler, ctx)
+	return err
+}
+
+func HandlerFetch(ctx models.Context) error {
+	extract, _ := workflowEngine.GetParam(workflowEngine.ModifierHandler, "http_extract", ctx)
+	extractions, err := parseExtractions(extract)
+	if err != nil {
+		return models.NewStepError(models.PermanentErrorClass, err)
+	}
+
+	result, err := sendRequest(workflowEngine.ModifierHandler, ctx)
+	if err != nil {
+		return err
+	}
+
+	headers := make(map[string]string, len(result.Header))
+	for name, values := range result.Header {
+		headers[name] = strings.Join(values, ", ")
+	}
+	encodedHeaders, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+
+	ctx.RuntimeData["http_status"] = strconv.Itoa(result.Status)
+	ctx.RuntimeData["http_response_headers"] = string(encodedHeaders)
+	ctx.RuntimeData["http_response_body"] = string(result.Body)
+
+	document := workflowEngine.DecodeJSON(result.Body)
+	for _, extraction := range extractions {
+		if extraction.Source == headersSource {
+			if values := result.Header.Values(extraction.Key); len(values) > 0 {
+				ctx.RuntimeData[extraction.Name] = values[0]
+			}
+			continue
+		}
+		if value, ok := extraction.ExtractJSON(document); ok {
+			ctx.RuntimeData[extraction.Name] = value
+		}
+	}
+	return nil
+}
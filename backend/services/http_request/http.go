@@ -0,0 +1,88 @@
+package http_request
+
+import "dawpitech/area/models"
+
+// requestParameters are shared by the reaction and the modifier.
+var requestParameters = []models.Parameter{
+	{
+		Name:       "http_method",
+		PrettyName: "Method (GET when empty)",
+		Type:       models.String,
+	},
+	{
+		Name:       "http_url",
+		PrettyName: "URL",
+		Type:       models.String,
+	},
+	{
+		Name:       "http_headers",
+		PrettyName: "Headers, one 'Name: value' per line",
+		Type:       models.String,
+		Sensitive:  true,
+	},
+	{
+		Name:       "http_body",
+		PrettyName: "Body",
+		Type:       models.String,
+	},
+	{
+		Name:       "http_timeout",
+		PrettyName: "Timeout in seconds (10 when empty)",
+		Type:       models.String,
+	},
+	{
+		Name:       "http_expected_status",
+		PrettyName: "Expected status, like '200', '200-204' or '2xx' (2xx when empty)",
+		Type:       models.String,
+	},
+}
+
+var Provider = models.Service{
+	Name:    "HTTP",
+	Hidden:  false,
+	Actions: nil,
+	Modifiers: []models.Modifier{
+		{
+			Name:        "http_request_fetch",
+			PrettyName:  "Fetch a URL",
+			Description: "Send an HTTP request and keep its response, the values to keep are picked with one 'name=path' per line, like 'id=body.items[0].id' or 'etag=headers.ETag'",
+			Parameters: append(append([]models.Parameter{}, requestParameters...), models.Parameter{
+				Name:       "http_extract",
+				PrettyName: "Values to extract",
+				Type:       models.String,
+			}),
+			Outputs: []models.Parameter{
+				{
+					Name:       "http_status",
+					PrettyName: "Status code of the response",
+					Type:       models.String,
+				},
+				{
+					Name:       "http_response_headers",
+					PrettyName: "Headers of the response, as a JSON object",
+					Type:       models.String,
+				},
+				{
+					Name:       "http_response_body",
+					PrettyName: "Body of the response",
+					Type:       models.String,
+				},
+			},
+			DynamicOutputs: extractionOutputs,
+			Handler:        HandlerFetch,
+		},
+	},
+	Reactions: []models.Reaction{
+		{
+			Name:        "http_request_send",
+			PrettyName:  "Send an HTTP request",
+			Description: "Send an HTTP request, the run fails when the response status isn't the expected one",
+			Parameters:  requestParameters,
+			Handler:     HandlerSend,
+		},
+	},
+	AuthMethod:       nil,
+	WebhookEndpoints: nil,
+	LoginMethod:      nil,
+	DBModels:         nil,
+}
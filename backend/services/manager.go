@@ -7,10 +7,12 @@ import (
 	"dawpitech/area/services/discord_webhook"
 	"dawpitech/area/services/github"
 	"dawpitech/area/services/google"
+	"dawpitech/area/services/http_request"
 	"dawpitech/area/services/notion"
 	"dawpitech/area/services/openai"
 	"dawpitech/area/services/placeholder"
 	"dawpitech/area/services/timer"
+	"dawpitech/area/services/webhook"
 	"dawpitech/area/stores"
 	"fmt"
 	"log"
@@ -30,6 +32,8 @@ var Services = []models.Service{
 	google.Provider,
 	notion.Provider,
 	buttplug.Provider,
+	webhook.Provider,
+	http_request.Provider,
 }
 
 func Init() {
@@ -70,6 +74,17 @@ func Init() {
 
 func RegisterServiceRoutes(router *fizz.Fizz) {
 	providersRoute := router.Group("", "Providers specific routes", "WIP")
+	providersRoute.GET(
+		"/providers",
+		[]fizz.OperationOption{
+			fizz.Summary("Retrieve the provider accounts linked by the user"),
+			fizz.Security(&openapi.SecurityRequirement{
+				"bearerAuth": []string{},
+			}),
+		},
+		middlewares.CheckAuth,
+		tonic.Handler(GetAllConnections, 200),
+	)
 	for i := 0; i < len(Services); i++ {
 		service := Services[i]
 		routeBase := fmt.Sprintf("/providers/%s/auth", strings.ToLower(service.Name))
@@ -102,6 +117,18 @@ func RegisterServiceRoutes(router *fizz.Fizz) {
 				middlewares.CheckAuth,
 				tonic.Handler(service.AuthMethod.HandlerAuthCheck, 200),
 			)
+			providersRoute.DELETE(
+				routeBase,
+				[]fizz.OperationOption{
+					fizz.Summary("Unlink the accounts of the provider"),
+					fizz.ID(fmt.Sprintf("Delete%sConnections", service.Name)),
+					fizz.Security(&openapi.SecurityRequirement{
+						"bearerAuth": []string{},
+					}),
+				},
+				middlewares.CheckAuth,
+				tonic.Handler(deleteConnectionHandler(service), 200),
+			)
 		}
 		if service.WebhookEndpoints != nil {
 			for _, endpoint := range service.WebhookEndpoints {
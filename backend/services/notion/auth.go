@@ -2,26 +2,22 @@ package notion
 
 import (
 	"context"
-	"crypto/rand"
+	"dawpitech/area/engines/auditEngine"
+	"dawpitech/area/engines/oauthEngine"
+	"dawpitech/area/engines/organizationEngine"
 	"dawpitech/area/initializers"
+	"dawpitech/area/models"
 	"dawpitech/area/models/routes"
 	"dawpitech/area/utils"
-	"encoding/hex"
 	"github.com/gin-gonic/gin"
 	"github.com/juju/errors"
+	"golang.org/x/oauth2"
 	"log"
 	"net/http"
 	"os"
 	"strings"
 )
 
-type AuthInitInfo struct {
-	UserID   uint
-	Platform string
-}
-
-var AuthStateMap = map[string]AuthInitInfo{}
-
 func AuthNotionInit(g *gin.Context, in *routes.ThirdPartyAuthInit) error {
 	maybeUser, ok := g.Get("user")
 
@@ -34,19 +30,23 @@ func AuthNotionInit(g *gin.Context, in *routes.ThirdPartyAuthInit) error {
 		return errors.BadRequest
 	}
 
-	bytes := make([]byte, 16)
-	if _, err := rand.Read(bytes); err != nil {
+	ownerID, err := organizationEngine.ConnectionOwner(user.ID, in.OrganizationID, models.EditorRole)
+	if err != nil {
+		return err
+	}
+
+	state, err := oauthEngine.SignState("notion", oauthEngine.AuthState{
+		UserID:      ownerID,
+		ActorUserID: user.ID,
+		Platform:    in.Platform,
+	})
+	if err != nil {
 		g.AbortWithStatus(http.StatusInternalServerError)
 		return nil
 	}
-	randomString := hex.EncodeToString(bytes)
-	AuthStateMap[randomString] = AuthInitInfo{
-		UserID:   user.ID,
-		Platform: in.Platform,
-	}
 
 	g.IndentedJSON(http.StatusOK, gin.H{
-		"redirect_to": oauthConfig.AuthCodeURL(randomString),
+		"redirect_to": oauthConfig.AuthCodeURL(state),
 	})
 
 	return nil
@@ -59,7 +59,7 @@ func AuthNotionCallback(g *gin.Context) error {
 		return nil
 	}
 
-	authInfo, ok := AuthStateMap[reqState]
+	authInfo, ok := oauthEngine.ParseState("notion", reqState)
 	if !ok {
 		g.AbortWithStatus(http.StatusBadRequest)
 		return nil
@@ -78,17 +78,45 @@ func AuthNotionCallback(g *gin.Context) error {
 		return nil
 	}
 
-	model := &ProviderNotionAuthData{
-		UserID:      authInfo.UserID,
-		AccessToken: token.AccessToken,
-		Scope:       strings.Join(oauthConfig.Scopes, " "),
+	account, err := accountFromToken(token)
+	if err != nil {
+		log.Print(err.Error())
+		g.AbortWithStatus(http.StatusBadGateway)
+		return nil
 	}
 
-	if rst := initializers.DB.Create(&model); rst.Error != nil {
+	// Linking an account again replaces the token of its connection, another
+	// account of the same provider gets a new one.
+	var model ProviderNotionAuthData
+	if err := oauthEngine.FindAccountConnection(&model, authInfo.UserID, account.AccountID); err != nil {
+		g.AbortWithStatus(http.StatusInternalServerError)
+		return nil
+	}
+	model.UserID = authInfo.UserID
+	model.ProviderAccount = account
+	model.Renew(token)
+	model.Scope = strings.Join(oauthConfig.Scopes, " ")
+	if err := ensureWebhookKey(&model); err != nil {
 		g.AbortWithStatus(http.StatusInternalServerError)
 		return nil
 	}
 
+	if rst := initializers.DB.Save(&model); rst.Error != nil {
+		g.AbortWithStatus(http.StatusInternalServerError)
+		return nil
+	}
+
+	auditEngine.RecordRequest(g, models.AuditEntry{
+		ActorUserID: authInfo.ActorUserID,
+		Action:      models.ProviderLinkAction,
+		TargetType:  models.UserTarget,
+		TargetID:    authInfo.UserID,
+		Details: map[string]string{
+			"provider": "notion",
+			"account":  account.AccountName,
+		},
+	})
+
 	var redirectUrl string
 	if authInfo.Platform == "web" {
 		redirectUrl = os.Getenv("PROVIDER_OAUTH2_CALLBACK_URL_WEB")
@@ -102,7 +130,7 @@ func AuthNotionCallback(g *gin.Context) error {
 	return nil
 }
 
-func AuthNotionCheck(g *gin.Context) (*routes.ThirdPartyAuthCheck, error) {
+func AuthNotionCheck(g *gin.Context, in *routes.ThirdPartyAuthCheckRequest) (*routes.ThirdPartyAuthCheck, error) {
 	maybeUser, ok := g.Get("user")
 
 	if !ok {
@@ -114,15 +142,39 @@ func AuthNotionCheck(g *gin.Context) (*routes.ThirdPartyAuthCheck, error) {
 		return nil, errors.BadRequest
 	}
 
-	var count int64
+	ownerID, err := organizationEngine.ConnectionOwner(user.ID, in.OrganizationID, models.ViewerRole)
+	if err != nil {
+		return nil, err
+	}
+
+	var connections []ProviderNotionAuthData
 	if rst := initializers.DB.
-		Model(&ProviderNotionAuthData{}).
-		Where("user_id=?", user.ID).
-		Count(&count); rst.Error != nil {
+		Where("user_id=?", ownerID).
+		Find(&connections); rst.Error != nil {
 		return nil, errors.New("Internal server error")
 	}
 
+	needsReauth := false
+	for _, connection := range connections {
+		needsReauth = needsReauth || connection.NeedsReauth
+	}
+
 	return &routes.ThirdPartyAuthCheck{
-		IsConnected: count >= 1,
+		IsConnected: len(connections) >= 1,
+		NeedsReauth: needsReauth,
+	}, nil
+}
+
+// accountFromToken returns the workspace the token was issued for, Notion
+// sends it along the token.
+func accountFromToken(token *oauth2.Token) (models.ProviderAccount, error) {
+	workspaceID, _ := token.Extra("workspace_id").(string)
+	if workspaceID == "" {
+		return models.ProviderAccount{}, errors.New("Notion didn't return the workspace ID")
+	}
+	workspaceName, _ := token.Extra("workspace_name").(string)
+	return models.ProviderAccount{
+		AccountID:   workspaceID,
+		AccountName: workspaceName,
 	}, nil
 }
@@ -1,12 +1,19 @@
 package notion
 
 import (
+	"dawpitech/area/models"
 	"gorm.io/gorm"
 )
 
 type ProviderNotionAuthData struct {
 	gorm.Model
-	UserID      uint   `gorm:"not null;index"`
-	AccessToken string `gorm:"size:2048"`
-	Scope       string
+	UserID uint `gorm:"not null;index"`
+	models.ProviderAccount
+	models.OAuthToken
+	Scope string
+	// WebhookKey is the secret part of the URL receiving the events of the
+	// workspace, they are signed with WebhookVerificationToken.
+	WebhookKeyHash           string `gorm:"index"`
+	WebhookKey               string `gorm:"type:text;serializer:encrypted"`
+	WebhookVerificationToken string `gorm:"type:text;serializer:encrypted"`
 }
@@ -3,8 +3,8 @@ package notion
 import (
 	"bytes"
 	"dawpitech/area/engines/logEngine"
+	"dawpitech/area/engines/oauthEngine"
 	"dawpitech/area/engines/workflowEngine"
-	"dawpitech/area/initializers"
 	"dawpitech/area/models"
 	"encoding/json"
 	"io"
@@ -26,19 +26,6 @@ type CommentRequest struct {
 }
 
 func HandlerNotionRespondToThread(ctx models.Context) error {
-	var count int64
-	if rst := initializers.DB.
-		Model(&ProviderNotionAuthData{}).
-		Where("user_id=?", ctx.OwnerUserID).
-		Count(&count); rst.Error != nil {
-		return errors.New("Internal server error.")
-	}
-
-	if count < 1 {
-		logEngine.NewLogEntry(ctx.WorkflowID, models.ErrorLog, "No Notion Account linked, a notion comment cannot be sent.")
-		return errors.New("The user has no notion account linked.")
-	}
-
 	target, targetOK := workflowEngine.GetParam(workflowEngine.ReactionHandler, "discussion_id", ctx)
 	commentContent, commentContentOK := workflowEngine.GetParam(workflowEngine.ReactionHandler, "comment_content", ctx)
 
@@ -47,13 +34,11 @@ func HandlerNotionRespondToThread(ctx models.Context) error {
 	}
 
 	var OwnerOAuth2Access ProviderNotionAuthData
-	rst := initializers.DB.Where("user_id=?", ctx.OwnerUserID).First(&OwnerOAuth2Access)
-	if rst.Error != nil {
-		return errors.New("Workflow owner doesn't exist")
+	if err := oauthEngine.FindConnection(ctx, &OwnerOAuth2Access); err != nil {
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
+		return err
 	}
 
-	token := OwnerOAuth2Access.AccessToken
-
 	reqBody := CommentRequest{
 		DiscID: target,
 		RichText: []RichText{
@@ -79,16 +64,18 @@ func HandlerNotionRespondToThread(ctx models.Context) error {
 		return errors.New("Notion API is not reachable")
 	}
 
-	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Notion-Version", "2022-06-28")
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
+	client := oauthEngine.NewClient(oauthConfig, &OwnerOAuth2Access)
 
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Print(err)
-		return errors.New("Notion API is not reachable")
+		if errors.Is(err, oauthEngine.ErrNeedsReauth) {
+			return models.NewStepError(models.PermanentErrorClass, oauthEngine.ErrNeedsReauth)
+		}
+		return models.NewStepError(models.NetworkErrorClass, errors.New("Notion API is not reachable"))
 	}
 
 	defer func(Body io.ReadCloser) {
@@ -99,5 +86,8 @@ func HandlerNotionRespondToThread(ctx models.Context) error {
 	}(resp.Body)
 
 	_, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return models.NewStatusStepError(resp.StatusCode, errors.New("Notion API error: "+resp.Status))
+	}
 	return nil
 }
@@ -113,13 +113,16 @@ var Provider = models.Service{
 		HandlerAuthInit:     AuthNotionInit,
 		HandlerAuthCallback: AuthNotionCallback,
 		HandlerAuthCheck:    AuthNotionCheck,
+		RevokeToken:         nil,
+		ConnectionWebhook:   ConnectionWebhook,
 	},
 	WebhookEndpoints: []models.WebhookEndpoint{
 		{
-			EndpointURL:   "/providers/notion/webhooks/1",
+			EndpointURL:   "/providers/notion/webhooks/:key",
 			HandlerMethod: TriggerNotion,
 		},
 	},
+	LoginMethod: nil,
 	DBModels: []interface{}{
 		&ProviderNotionAuthData{},
 	},
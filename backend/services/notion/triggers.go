@@ -1,63 +1,37 @@
 package notion
 
 import (
-	"dawpitech/area/engines/workflowEngine"
+	"dawpitech/area/engines/eventEngine"
+	"dawpitech/area/initializers"
 	"dawpitech/area/models"
 	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
 	"io"
 	"log"
-	"sync"
+	"net/http"
 	"time"
-
-	"github.com/go-co-op/gocron/v2"
-	"github.com/google/uuid"
-	"github.com/juju/errors"
-
-	"github.com/gin-gonic/gin"
-)
-
-var (
-	mu              sync.Mutex
-	events          []any
-	scheduler       gocron.Scheduler
-	workflowJobUUID = make(map[uint]uuid.UUID)
 )
 
-func init() {
-	var err error
-	if scheduler, err = gocron.NewScheduler(); err != nil {
-		log.Panic("Module notion couldn't init a job scheduler")
-	}
-	scheduler.Start()
-}
-
-func StoreEvent(event any) {
-	mu.Lock()
-	defer mu.Unlock()
-	events = append(events, event)
-}
+const maxEventSize = 1 << 20
 
-func GetEvents() []any {
-	mu.Lock()
-	defer mu.Unlock()
-	return append([]any{}, events...)
+// actionEvents maps the actions to the type of Notion event they fire on.
+var actionEvents = map[string]string{
+	"notion_page_created":  "page.created",
+	"notion_page_deleted":  "page.deleted",
+	"notion_page_restored": "page.undeleted",
 }
 
-func ClearEventsByType(eventType string) {
-	mu.Lock()
-	defer mu.Unlock()
-	var filteredEvents []any
-	for _, eventInterface := range events {
-		event, ok := eventInterface.(WebhookEvent)
-		if !ok {
-			filteredEvents = append(filteredEvents, eventInterface)
-			continue
-		}
-		if event.Type != eventType {
-			filteredEvents = append(filteredEvents, eventInterface)
+// subscribedEvent tells if an action fires on the type of event, the others
+// aren't kept.
+func subscribedEvent(eventType string) bool {
+	for _, actionEvent := range actionEvents {
+		if actionEvent == eventType {
+			return true
 		}
 	}
-	events = filteredEvents
+	return false
 }
 
 type WebhookEvent struct {
@@ -77,30 +51,80 @@ type WebhookEvent struct {
 	Data map[string]any `json:"data"`
 }
 
+// TriggerNotion receives the events of the workspace of a connection, the
+// URL is given to each connection so they can be told apart.
 func TriggerNotion(g *gin.Context) error {
-	body, err := io.ReadAll(g.Request.Body)
+	connection, err := findWebhookConnection(g.Param("key"))
 	if err != nil {
 		return err
 	}
 
+	body, err := io.ReadAll(http.MaxBytesReader(g.Writer, g.Request.Body, maxEventSize))
+	if err != nil {
+		return errors.NewBadRequest(err, "The body of the request couldn't be read or is too large.")
+	}
+
+	// Notion sends the token once when the subscription is created, the
+	// next ones are ignored until the workspace is unlinked.
 	var verification struct {
 		VerificationToken string `json:"verification_token"`
 	}
 	if err := json.Unmarshal(body, &verification); err == nil && verification.VerificationToken != "" {
-		log.Println("notion verification token:", verification.VerificationToken)
-
-		g.Status(200)
+		if connection.WebhookVerificationToken != "" {
+			log.Printf("Ignored a new Notion verification token for connection #%d.\n", connection.ID)
+			g.Status(http.StatusOK)
+			return nil
+		}
+		connection.WebhookVerificationToken = verification.VerificationToken
+		if rst := initializers.DB.
+			Model(connection).
+			Select("webhook_verification_token").
+			Updates(connection); rst.Error != nil {
+			return errors.New("Internal server error.")
+		}
+		g.Status(http.StatusOK)
 		return nil
 	}
 
+	if !validSignature(connection.WebhookVerificationToken, body, g.GetHeader(signatureHeader)) {
+		return errors.NewUnauthorized(nil, "Missing or invalid signature.")
+	}
+
 	var event WebhookEvent
 	if err := json.Unmarshal(body, &event); err != nil {
-		return err
+		return errors.NewBadRequest(err, "Invalid event.")
+	}
+	if event.WorkspaceID != connection.AccountID {
+		log.Printf("Ignored a Notion event of workspace '%s' sent to connection #%d.\n", event.WorkspaceID, connection.ID)
+		g.Status(http.StatusOK)
+		return nil
+	}
+
+	if !subscribedEvent(event.Type) {
+		g.Status(http.StatusOK)
+		return nil
 	}
 
-	StoreEvent(event)
+	// The workflows are run once the event is saved, Notion sends it again
+	// when it isn't acknowledged.
+	sourceID := ""
+	if event.ID != "" {
+		sourceID = fmt.Sprintf("%d:%s", connection.ID, event.ID)
+	}
+	if err := eventEngine.Publish(models.Event{
+		Type:       "notion." + event.Type,
+		SourceID:   sourceID,
+		Attributes: eventEngine.ConnectionAttributes(connection.UserID, connection.ID),
+		Data: map[string]string{
+			"page_id":      event.Entity.ID,
+			"timestamp":    event.Timestamp.Format(time.RFC3339),
+			"workspace_id": event.WorkspaceID,
+		},
+	}); err != nil {
+		return errors.New("Internal server error.")
+	}
 
-	g.Status(200)
+	g.Status(http.StatusOK)
 	return nil
 }
 
@@ -108,143 +132,36 @@ func EmptyRemove(ctx models.Context) error {
 	return nil
 }
 
-func checkNotionPageCreated(ctx models.Context) {
-	events := GetEvents()
-
-	for _, eventInterface := range events {
-		event, ok := eventInterface.(WebhookEvent)
-		if !ok {
-			continue
-		}
-
-		if event.Type == "page.created" {
-			ctx.RuntimeData = make(map[string]string)
-			ctx.RuntimeData["page_id"] = event.Entity.ID
-			ctx.RuntimeData["timestamp"] = event.Timestamp.Format(time.RFC3339)
-			ctx.RuntimeData["workspace_id"] = event.WorkspaceID
-
-			ClearEventsByType("page.created")
-			workflowEngine.RunWorkflow(ctx)
-			return
-		}
-	}
-}
-
-func checkNotionPageDeleted(ctx models.Context) {
-	events := GetEvents()
-
-	for _, eventInterface := range events {
-		event, ok := eventInterface.(WebhookEvent)
-		if !ok {
-			continue
-		}
-
-		if event.Type == "page.deleted" {
-			ctx.RuntimeData = make(map[string]string)
-			ctx.RuntimeData["page_id"] = event.Entity.ID
-			ctx.RuntimeData["timestamp"] = event.Timestamp.Format(time.RFC3339)
-			ctx.RuntimeData["workspace_id"] = event.WorkspaceID
-
-			ClearEventsByType("page.deleted")
-			workflowEngine.RunWorkflow(ctx)
-			return
-		}
-	}
+func setupEventTrigger(ctx models.Context) error {
+	eventEngine.Subscribe(ctx, "notion."+actionEvents[ctx.ActionName], eventEngine.ConnectionFilter(ctx))
+	return nil
 }
 
-func checkNotionPageRestored(ctx models.Context) {
-	events := GetEvents()
-
-	for _, eventInterface := range events {
-		event, ok := eventInterface.(WebhookEvent)
-		if !ok {
-			continue
-		}
-
-		if event.Type == "page.undeleted" {
-			ctx.RuntimeData = make(map[string]string)
-			ctx.RuntimeData["page_id"] = event.Entity.ID
-			ctx.RuntimeData["timestamp"] = event.Timestamp.Format(time.RFC3339)
-			ctx.RuntimeData["workspace_id"] = event.WorkspaceID
-
-			ClearEventsByType("page.undeleted")
-			workflowEngine.RunWorkflow(ctx)
-			return
-		}
-	}
+func removeEventTrigger(ctx models.Context) error {
+	eventEngine.Unsubscribe(ctx)
+	return nil
 }
 
 func SetupNotionPageCreatedTrigger(ctx models.Context) error {
-	ClearEventsByType("page.created")
-
-	job, err := scheduler.NewJob(
-		gocron.CronJob("* * * * *", false),
-		gocron.NewTask(checkNotionPageCreated, ctx),
-	)
-
-	if err != nil {
-		return errors.New("Set-up of the trigger failed, please re-try later. Err: " + err.Error())
-	}
-	workflowJobUUID[ctx.WorkflowID] = job.ID()
-
-	return nil
+	return setupEventTrigger(ctx)
 }
 
 func RemoveNotionPageCreatedTrigger(ctx models.Context) error {
-	err := scheduler.RemoveJob(workflowJobUUID[ctx.WorkflowID])
-	if err != nil {
-		return errors.New("Removal of given job resulted in an error. Err " + err.Error())
-	}
-	delete(workflowJobUUID, ctx.WorkflowID)
-	return nil
+	return removeEventTrigger(ctx)
 }
 
 func SetupNotionPageDeletedTrigger(ctx models.Context) error {
-	ClearEventsByType("page.deleted")
-
-	job, err := scheduler.NewJob(
-		gocron.CronJob("* * * * *", false),
-		gocron.NewTask(checkNotionPageDeleted, ctx),
-	)
-
-	if err != nil {
-		return errors.New("Set-up of the trigger failed, please re-try later. Err: " + err.Error())
-	}
-	workflowJobUUID[ctx.WorkflowID] = job.ID()
-
-	return nil
+	return setupEventTrigger(ctx)
 }
 
 func RemoveNotionPageDeletedTrigger(ctx models.Context) error {
-	err := scheduler.RemoveJob(workflowJobUUID[ctx.WorkflowID])
-	if err != nil {
-		return errors.New("Removal of given job resulted in an error. Err " + err.Error())
-	}
-	delete(workflowJobUUID, ctx.WorkflowID)
-	return nil
+	return removeEventTrigger(ctx)
 }
 
 func SetupNotionPageRestoredTrigger(ctx models.Context) error {
-	ClearEventsByType("page.undeleted")
-
-	job, err := scheduler.NewJob(
-		gocron.CronJob("* * * * *", false),
-		gocron.NewTask(checkNotionPageRestored, ctx),
-	)
-
-	if err != nil {
-		return errors.New("Set-up of the trigger failed, please re-try later. Err: " + err.Error())
-	}
-	workflowJobUUID[ctx.WorkflowID] = job.ID()
-
-	return nil
+	return setupEventTrigger(ctx)
 }
 
 func RemoveNotionPageRestoredTrigger(ctx models.Context) error {
-	err := scheduler.RemoveJob(workflowJobUUID[ctx.WorkflowID])
-	if err != nil {
-		return errors.New("Removal of given job resulted in an error. Err " + err.Error())
-	}
-	delete(workflowJobUUID, ctx.WorkflowID)
-	return nil
+	return removeEventTrigger(ctx)
 }
@@ -0,0 +1,79 @@
+package notion
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"dawpitech/area/crypto"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/juju/errors"
+	"os"
+	"strings"
+)
+
+const signatureHeader = "X-Notion-Signature"
+
+// ensureWebhookKey gives the connection the key of its webhook URL, the
+// connections linked before webhooks existed get theirs on first use.
+func ensureWebhookKey(connection *ProviderNotionAuthData) error {
+	if connection.WebhookKey != "" {
+		return nil
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	connection.WebhookKey = base64.RawURLEncoding.EncodeToString(secret)
+	connection.WebhookKeyHash = crypto.HashToken(connection.WebhookKey)
+	return nil
+}
+
+// ConnectionWebhook returns the URL of the webhook subscription to create in
+// the Notion integration settings for the connection.
+func ConnectionWebhook(connectionID uint) (*models.ConnectionWebhook, error) {
+	var connection ProviderNotionAuthData
+	if rst := initializers.DB.Where("id=?", connectionID).First(&connection); rst.Error != nil {
+		return nil, rst.Error
+	}
+	if connection.WebhookKey == "" {
+		if err := ensureWebhookKey(&connection); err != nil {
+			return nil, err
+		}
+		if rst := initializers.DB.
+			Model(&connection).
+			Select("webhook_key", "webhook_key_hash").
+			Updates(&connection); rst.Error != nil {
+			return nil, rst.Error
+		}
+	}
+	return &models.ConnectionWebhook{
+		URL:               os.Getenv("PUBLIC_URL") + "/providers/notion/webhooks/" + connection.WebhookKey,
+		VerificationToken: connection.WebhookVerificationToken,
+	}, nil
+}
+
+func findWebhookConnection(key string) (*ProviderNotionAuthData, error) {
+	var connection ProviderNotionAuthData
+	if rst := initializers.DB.Where("webhook_key_hash=?", crypto.HashToken(key)).First(&connection); rst.Error != nil {
+		return nil, errors.NotFound
+	}
+	return &connection, nil
+}
+
+// validSignature checks the 'sha256=<hex>' HMAC of the body Notion computes
+// with the verification token.
+func validSignature(verificationToken string, body []byte, signature string) bool {
+	if verificationToken == "" || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(verificationToken))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
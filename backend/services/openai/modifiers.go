@@ -36,6 +36,10 @@ func HandlerAskChatGPT(ctx models.Context) error {
 		},
 	)
 	if err != nil {
+		var apiErr *openai.Error
+		if errors.As(err, &apiErr) {
+			return models.NewStatusStepError(apiErr.StatusCode, err)
+		}
 		return err
 	}
 	ctx.RuntimeData["chatgpt_output"] = response.OutputText()
@@ -31,5 +31,6 @@ var Provider = models.Service{
 	Reactions:        nil,
 	AuthMethod:       nil,
 	WebhookEndpoints: nil,
+	LoginMethod:      nil,
 	DBModels:         nil,
 }
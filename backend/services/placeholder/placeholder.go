@@ -39,5 +39,6 @@ var Provider = models.Service{
 	},
 	AuthMethod:       nil,
 	WebhookEndpoints: nil,
+	LoginMethod:      nil,
 	DBModels:         nil,
 }
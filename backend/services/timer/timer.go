@@ -2,22 +2,8 @@ package timer
 
 import (
 	"dawpitech/area/models"
-	"github.com/go-co-op/gocron/v2"
-	"github.com/google/uuid"
-	"log"
 )
 
-var scheduler gocron.Scheduler
-var workflowJobUUID = make(map[uint]uuid.UUID)
-
-func init() {
-	var err error
-	if scheduler, err = gocron.NewScheduler(); err != nil {
-		log.Panic("Module timer couldn't init a job scheduler")
-	}
-	scheduler.Start()
-}
-
 var Provider = models.Service{
 	Name: "Timer",
 	Actions: []models.Action{
@@ -50,5 +36,6 @@ var Provider = models.Service{
 	Reactions:        nil,
 	AuthMethod:       nil,
 	WebhookEndpoints: nil,
+	LoginMethod:      nil,
 	DBModels:         nil,
 }
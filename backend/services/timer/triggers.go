@@ -1,20 +1,17 @@
 package timer
 
 import (
+	"dawpitech/area/engines/logEngine"
+	"dawpitech/area/engines/schedulerEngine"
 	"dawpitech/area/engines/workflowEngine"
 	"dawpitech/area/models"
-	"github.com/go-co-op/gocron/v2"
 	"github.com/juju/errors"
+	"github.com/robfig/cron/v3"
 	"log"
+	"time"
 )
 
-func init() {
-	var err error
-	if scheduler, err = gocron.NewScheduler(); err != nil {
-		log.Panic("Module timer couldn't init a job scheduler")
-	}
-	scheduler.Start()
-}
+const lastRunStateKey = "last_run_at"
 
 /*
 func TriggerLaunchAtJob(ctx models.TriggerContext) error {
@@ -55,12 +52,32 @@ func TriggerLaunchAtJob(ctx models.TriggerContext) error {
 */
 
 func RemoveLaunchNewCronJob(ctx models.Context) error {
-	err := scheduler.RemoveJob(workflowJobUUID[ctx.WorkflowID])
+	return schedulerEngine.Unschedule(ctx)
+}
+
+func runCronJob(ctx models.Context) {
+	if err := workflowEngine.SetTriggerState(ctx, lastRunStateKey, time.Now().Format(time.RFC3339)); err != nil {
+		logEngine.NewContextLogEntry(ctx, models.WarnLog, "Couldn't save the time of the last run.")
+	}
+	workflowEngine.RunWorkflow(ctx)
+}
+
+// missedCronRun tells if a tick of the crontab was due between the last saved
+// run and now.
+func missedCronRun(ctx models.Context, crontab string) bool {
+	lastRun, saved := workflowEngine.GetTriggerState(ctx, lastRunStateKey)
+	if !saved {
+		return false
+	}
+	lastRunAt, err := time.Parse(time.RFC3339, lastRun)
 	if err != nil {
-		return errors.New("Removal of given job resulted in an error. Err " + err.Error())
+		return false
 	}
-	delete(workflowJobUUID, ctx.WorkflowID)
-	return nil
+	schedule, err := cron.ParseStandard(crontab)
+	if err != nil {
+		return false
+	}
+	return schedule.Next(lastRunAt).Before(time.Now())
 }
 
 func TriggerLaunchNewCronJob(ctx models.Context) error {
@@ -69,15 +86,16 @@ func TriggerLaunchNewCronJob(ctx models.Context) error {
 		return errors.New("Missing parameters")
 	}
 
-	job, err := scheduler.NewJob(
-		gocron.CronJob(crontab, false),
-		gocron.NewTask(workflowEngine.RunWorkflow, ctx),
-	)
-
-	if err != nil {
+	if err := schedulerEngine.ScheduleCron(ctx, crontab, runCronJob); err != nil {
 		return errors.New("Set-up of the cron-job failed, please re-try later. Err: " + err.Error())
 	}
-	workflowJobUUID[ctx.WorkflowID] = job.ID()
+
+	// The ticks missed while the trigger was down are merged in a single run.
+	if ctx.CatchUp && missedCronRun(ctx, crontab) {
+		go runCronJob(ctx)
+	} else if err := workflowEngine.SetTriggerState(ctx, lastRunStateKey, time.Now().Format(time.RFC3339)); err != nil {
+		log.Printf("Couldn't save the cron-job start of workflow #%d.\n", ctx.WorkflowID)
+	}
 
 	return nil
 }
@@ -0,0 +1,12 @@
+package webhook
+
+import "gorm.io/gorm"
+
+// WebhookIngest is the secret URL receiving the requests of a workflow, it is
+// kept while the workflow is disabled so the senders don't need updating.
+type WebhookIngest struct {
+	gorm.Model
+	WorkflowID uint   `gorm:"not null;uniqueIndex"`
+	TokenHash  string `gorm:"not null;uniqueIndex"`
+	Token      string `gorm:"type:text;serializer:encrypted"`
+}
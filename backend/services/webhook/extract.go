@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"dawpitech/area/engines/workflowEngine"
+	"dawpitech/area/models"
+	"net/http"
+)
+
+const (
+	querySource   = "query"
+	headersSource = "headers"
+)
+
+func parseExtractions(spec string) ([]workflowEngine.Extraction, error) {
+	return workflowEngine.ParseExtractions(spec, []string{querySource, headersSource}, []string{"body", "received_at"})
+}
+
+func extractionOutputs(parameters map[string]string) ([]models.Parameter, error) {
+	extractions, err := parseExtractions(parameters["webhook_extract"])
+	if err != nil {
+		return nil, err
+	}
+	return workflowEngine.ExtractionOutputs(extractions), nil
+}
+
+// extractValue returns the value of the extraction in the request, document
+// is its decoded JSON body.
+func extractValue(extraction workflowEngine.Extraction, document interface{}, request *http.Request) (string, bool) {
+	switch extraction.Source {
+	case querySource:
+		values, present := request.URL.Query()[extraction.Key]
+		if !present || len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	case headersSource:
+		values := request.Header.Values(extraction.Key)
+		if len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	default:
+		return extraction.ExtractJSON(document)
+	}
+}
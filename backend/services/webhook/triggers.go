@@ -0,0 +1,173 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"dawpitech/area/crypto"
+	"dawpitech/area/engines/eventEngine"
+	"dawpitech/area/engines/logEngine"
+	"dawpitech/area/engines/workflowEngine"
+	"dawpitech/area/initializers"
+	"dawpitech/area/models"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	receivedActionName = "webhook_received"
+	receivedEventType  = "webhook.received"
+	workflowAttribute  = "workflow_id"
+	signatureHeader    = "X-Webhook-Signature"
+	maxBodySize        = 1 << 20
+)
+
+func ingestURL(token string) string {
+	return os.Getenv("PUBLIC_URL") + "/providers/webhook/hooks/" + token
+}
+
+// IngestURL returns the secret URL receiving the requests of the workflow, a
+// new one replaces the previous when rotate is set.
+func IngestURL(workflow models.Workflow, rotate bool) (string, error) {
+	if workflow.ActionName != receivedActionName {
+		return "", errors.NewBadRequest(nil, "The workflow isn't triggered by a webhook.")
+	}
+
+	var ingest WebhookIngest
+	rst := initializers.DB.Where("workflow_id=?", workflow.ID).Limit(1).Find(&ingest)
+	if rst.Error != nil {
+		log.Printf("Couldn't load the webhook of workflow #%d. Err: %s\n", workflow.ID, rst.Error.Error())
+		return "", errors.New("Internal server error.")
+	}
+	if rst.RowsAffected == 1 && !rotate {
+		return ingestURL(ingest.Token), nil
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", errors.New("Internal server error.")
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	ingest.WorkflowID = workflow.ID
+	ingest.Token = token
+	ingest.TokenHash = crypto.HashToken(token)
+	if rst := initializers.DB.Save(&ingest); rst.Error != nil {
+		log.Printf("Couldn't save the webhook of workflow #%d. Err: %s\n", workflow.ID, rst.Error.Error())
+		return "", errors.New("Internal server error.")
+	}
+	return ingestURL(token), nil
+}
+
+// SetupWebhookTrigger makes sure the workflow has its URL, the requests are
+// then accepted as long as the workflow is active.
+func SetupWebhookTrigger(ctx models.Context) error {
+	extract, _ := workflowEngine.GetParam(workflowEngine.Trigger, "webhook_extract", ctx)
+	if _, err := parseExtractions(extract); err != nil {
+		return err
+	}
+
+	var workflow models.Workflow
+	if rst := initializers.DB.Where("id=?", ctx.WorkflowID).First(&workflow); rst.Error != nil {
+		return errors.New("Couldn't load the workflow.")
+	}
+	if _, err := IngestURL(workflow, false); err != nil {
+		return err
+	}
+
+	workflowID := strconv.FormatUint(uint64(ctx.WorkflowID), 10)
+	eventEngine.Subscribe(ctx, receivedEventType, func(event models.Event) bool {
+		return event.Attributes[workflowAttribute] == workflowID
+	})
+	return nil
+}
+
+// RemoveWebhookTrigger keeps the URL, the requests received while the
+// workflow is disabled are refused.
+func RemoveWebhookTrigger(ctx models.Context) error {
+	eventEngine.Unsubscribe(ctx)
+	return nil
+}
+
+// validSignature checks the hex HMAC-SHA256 of the body, with or without the
+// 'sha256=' prefix.
+func validSignature(secret string, body []byte, signature string) bool {
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// ReceiveWebhook runs the workflow owning the URL with the values extracted
+// from the request.
+func ReceiveWebhook(c *gin.Context) error {
+	var ingest WebhookIngest
+	if rst := initializers.DB.Where("token_hash=?", crypto.HashToken(c.Param("token"))).First(&ingest); rst.Error != nil {
+		return errors.NotFound
+	}
+
+	// Any instance can receive the request, the event is then dispatched by
+	// the leader where the trigger is armed.
+	var workflow models.Workflow
+	if rst := initializers.DB.
+		Where("id=? AND active=? AND action_name=?", ingest.WorkflowID, true, receivedActionName).
+		First(&workflow); rst.Error != nil {
+		return errors.NotFound
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize))
+	if err != nil {
+		return errors.NewBadRequest(err, "The body of the request couldn't be read or is too large.")
+	}
+
+	ctx := workflowEngine.NewContext(workflow)
+	if secret, ok := workflowEngine.GetParam(workflowEngine.Trigger, "webhook_secret", ctx); ok {
+		if !validSignature(secret, body, c.GetHeader(signatureHeader)) {
+			logEngine.NewContextLogEntry(ctx, models.WarnLog, "Refused a webhook request with a missing or invalid signature.")
+			return errors.NewUnauthorized(nil, "Missing or invalid signature.")
+		}
+	}
+
+	extract, _ := workflowEngine.GetParam(workflowEngine.Trigger, "webhook_extract", ctx)
+	extractions, err := parseExtractions(extract)
+	if err != nil {
+		logEngine.NewContextLogEntry(ctx, models.ErrorLog, err.Error())
+		return errors.New("Internal server error.")
+	}
+
+	// A body that isn't JSON is still given raw, only its paths are missing.
+	document := workflowEngine.DecodeJSON(body)
+	ctx.RuntimeData["body"] = string(body)
+	ctx.RuntimeData["received_at"] = time.Now().Format(time.RFC3339)
+	for _, extraction := range extractions {
+		if value, ok := extractValue(extraction, document, c.Request); ok {
+			ctx.RuntimeData[extraction.Name] = value
+		}
+	}
+
+	if err := eventEngine.Publish(models.Event{
+		Type: receivedEventType,
+		Attributes: map[string]string{
+			workflowAttribute: strconv.FormatUint(uint64(workflow.ID), 10),
+		},
+		Data: ctx.RuntimeData,
+	}); err != nil {
+		return errors.New("Internal server error.")
+	}
+
+	c.Status(http.StatusAccepted)
+	c.Writer.WriteHeaderNow()
+	return nil
+}
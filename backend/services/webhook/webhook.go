@@ -0,0 +1,56 @@
+package webhook
+
+import "dawpitech/area/models"
+
+var Provider = models.Service{
+	Name:   "Webhook",
+	Hidden: false,
+	Actions: []models.Action{
+		{
+			Name:        receivedActionName,
+			PrettyName:  "Webhook received",
+			Description: "Trigger when a request is posted on the secret URL of the workflow, the values to keep are picked with one 'name=path' per line, like 'ref=body.commits[0].id', 'env=query.env' or 'event=headers.X-Event'",
+			Parameters: []models.Parameter{
+				{
+					Name:       "webhook_secret",
+					PrettyName: "Secret signing the requests (optional)",
+					Type:       models.String,
+					Sensitive:  true,
+				},
+				{
+					Name:       "webhook_extract",
+					PrettyName: "Values to extract",
+					Type:       models.String,
+				},
+			},
+			Outputs: []models.Parameter{
+				{
+					Name:       "body",
+					PrettyName: "Raw body of the request",
+					Type:       models.String,
+				},
+				{
+					Name:       "received_at",
+					PrettyName: "Time the request was received",
+					Type:       models.Date,
+				},
+			},
+			DynamicOutputs: extractionOutputs,
+			SetupTrigger:   SetupWebhookTrigger,
+			RemoveTrigger:  RemoveWebhookTrigger,
+		},
+	},
+	Modifiers:  nil,
+	Reactions:  nil,
+	AuthMethod: nil,
+	WebhookEndpoints: []models.WebhookEndpoint{
+		{
+			EndpointURL:   "/providers/webhook/hooks/:token",
+			HandlerMethod: ReceiveWebhook,
+		},
+	},
+	LoginMethod: nil,
+	DBModels: []interface{}{
+		&WebhookIngest{},
+	},
+}
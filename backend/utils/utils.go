@@ -2,6 +2,7 @@ package utils
 
 import (
 	"dawpitech/area/models"
+	"github.com/gin-gonic/gin"
 	"golang.org/x/oauth2"
 	"strings"
 )
@@ -17,6 +18,21 @@ func MaybeGetUser(maybeUser any) (*models.User, bool) {
 	}
 }
 
+func MaybeGetSession(c *gin.Context) (*models.Session, bool) {
+	maybeSession, ok := c.Get("session")
+	if !ok {
+		return nil, false
+	}
+	switch s := maybeSession.(type) {
+	case models.Session:
+		return &s, true
+	case *models.Session:
+		return s, true
+	default:
+		return nil, false
+	}
+}
+
 func OAuthScopeStringFromToken(token *oauth2.Token) (string, bool) {
 	if token == nil {
 		return "", false